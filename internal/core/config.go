@@ -0,0 +1,627 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// ConfigFile is the configuration file of the targets in the root of
+	// the repository
+	ConfigFile = ".mage.yaml"
+	// ConfigVersion is the version of the configuration file
+	ConfigVersion = 1
+	// SourceDefault is the source of settings not configured in the
+	// configuration file or the environment
+	SourceDefault = "default"
+)
+
+var (
+	configMu sync.Mutex
+	configs  = map[string]*Config{}
+)
+
+// Config is the configuration of the targets. Values are read from
+// [ConfigFile] and are overridden by environment variables.
+type Config struct {
+	Version   int
+	Terraform TerraformConfig
+	Go        GoConfig
+	Helm      HelmConfig
+	OPA       OPAConfig
+	Docker    DockerConfig
+	PolicyBot PolicyBotConfig
+	Git       GitConfig
+	Matrix    MatrixConfig
+	Discovery DiscoveryConfig
+	// Sources is where the value of every setting came from, either
+	// [SourceDefault], the configuration file and line or the environment
+	// variable
+	Sources map[string]string
+	// Warnings are the invalid values of environment variables, they are
+	// ignored like before the configuration file existed
+	Warnings []string
+}
+
+// TerraformConfig configures the Terraform targets
+type TerraformConfig struct {
+	UseTofu              bool
+	SkipIfNoChangesInDir bool
+	AdditionalGlobs      []string
+	CostPricingFile      string
+	CostPricingURL       string
+	SecuritySeverity     string
+}
+
+// GoConfig configures the Go targets
+type GoConfig struct {
+	AdditionalGlobs []string
+	// Runtime is docker or local
+	Runtime string
+}
+
+// HelmConfig configures the Helm targets
+type HelmConfig struct {
+	InDocker bool
+}
+
+// OPAConfig configures the policy evaluation
+type OPAConfig struct {
+	InDocker bool
+}
+
+// DockerConfig configures the OCI image targets
+type DockerConfig struct {
+	OCIImageBase string
+	PushImage    bool
+	// BuildUnchanged builds the images of binaries without changes since
+	// the last release
+	BuildUnchanged bool
+	// Dockerfile replaces the embedded Dockerfile of the binaries without
+	// a cmd/<binary>/Dockerfile
+	Dockerfile string
+	// Tags are the tagging strategies of the images: timestamp, sha, semver
+	// or branch
+	Tags []string
+	// Sign signs the pushed images with cosign and attests their SLSA
+	// provenance
+	Sign bool
+	// SignKey is the cosign private key, images are signed keyless with
+	// the OIDC token of GitHub Actions when it is empty
+	SignKey string
+	// VerifyKey is the cosign public key, signatures are verified keyless
+	// when it is empty
+	VerifyKey string
+	// CertificateIdentity is a regular expression matching the identity of
+	// keyless signatures
+	CertificateIdentity string
+	// RequiredLabels must be set in the config of every image
+	RequiredLabels []string
+	// MaxImageSize is the largest compressed size of the image of a
+	// platform in MiB, there is no limit when it is 0
+	MaxImageSize int
+	// LintIgnore are the lint rules of docker:validate that are not
+	// reported
+	LintIgnore []string
+	SmokeTest  SmokeTestConfig
+}
+
+// SmokeTestConfig configures the smoke test of the OCI images
+type SmokeTestConfig struct {
+	// Args are passed to the binary when HTTPPath is empty
+	Args []string
+	// Entrypoint runs the binary when HTTPPath is empty, the name of the
+	// binary on the PATH of the image when it is empty
+	Entrypoint string
+	// Env are the environment variables of the container, KEY=VALUE
+	Env []string
+	// HTTPPath is requested instead of running the binary with Args
+	HTTPPath   string
+	HTTPPort   int
+	HTTPStatus int
+	// Timeout is in seconds
+	Timeout int
+}
+
+// PolicyBotConfig configures the policy-bot targets
+type PolicyBotConfig struct {
+	ConfigFilePath string
+}
+
+// GitConfig configures the change detection
+type GitConfig struct {
+	// ChangedFiles replaces the git diff when set
+	ChangedFiles []string
+	// DefaultBranch is the branch changes are compared to
+	DefaultBranch string
+	// IncludeUntracked adds untracked files to the changes, defaults to
+	// true outside of CI
+	IncludeUntracked bool
+}
+
+// DiscoveryConfig configures the discovery of Go modules, Terraform projects,
+// Helm charts and pallets with gitignore-style patterns, see [Discovery]
+type DiscoveryConfig struct {
+	Exclude []string
+	Include []string
+}
+
+// MatrixConfig configures the GitHub Actions job matrices
+type MatrixConfig struct {
+	ChunkSize   int
+	MaxParallel int
+}
+
+// Setting describes a setting of the configuration
+type Setting struct {
+	// Key is the path of the setting in the configuration file
+	Key string
+	// Env is the environment variable overriding the setting
+	Env string
+	// Description of the setting
+	Description string
+	// keepEmpty treats an empty environment variable as set
+	keepEmpty bool
+	set       func(c *Config, value any) error
+	get       func(c *Config) any
+}
+
+// Settings are the settings of the configuration sorted by key
+var Settings = []Setting{
+	listSetting("discovery.exclude", "DISCOVERY_EXCLUDE", "Patterns excluded from discovery",
+		func(c *Config) *[]string { return &c.Discovery.Exclude }, false, nil),
+	listSetting("discovery.include", "DISCOVERY_INCLUDE", "Patterns included in discovery, even if excluded",
+		func(c *Config) *[]string { return &c.Discovery.Include }, false, nil),
+	boolSetting("docker.build_unchanged", "DOCKER_BUILD_UNCHANGED", "Build the images of binaries without changes since the last release",
+		func(c *Config) *bool { return &c.Docker.BuildUnchanged }),
+	stringSetting("docker.certificate_identity", "DOCKER_CERTIFICATE_IDENTITY", "Regular expression of the identity of keyless signatures",
+		func(c *Config) *string { return &c.Docker.CertificateIdentity }, nil),
+	stringSetting("docker.dockerfile", "DOCKERFILE", "Dockerfile of the binaries without a cmd/<binary>/Dockerfile",
+		func(c *Config) *string { return &c.Docker.Dockerfile }, nil),
+	listSetting("docker.lint_ignore", "DOCKER_LINT_IGNORE", "Lint rules of the Dockerfiles that are not reported",
+		func(c *Config) *[]string { return &c.Docker.LintIgnore }, false,
+		oneOf("unpinned-image", "DL3006", "DL3007", "apk-cache", "DL3018", "DL3019", "root-user", "DL3002", "add-url", "DL3020")),
+	nonNegativeIntSetting("docker.max_image_size", "DOCKER_MAX_IMAGE_SIZE", "Largest compressed size of the image of a platform in MiB, 0 is unlimited",
+		func(c *Config) *int { return &c.Docker.MaxImageSize }),
+	stringSetting("docker.oci_image_base", "OCI_IMAGE_BASE", "Registry and path prefix of the OCI images",
+		func(c *Config) *string { return &c.Docker.OCIImageBase }, nil),
+	boolSetting("docker.push_image", "PUSH_IMAGE", "Push the OCI images after building them",
+		func(c *Config) *bool { return &c.Docker.PushImage }),
+	listSetting("docker.required_labels", "DOCKER_REQUIRED_LABELS", "Labels required in the config of every OCI image",
+		func(c *Config) *[]string { return &c.Docker.RequiredLabels }, false, nil),
+	boolSetting("docker.sign", "DOCKER_SIGN", "Sign pushed OCI images and attest their provenance with cosign",
+		func(c *Config) *bool { return &c.Docker.Sign }),
+	stringSetting("docker.sign_key", "DOCKER_SIGN_KEY", "cosign private key, keyless signing when empty",
+		func(c *Config) *string { return &c.Docker.SignKey }, nil),
+	lineListSetting("docker.smoke_test.args", "DOCKER_SMOKE_TEST_ARGS", "Arguments of the binary in the smoke test",
+		func(c *Config) *[]string { return &c.Docker.SmokeTest.Args }, nil),
+	stringSetting("docker.smoke_test.entrypoint", "DOCKER_SMOKE_TEST_ENTRYPOINT", "Entrypoint of the smoke test, the name of the binary when empty",
+		func(c *Config) *string { return &c.Docker.SmokeTest.Entrypoint }, nil),
+	lineListSetting("docker.smoke_test.env", "DOCKER_SMOKE_TEST_ENV", "Environment variables of the smoke test, KEY=VALUE",
+		func(c *Config) *[]string { return &c.Docker.SmokeTest.Env }, envVariable),
+	stringSetting("docker.smoke_test.http_path", "DOCKER_SMOKE_TEST_HTTP_PATH", "HTTP path requested in the smoke test instead of running the binary",
+		func(c *Config) *string { return &c.Docker.SmokeTest.HTTPPath }, httpPath),
+	intSetting("docker.smoke_test.http_port", "DOCKER_SMOKE_TEST_HTTP_PORT", "Port of the container serving the HTTP path",
+		func(c *Config) *int { return &c.Docker.SmokeTest.HTTPPort }),
+	intSetting("docker.smoke_test.http_status", "DOCKER_SMOKE_TEST_HTTP_STATUS", "Expected status of the HTTP path",
+		func(c *Config) *int { return &c.Docker.SmokeTest.HTTPStatus }),
+	intSetting("docker.smoke_test.timeout", "DOCKER_SMOKE_TEST_TIMEOUT", "Seconds the smoke test of an image may take",
+		func(c *Config) *int { return &c.Docker.SmokeTest.Timeout }),
+	listSetting("docker.tags", "DOCKER_TAGS", "Tagging strategies of the OCI images, the first tag is the primary tag",
+		func(c *Config) *[]string { return &c.Docker.Tags }, false, oneOf("timestamp", "sha", "semver", "branch")),
+	stringSetting("docker.verify_key", "DOCKER_VERIFY_KEY", "cosign public key, keyless verification when empty",
+		func(c *Config) *string { return &c.Docker.VerifyKey }, nil),
+	listSetting("git.changed_files", "CHANGED_FILES", "Changed files used instead of the git diff",
+		func(c *Config) *[]string { return &c.Git.ChangedFiles }, true, nil),
+	stringSetting("git.default_branch", "GIT_DEFAULT_BRANCH", "Branch the changes are compared to",
+		func(c *Config) *string { return &c.Git.DefaultBranch }, nil),
+	boolSetting("git.include_untracked", "GIT_INCLUDE_UNTRACKED", "Include untracked files in the changes",
+		func(c *Config) *bool { return &c.Git.IncludeUntracked }),
+	listSetting("go.additional_globs", "ADDITIONAL_GLOBS_GO", "Globs of files that change every Go module",
+		func(c *Config) *[]string { return &c.Go.AdditionalGlobs }, false, nil),
+	stringSetting("go.runtime", "GO_RUNTIME", "Run Go in docker or use the local Go",
+		func(c *Config) *string { return &c.Go.Runtime }, oneOf("docker", "local")),
+	boolSetting("helm.in_docker", "HELM_IN_DOCKER", "Always run Helm in docker",
+		func(c *Config) *bool { return &c.Helm.InDocker }),
+	intSetting("matrix.chunk_size", "MATRIX_CHUNK_SIZE", "Jobs per chunk of a job matrix",
+		func(c *Config) *int { return &c.Matrix.ChunkSize }),
+	intSetting("matrix.max_parallel", "MATRIX_MAX_PARALLEL", "max-parallel hint of a job matrix",
+		func(c *Config) *int { return &c.Matrix.MaxParallel }),
+	boolSetting("opa.in_docker", "OPA_IN_DOCKER", "Always run OPA in docker",
+		func(c *Config) *bool { return &c.OPA.InDocker }),
+	stringSetting("policy_bot.config_file_path", "POLICY_CONFIG_FILE_PATH", "Path of the policy-bot configuration",
+		func(c *Config) *string { return &c.PolicyBot.ConfigFilePath }, nil),
+	listSetting("terraform.additional_globs", "ADDITIONAL_GLOBS_TERRAFORM", "Globs of files that change every Terraform project",
+		func(c *Config) *[]string { return &c.Terraform.AdditionalGlobs }, false, nil),
+	stringSetting("terraform.cost_pricing_file", "TERRAFORM_COST_PRICING_FILE", "Pricing file for the cost estimation",
+		func(c *Config) *string { return &c.Terraform.CostPricingFile }, nil),
+	stringSetting("terraform.cost_pricing_url", "TERRAFORM_COST_PRICING_URL", "Pricing API for the cost estimation",
+		func(c *Config) *string { return &c.Terraform.CostPricingURL }, httpURL),
+	stringSetting("terraform.security_severity", "TERRAFORM_SECURITY_SEVERITY", "Lowest severity reported by trivy",
+		func(c *Config) *string { return &c.Terraform.SecuritySeverity },
+		oneOf("UNKNOWN", "LOW", "MEDIUM", "HIGH", "CRITICAL")),
+	boolSetting("terraform.skip_if_no_changes_in_dir", "TERRAFORM_SKIP_IF_NO_CHANGES_IN_DIR", "Skip Terraform projects without changes",
+		func(c *Config) *bool { return &c.Terraform.SkipIfNoChangesInDir }),
+	boolSetting("terraform.use_tofu", "USE_TOFU", "Use OpenTofu for projects without a version file",
+		func(c *Config) *bool { return &c.Terraform.UseTofu }),
+}
+
+// defaultConfig returns the configuration used when nothing is configured
+func defaultConfig() *Config {
+	return &Config{
+		Version: ConfigVersion,
+		Go:      GoConfig{Runtime: "docker"},
+		Docker: DockerConfig{
+			OCIImageBase: "ocreg.invalid/coopnorge",
+			Tags:         []string{"timestamp"},
+			RequiredLabels: []string{
+				"org.opencontainers.image.source",
+				"org.opencontainers.image.revision",
+			},
+			SmokeTest: SmokeTestConfig{
+				Args:       []string{"--help"},
+				HTTPPort:   8080,
+				HTTPStatus: http.StatusOK,
+				Timeout:    30,
+			},
+		},
+		PolicyBot: PolicyBotConfig{ConfigFilePath: ".policy.yml"},
+		Git: GitConfig{
+			DefaultBranch: "main",
+			// CI is set by GitHub Actions
+			IncludeUntracked: os.Getenv("CI") == "",
+		},
+		Sources: map[string]string{},
+	}
+}
+
+// LoadConfig returns the configuration from the [ConfigFile] in directory
+// merged with the environment variables. The configuration file is optional.
+// Invalid values in the configuration file are errors, invalid values of
+// environment variables are ignored and added to the warnings.
+func LoadConfig(directory string) (*Config, error) {
+	config := defaultConfig()
+	for _, setting := range Settings {
+		config.Sources[setting.Key] = SourceDefault
+	}
+
+	file := filepath.Join(directory, ConfigFile)
+	content, err := os.ReadFile(file)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		err = config.loadFile(file, content)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, setting := range Settings {
+		value, ok := os.LookupEnv(setting.Env)
+		if !ok || (value == "" && !setting.keepEmpty) {
+			continue
+		}
+		err := setting.set(config, value)
+		if err != nil {
+			config.Warnings = append(config.Warnings, fmt.Sprintf("ignoring invalid %s: %s", setting.Env, err))
+			continue
+		}
+		config.Sources[setting.Key] = fmt.Sprintf("env %s", setting.Env)
+	}
+	return config, nil
+}
+
+// CurrentConfig returns the configuration of the repository in the working
+// directory, see [LoadConfig]. The configuration is loaded once per
+// directory and environment and reused for the rest of the run, its warnings
+// are printed when it is loaded. It must not be modified.
+func CurrentConfig() (*Config, error) {
+	abs, err := filepath.Abs(".")
+	if err != nil {
+		return nil, err
+	}
+	key := abs + "\x00" + settingsEnv()
+	configMu.Lock()
+	defer configMu.Unlock()
+	if config, ok := configs[key]; ok {
+		return config, nil
+	}
+	config, err := LoadConfig(".")
+	if err != nil {
+		return nil, err
+	}
+	for _, warning := range config.Warnings {
+		fmt.Printf("Warning: %s\n", warning)
+	}
+	configs[key] = config
+	return config, nil
+}
+
+// settingsEnv returns the environment variables of the settings that are set
+func settingsEnv() string {
+	env := []string{}
+	for _, setting := range Settings {
+		if value, ok := os.LookupEnv(setting.Env); ok {
+			env = append(env, setting.Env+"="+value)
+		}
+	}
+	return strings.Join(env, "\x00")
+}
+
+// IsSet returns true if the setting is configured in the configuration file
+// or the environment
+func (c *Config) IsSet(key string) bool {
+	source, ok := c.Sources[key]
+	return ok && source != SourceDefault
+}
+
+// Value returns the value of the setting with key
+func (c *Config) Value(key string) (any, error) {
+	for _, setting := range Settings {
+		if setting.Key == key {
+			return setting.get(c), nil
+		}
+	}
+	return nil, fmt.Errorf("unknown setting %q", key)
+}
+
+// loadFile sets the values in the configuration file
+func (c *Config) loadFile(file string, content []byte) error {
+	var doc yaml.Node
+	err := yaml.Unmarshal(content, &doc)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+	if len(doc.Content) == 0 {
+		return fmt.Errorf("%s: version is required", file)
+	}
+	values := map[string]*yaml.Node{}
+	err = flattenConfig(file, "", doc.Content[0], values)
+	if err != nil {
+		return err
+	}
+
+	version, ok := values["version"]
+	if !ok {
+		return fmt.Errorf("%s: version is required", file)
+	}
+	if version.Value != strconv.Itoa(ConfigVersion) {
+		return fmt.Errorf("%s:%d: unsupported version %q, must be %d", file, version.Line, version.Value, ConfigVersion)
+	}
+	delete(values, "version")
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		node := values[key]
+		i := slices.IndexFunc(Settings, func(s Setting) bool { return s.Key == key })
+		if i < 0 {
+			return fmt.Errorf("%s:%d: unknown setting %q", file, node.Line, key)
+		}
+		var value any
+		err := node.Decode(&value)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %s: %w", file, node.Line, key, err)
+		}
+		err = Settings[i].set(c, value)
+		if err != nil {
+			return fmt.Errorf("%s:%d: invalid %s: %w", file, node.Line, key, err)
+		}
+		c.Sources[key] = fmt.Sprintf("%s:%d", ConfigFile, node.Line)
+	}
+	return nil
+}
+
+// flattenConfig collects the values of the nested mappings by their dotted
+// key
+func flattenConfig(file, prefix string, node *yaml.Node, values map[string]*yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s:%d: expected a mapping", file, node.Line)
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i].Value
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		value := node.Content[i+1]
+		if value.Kind == yaml.MappingNode {
+			err := flattenConfig(file, key, value, values)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		values[key] = value
+	}
+	return nil
+}
+
+func boolSetting(key, env, description string, field func(*Config) *bool) Setting {
+	return Setting{
+		Key: key, Env: env, Description: description,
+		get: func(c *Config) any { return *field(c) },
+		set: func(c *Config, value any) error {
+			switch v := value.(type) {
+			case bool:
+				*field(c) = v
+			case string:
+				b, err := strconv.ParseBool(v)
+				if err != nil {
+					return fmt.Errorf("%q is not a boolean", v)
+				}
+				*field(c) = b
+			default:
+				return fmt.Errorf("%v is not a boolean", value)
+			}
+			return nil
+		},
+	}
+}
+
+func intSetting(key, env, description string, field func(*Config) *int) Setting {
+	return numberSetting(key, env, description, field, 1)
+}
+
+// nonNegativeIntSetting is a number where 0 turns the setting off, like an
+// unlimited size
+func nonNegativeIntSetting(key, env, description string, field func(*Config) *int) Setting {
+	return numberSetting(key, env, description, field, 0)
+}
+
+// numberSetting is a number of at least minimum
+func numberSetting(key, env, description string, field func(*Config) *int, minimum int) Setting {
+	return Setting{
+		Key: key, Env: env, Description: description,
+		get: func(c *Config) any { return *field(c) },
+		set: func(c *Config, value any) error {
+			var i int
+			switch v := value.(type) {
+			case int:
+				i = v
+			case string:
+				var err error
+				i, err = strconv.Atoi(v)
+				if err != nil {
+					return fmt.Errorf("%q is not a number", v)
+				}
+			default:
+				return fmt.Errorf("%v is not a number", value)
+			}
+			switch {
+			case i < minimum && minimum == 1:
+				return fmt.Errorf("%d must be a positive number", i)
+			case i < minimum:
+				return fmt.Errorf("%d must be at least %d", i, minimum)
+			}
+			*field(c) = i
+			return nil
+		},
+	}
+}
+
+func stringSetting(key, env, description string, field func(*Config) *string, validate func(string) error) Setting {
+	return Setting{
+		Key: key, Env: env, Description: description,
+		get: func(c *Config) any { return *field(c) },
+		set: func(c *Config, value any) error {
+			s, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("%v is not a string", value)
+			}
+			if validate != nil {
+				err := validate(s)
+				if err != nil {
+					return err
+				}
+			}
+			*field(c) = s
+			return nil
+		},
+	}
+}
+
+// listSetting is a list in the configuration file and a comma separated list
+// in the environment
+func listSetting(key, env, description string, field func(*Config) *[]string, keepEmpty bool, validate func(string) error) Setting {
+	return Setting{
+		Key: key, Env: env, Description: description, keepEmpty: keepEmpty,
+		get: func(c *Config) any { return *field(c) },
+		set: func(c *Config, value any) error {
+			list := []string{}
+			switch v := value.(type) {
+			case string:
+				list = strings.Split(v, ",")
+			case []any:
+				for _, item := range v {
+					s, ok := item.(string)
+					if !ok {
+						return fmt.Errorf("%v is not a string", item)
+					}
+					list = append(list, s)
+				}
+			default:
+				return fmt.Errorf("%v is not a list", value)
+			}
+			if validate != nil {
+				for _, item := range list {
+					err := validate(item)
+					if err != nil {
+						return err
+					}
+				}
+			}
+			*field(c) = list
+			return nil
+		},
+	}
+}
+
+// lineListSetting is a list with one item per line in the environment so
+// items can contain commas
+func lineListSetting(key, env, description string, field func(*Config) *[]string, validate func(string) error) Setting {
+	setting := listSetting(key, env, description, field, false, validate)
+	set := setting.set
+	setting.set = func(c *Config, value any) error {
+		s, ok := value.(string)
+		if !ok {
+			return set(c, value)
+		}
+		lines := []any{}
+		for _, line := range strings.Split(s, "\n") {
+			line = strings.TrimSuffix(line, "\r")
+			if strings.TrimSpace(line) != "" {
+				lines = append(lines, line)
+			}
+		}
+		return set(c, lines)
+	}
+	return setting
+}
+
+func oneOf(values ...string) func(string) error {
+	return func(s string) error {
+		if !slices.Contains(values, strings.ToUpper(s)) && !slices.Contains(values, s) {
+			return fmt.Errorf("%q must be one of %s", s, strings.Join(values, ", "))
+		}
+		return nil
+	}
+}
+
+func httpPath(s string) error {
+	if !strings.HasPrefix(s, "/") {
+		return fmt.Errorf("%q is not a path starting with /", s)
+	}
+	return nil
+}
+
+func envVariable(s string) error {
+	name, _, ok := strings.Cut(s, "=")
+	if !ok || name == "" || strings.ContainsAny(name, " \t") {
+		return fmt.Errorf("%q is not KEY=VALUE", s)
+	}
+	return nil
+}
+
+func httpURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q is not a http(s) URL", s)
+	}
+	return nil
+}
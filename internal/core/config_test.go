@@ -0,0 +1,228 @@
+package core_test
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/coopnorge/mage/internal/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		env     map[string]string
+		check   func(t *testing.T, config *core.Config)
+		wantErr string
+	}{
+		{
+			name: "Should use the defaults without a configuration file",
+			check: func(t *testing.T, config *core.Config) {
+				assert.Equal(t, "docker", config.Go.Runtime)
+				assert.Equal(t, ".policy.yml", config.PolicyBot.ConfigFilePath)
+				assert.False(t, config.Terraform.UseTofu)
+				assert.False(t, config.IsSet("git.changed_files"))
+				assert.Equal(t, core.SourceDefault, config.Sources["terraform.use_tofu"])
+			},
+		},
+		{
+			name: "Should read the configuration file",
+			file: `version: 1
+terraform:
+  use_tofu: true
+  additional_globs:
+    - modules/**
+    - shared/*.tf
+docker:
+  oci_image_base: europe-docker.pkg.dev/project/images
+`,
+			check: func(t *testing.T, config *core.Config) {
+				assert.True(t, config.Terraform.UseTofu)
+				assert.Equal(t, []string{"modules/**", "shared/*.tf"}, config.Terraform.AdditionalGlobs)
+				assert.Equal(t, "europe-docker.pkg.dev/project/images", config.Docker.OCIImageBase)
+				assert.Equal(t, ".mage.yaml:3", config.Sources["terraform.use_tofu"])
+				assert.Equal(t, ".mage.yaml:8", config.Sources["docker.oci_image_base"])
+			},
+		},
+		{
+			name: "Should override the configuration file with the environment",
+			file: `version: 1
+terraform:
+  use_tofu: true
+`,
+			env: map[string]string{"USE_TOFU": "false", "ADDITIONAL_GLOBS_GO": "api/**,proto/*", "HELM_IN_DOCKER": "1"},
+			check: func(t *testing.T, config *core.Config) {
+				assert.False(t, config.Terraform.UseTofu)
+				assert.Equal(t, "env USE_TOFU", config.Sources["terraform.use_tofu"])
+				assert.Equal(t, []string{"api/**", "proto/*"}, config.Go.AdditionalGlobs)
+				assert.True(t, config.Helm.InDocker)
+			},
+		},
+		{
+			name: "Should treat an empty CHANGED_FILES as set",
+			env:  map[string]string{"CHANGED_FILES": "", "GO_RUNTIME": ""},
+			check: func(t *testing.T, config *core.Config) {
+				assert.True(t, config.IsSet("git.changed_files"))
+				assert.Equal(t, []string{""}, config.Git.ChangedFiles)
+				assert.Equal(t, "docker", config.Go.Runtime)
+			},
+		},
+		{
+			name: "Should read nested settings",
+			file: `version: 1
+docker:
+  smoke_test:
+    env:
+      - CONFIG_FILE=/etc/app/config.yaml
+    http_path: /healthz
+`,
+			check: func(t *testing.T, config *core.Config) {
+				assert.Equal(t, []string{"CONFIG_FILE=/etc/app/config.yaml"}, config.Docker.SmokeTest.Env)
+				assert.Equal(t, "/healthz", config.Docker.SmokeTest.HTTPPath)
+				assert.Equal(t, 8080, config.Docker.SmokeTest.HTTPPort)
+				assert.Equal(t, ".mage.yaml:6", config.Sources["docker.smoke_test.http_path"])
+			},
+		},
+		{
+			name:    "Should require a version",
+			file:    "terraform:\n  use_tofu: true\n",
+			wantErr: ".mage.yaml: version is required",
+		},
+		{
+			name:    "Should reject unsupported versions",
+			file:    "version: 2\n",
+			wantErr: `.mage.yaml:1: unsupported version "2", must be 1`,
+		},
+		{
+			name:    "Should reject unknown settings",
+			file:    "version: 1\nterraform:\n  use_tofus: true\n",
+			wantErr: `.mage.yaml:3: unknown setting "terraform.use_tofus"`,
+		},
+		{
+			name:    "Should reject invalid values in the configuration file",
+			file:    "version: 1\ngo:\n  runtime: podman\n",
+			wantErr: `.mage.yaml:3: invalid go.runtime: "podman" must be one of docker, local`,
+		},
+		{
+			name: "Should ignore invalid values in the environment",
+			file: `version: 1
+terraform:
+  skip_if_no_changes_in_dir: true
+`,
+			env: map[string]string{"TERRAFORM_SKIP_IF_NO_CHANGES_IN_DIR": "sometimes", "HELM_IN_DOCKER": "yes"},
+			check: func(t *testing.T, config *core.Config) {
+				assert.True(t, config.Terraform.SkipIfNoChangesInDir)
+				assert.Equal(t, ".mage.yaml:3", config.Sources["terraform.skip_if_no_changes_in_dir"])
+				assert.False(t, config.Helm.InDocker)
+				assert.Equal(t, core.SourceDefault, config.Sources["helm.in_docker"])
+				assert.Equal(t, []string{
+					`ignoring invalid HELM_IN_DOCKER: "yes" is not a boolean`,
+					`ignoring invalid TERRAFORM_SKIP_IF_NO_CHANGES_IN_DIR: "sometimes" is not a boolean`,
+				}, config.Warnings)
+			},
+		},
+		{
+			name: "Should ignore invalid items of lists",
+			env:  map[string]string{"DOCKER_TAGS": "sha,date"},
+			check: func(t *testing.T, config *core.Config) {
+				assert.Equal(t, []string{"timestamp"}, config.Docker.Tags)
+				assert.Equal(t, []string{`ignoring invalid DOCKER_TAGS: "date" must be one of timestamp, sha, semver, branch`}, config.Warnings)
+			},
+		},
+		{
+			name: "Should accept hadolint codes as ignored lint rules",
+			env:  map[string]string{"DOCKER_LINT_IGNORE": "root-user,DL3018,dl3020"},
+			check: func(t *testing.T, config *core.Config) {
+				assert.Equal(t, []string{"root-user", "DL3018", "dl3020"}, config.Docker.LintIgnore)
+				assert.Empty(t, config.Warnings)
+			},
+		},
+		{
+			name: "Should read one smoke test argument and environment variable per line",
+			env: map[string]string{
+				"DOCKER_SMOKE_TEST_ENV":  "ALLOWED_HOSTS=a.example.com,b.example.com\nLOG_LEVEL=debug\n",
+				"DOCKER_SMOKE_TEST_ARGS": "--hosts=a.example.com,b.example.com\n--dry-run",
+			},
+			check: func(t *testing.T, config *core.Config) {
+				assert.Equal(t, []string{"ALLOWED_HOSTS=a.example.com,b.example.com", "LOG_LEVEL=debug"}, config.Docker.SmokeTest.Env)
+				assert.Equal(t, []string{"--hosts=a.example.com,b.example.com", "--dry-run"}, config.Docker.SmokeTest.Args)
+				assert.Empty(t, config.Warnings)
+			},
+		},
+		{
+			name: "Should ignore environment variables without a value",
+			env:  map[string]string{"DOCKER_SMOKE_TEST_ENV": "CONFIG_FILE"},
+			check: func(t *testing.T, config *core.Config) {
+				assert.Empty(t, config.Docker.SmokeTest.Env)
+				assert.Equal(t, []string{`ignoring invalid DOCKER_SMOKE_TEST_ENV: "CONFIG_FILE" is not KEY=VALUE`}, config.Warnings)
+			},
+		},
+		{
+			name: "Should reset the largest image size to unlimited",
+			file: "version: 1\ndocker:\n  max_image_size: 50\n",
+			env:  map[string]string{"DOCKER_MAX_IMAGE_SIZE": "0", "MATRIX_CHUNK_SIZE": "0"},
+			check: func(t *testing.T, config *core.Config) {
+				assert.Equal(t, 0, config.Docker.MaxImageSize)
+				assert.Equal(t, "env DOCKER_MAX_IMAGE_SIZE", config.Sources["docker.max_image_size"])
+				assert.Equal(t, []string{"ignoring invalid MATRIX_CHUNK_SIZE: 0 must be a positive number"}, config.Warnings)
+			},
+		},
+		{
+			name: "Should ignore invalid pricing URLs",
+			env:  map[string]string{"TERRAFORM_COST_PRICING_URL": "pricing.internal"},
+			check: func(t *testing.T, config *core.Config) {
+				assert.Empty(t, config.Terraform.CostPricingURL)
+				assert.Equal(t, []string{`ignoring invalid TERRAFORM_COST_PRICING_URL: "pricing.internal" is not a http(s) URL`}, config.Warnings)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, setting := range core.Settings {
+				t.Setenv(setting.Env, "")
+				assert.NoError(t, os.Unsetenv(setting.Env))
+			}
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			dir := t.TempDir()
+			if tt.file != "" {
+				assert.NoError(t, os.WriteFile(filepath.Join(dir, core.ConfigFile), []byte(tt.file), 0o644))
+			}
+
+			config, err := core.LoadConfig(dir)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			tt.check(t, config)
+		})
+	}
+}
+
+func TestSettingsSorted(t *testing.T) {
+	assert.True(t, slices.IsSortedFunc(core.Settings, func(a, b core.Setting) int {
+		return strings.Compare(a.Key, b.Key)
+	}))
+}
+
+func TestCurrentConfig(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("USE_TOFU", "true")
+	first, err := core.CurrentConfig()
+	assert.NoError(t, err)
+	second, err := core.CurrentConfig()
+	assert.NoError(t, err)
+	assert.Same(t, first, second)
+
+	t.Setenv("USE_TOFU", "false")
+	changed, err := core.CurrentConfig()
+	assert.NoError(t, err)
+	assert.NotSame(t, first, changed)
+	assert.False(t, changed.Terraform.UseTofu)
+}
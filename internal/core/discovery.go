@@ -0,0 +1,237 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+const gitignoreFile = ".gitignore"
+
+// DefaultExcludes are excluded from the discovery of every kind
+var DefaultExcludes = []Rule{
+	{Pattern: ".*/", Reason: "dot directory"},
+	{Pattern: "node_modules/", Reason: "node_modules directory"},
+	{Pattern: "/var/", Reason: "output directory"},
+}
+
+// Rule is a gitignore-style pattern excluding paths from discovery, or
+// including them when the pattern starts with !
+type Rule struct {
+	Pattern string
+	// Reason describes why the pattern excludes or includes a path
+	Reason string
+}
+
+// Decision is the result of the discovery of a path
+type Decision struct {
+	Path     string
+	Included bool
+	Reason   string
+}
+
+// IncludedPaths returns the paths of the included decisions
+func IncludedPaths(decisions []Decision) []string {
+	paths := []string{}
+	for _, decision := range decisions {
+		if decision.Included {
+			paths = append(paths, decision.Path)
+		}
+	}
+	return paths
+}
+
+// Discovery decides which paths of a repository are discovered. Paths are
+// matched against the rules in order, the last matching rule wins:
+//
+//   - [DefaultExcludes]
+//   - the excludes of the kind of discovery, e.g. testdata for Go modules
+//   - the .gitignore files in the repository
+//   - discovery.exclude in the configuration
+//   - discovery.include in the configuration
+type Discovery struct {
+	root      string
+	index     *Index
+	defaults  []rule
+	gitignore []rule
+	config    []rule
+}
+
+type rule struct {
+	Rule
+	negate   bool
+	dirOnly  bool
+	anchored bool
+	// base is the directory of the rule relative to the root
+	base string
+	glob string
+}
+
+// NewDiscovery returns the discovery of the repository in root with the
+// excludes of a kind of discovery. discovery.exclude and discovery.include
+// are read from the configuration of the repository in the working
+// directory, see [CurrentConfig].
+func NewDiscovery(root string, excludes ...Rule) (*Discovery, error) {
+	config, err := CurrentConfig()
+	if err != nil {
+		return nil, err
+	}
+	index, err := RepoIndex(root)
+	if err != nil {
+		return nil, err
+	}
+	d := &Discovery{root: root, index: index}
+	for _, r := range append(append([]Rule{}, DefaultExcludes...), excludes...) {
+		d.defaults = appendRule(d.defaults, r, "")
+	}
+	err = d.addGitignore("")
+	if err != nil {
+		return nil, err
+	}
+	for _, pattern := range config.Discovery.Exclude {
+		d.config = appendRule(d.config, Rule{Pattern: pattern, Reason: fmt.Sprintf("discovery.exclude %q (%s)", pattern, config.Sources["discovery.exclude"])}, "")
+	}
+	for _, pattern := range config.Discovery.Include {
+		d.config = appendRule(d.config, Rule{Pattern: "!" + strings.TrimPrefix(pattern, "!"), Reason: fmt.Sprintf("discovery.include %q (%s)", pattern, config.Sources["discovery.include"])}, "")
+	}
+	return d, nil
+}
+
+// appendRule parses a gitignore-style pattern relative to base and appends
+// it to rules
+func appendRule(rules []rule, r Rule, base string) []rule {
+	p := strings.TrimSpace(r.Pattern)
+	if p == "" || strings.HasPrefix(p, "#") {
+		return rules
+	}
+	parsed := rule{Rule: r, base: base}
+	if strings.HasPrefix(p, "!") {
+		parsed.negate = true
+		p = p[1:]
+	}
+	if strings.HasSuffix(p, "/") {
+		parsed.dirOnly = true
+		p = strings.TrimSuffix(p, "/")
+	}
+	// a pattern with a slash at the beginning or in the middle is relative
+	// to the directory of the rule, otherwise it matches at any level
+	if strings.Contains(p, "/") {
+		parsed.anchored = true
+		p = strings.TrimPrefix(p, "/")
+	} else {
+		p = "**/" + p
+	}
+	parsed.glob = p
+	return append(rules, parsed)
+}
+
+// addGitignore adds the patterns of the .gitignore file in dir, relative to
+// the root
+func (d *Discovery) addGitignore(dir string) error {
+	file := filepath.Join(d.root, dir, gitignoreFile)
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err := f.Close()
+		if err != nil {
+			fmt.Printf("Failed to close %s, ignoring: %s\n", file, err)
+		}
+	}()
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		source := path.Join(filepath.ToSlash(dir), gitignoreFile)
+		d.gitignore = appendRule(d.gitignore, Rule{Pattern: text, Reason: fmt.Sprintf("%s:%d %q", source, line, strings.TrimSpace(text))}, filepath.ToSlash(dir))
+	}
+	return scanner.Err()
+}
+
+// Excluded returns true and the reason if the path relative to the root is
+// excluded. A path in an excluded directory is excluded.
+func (d *Discovery) Excluded(p string, isDir bool) (bool, string) {
+	p = filepath.ToSlash(filepath.Clean(p))
+	if p == "." {
+		return false, ""
+	}
+	parts := strings.Split(p, "/")
+	for i := 1; i < len(parts); i++ {
+		if excluded, reason := d.match(strings.Join(parts[:i], "/"), true); excluded {
+			return true, reason
+		}
+	}
+	return d.match(p, isDir)
+}
+
+// match returns the result of the last rule matching the path
+func (d *Discovery) match(p string, isDir bool) (bool, string) {
+	excluded, reason := false, ""
+	for _, rules := range [][]rule{d.defaults, d.gitignore, d.config} {
+		for _, r := range rules {
+			if r.dirOnly && !isDir {
+				continue
+			}
+			rel := p
+			if r.base != "" {
+				if !strings.HasPrefix(p, r.base+"/") {
+					continue
+				}
+				rel = strings.TrimPrefix(p, r.base+"/")
+			}
+			if ok, _ := doublestar.Match(r.glob, rel); !ok {
+				continue
+			}
+			excluded, reason = !r.negate, r.Reason
+		}
+	}
+	return excluded, reason
+}
+
+// Walk calls fn for every directory of the [RepoIndex] of the root.
+// Excluded directories are only walked when all is true, fn is called with
+// the reason of the exclusion. The .gitignore files of the walked directories
+// are applied to their subdirectories.
+func (d *Discovery) Walk(all bool, fn func(dir Dir, excluded bool, reason string) error) error {
+	skipped := []string{}
+	for _, rel := range d.index.Dirs() {
+		if slices.ContainsFunc(skipped, func(s string) bool { return strings.HasPrefix(rel, s+"/") }) {
+			continue
+		}
+		dir, _ := d.Dir(rel)
+		excluded, reason := d.Excluded(rel, true)
+		if excluded && !all {
+			skipped = append(skipped, rel)
+			continue
+		}
+		if !excluded && rel != "." && dir.Has(gitignoreFile) {
+			err := d.addGitignore(rel)
+			if err != nil {
+				return err
+			}
+		}
+		err := fn(dir, excluded, reason)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Dir returns the directory relative to the root from the [RepoIndex] and
+// true if it is in the index
+func (d *Discovery) Dir(rel string) (Dir, bool) {
+	files, ok := d.index.Files(rel)
+	return Dir{Path: filepath.Join(d.root, rel), Files: files}, ok
+}
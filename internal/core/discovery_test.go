@@ -0,0 +1,102 @@
+package core_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/coopnorge/mage/internal/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiscovery(t *testing.T) {
+	tests := []struct {
+		name   string
+		files  map[string]string
+		env    map[string]string
+		all    bool
+		want   []string
+		reason map[string]string
+	}{
+		{
+			name: "Should skip dot directories and node_modules",
+			want: []string{".", "app", "app/cmd", "infra", "infra/generated", "infra/legacy"},
+		},
+		{
+			name:  "Should respect the .gitignore files",
+			files: map[string]string{".gitignore": "# comment\ngenerated/\n", "infra/.gitignore": "/legacy\n"},
+			want:  []string{".", "app", "app/cmd", "infra"},
+		},
+		{
+			name:  "Should include negated .gitignore patterns",
+			files: map[string]string{".gitignore": "infra/*/\n!infra/legacy/\n"},
+			want:  []string{".", "app", "app/cmd", "infra", "infra/legacy"},
+		},
+		{
+			name:  "Should apply discovery.exclude and discovery.include",
+			files: map[string]string{".gitignore": "generated/\n", core.ConfigFile: "version: 1\ndiscovery:\n  exclude:\n    - app/\n  include:\n    - infra/generated/\n"},
+			want:  []string{".", "infra", "infra/generated", "infra/legacy"},
+		},
+		{
+			name: "Should apply DISCOVERY_EXCLUDE",
+			env:  map[string]string{"DISCOVERY_EXCLUDE": "/infra/legacy/,cmd"},
+			want: []string{".", "app", "infra", "infra/generated"},
+		},
+		{
+			name:  "Should walk excluded directories with the reason",
+			files: map[string]string{"infra/.gitignore": "/legacy\n"},
+			all:   true,
+			want:  []string{".", ".github", ".github/workflows", "app", "app/cmd", "infra", "infra/generated", "infra/legacy", "node_modules", "node_modules/pkg"},
+			reason: map[string]string{
+				".github/workflows": "dot directory",
+				"infra/legacy":      `infra/.gitignore:1 "/legacy"`,
+				"node_modules/pkg":  "node_modules directory",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DISCOVERY_EXCLUDE", "")
+			t.Setenv("DISCOVERY_INCLUDE", "")
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			root := t.TempDir()
+			t.Chdir(root)
+			for _, dir := range []string{".github/workflows", "node_modules/pkg", "app/cmd", "infra/generated", "infra/legacy"} {
+				assert.NoError(t, os.MkdirAll(filepath.Join(root, dir), 0o755))
+			}
+			for file, content := range tt.files {
+				assert.NoError(t, os.WriteFile(filepath.Join(root, file), []byte(content), 0o644))
+			}
+
+			discovery, err := core.NewDiscovery(root)
+			assert.NoError(t, err)
+			got := []string{}
+			reasons := map[string]string{}
+			err = discovery.Walk(tt.all, func(dir core.Dir, excluded bool, reason string) error {
+				rel, err := filepath.Rel(root, dir.Path)
+				assert.NoError(t, err)
+				got = append(got, filepath.ToSlash(rel))
+				if excluded {
+					reasons[filepath.ToSlash(rel)] = reason
+				}
+				return nil
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			for path, reason := range tt.reason {
+				assert.Equal(t, reason, reasons[path], path)
+			}
+		})
+	}
+}
+
+func TestIncludedPaths(t *testing.T) {
+	decisions := []core.Decision{
+		{Path: "a", Included: true},
+		{Path: "b", Reason: "testdata directory"},
+		{Path: "c", Included: true},
+	}
+	assert.Equal(t, []string{"a", "c"}, core.IncludedPaths(decisions))
+}
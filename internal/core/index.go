@@ -0,0 +1,196 @@
+package core
+
+import (
+	"bytes"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/magefile/mage/sh"
+)
+
+const (
+	// IndexSourceGit is the source of an index built from git ls-files
+	IndexSourceGit = "git"
+	// IndexSourceWalk is the source of an index built by walking the file
+	// system, used outside of git repositories
+	IndexSourceWalk = "walk"
+)
+
+var (
+	indexMu sync.Mutex
+	indexes = map[string]*Index{}
+)
+
+// Index is the list of files of a repository. In a git repository it contains
+// only the files in the git index, so build output and other untracked junk
+// is never discovered. New files have to be added with git add to be
+// discovered.
+type Index struct {
+	// Source is [IndexSourceGit] or [IndexSourceWalk]
+	Source string
+	// dirs are the names of the files in each directory relative to the
+	// root, every ancestor of a file is a directory
+	dirs map[string][]string
+	// order are the directories in the order of [filepath.WalkDir]
+	order []string
+}
+
+// Dir is a directory in an [Index]
+type Dir struct {
+	// Path is the directory joined with the root of the index
+	Path string
+	// Files are the names of the files in the directory
+	Files []string
+}
+
+// Has returns true if the name of a file in the directory matches the
+// pattern, see [filepath.Match]
+func (d Dir) Has(pattern string) bool {
+	return slices.ContainsFunc(d.Files, func(name string) bool {
+		ok, _ := filepath.Match(pattern, name)
+		return ok
+	})
+}
+
+// RepoIndex returns the index of the repository in root. The index is built
+// once per root with git ls-files, or by walking root if it is not in a git
+// repository, and reused for the rest of the run.
+func RepoIndex(root string) (*Index, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	indexMu.Lock()
+	defer indexMu.Unlock()
+	if index, ok := indexes[abs]; ok {
+		return index, nil
+	}
+	index, err := gitIndex(root)
+	if err != nil {
+		index, err = walkIndex(root)
+		if err != nil {
+			return nil, err
+		}
+	}
+	indexes[abs] = index
+	return index, nil
+}
+
+// gitIndex builds the index from the files in the git index, without the
+// deleted files
+func gitIndex(root string) (*Index, error) {
+	files, err := gitLsFiles(root, "--cached")
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := gitLsFiles(root, "--deleted")
+	if err != nil {
+		return nil, err
+	}
+	index := newIndex(IndexSourceGit)
+	for _, file := range files {
+		if !slices.Contains(deleted, file) {
+			index.addFile(file)
+		}
+	}
+	index.sort()
+	return index, nil
+}
+
+func gitLsFiles(root string, args ...string) ([]string, error) {
+	var stdout, stderr bytes.Buffer
+	_, err := sh.Exec(nil, &stdout, &stderr, "git", append([]string{"-C", root, "ls-files", "-z"}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, file := range strings.Split(stdout.String(), "\x00") {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// walkIndex builds the index from every file and directory in root except
+// the .git directories
+func walkIndex(root string) (*Index, error) {
+	index := newIndex(IndexSourceWalk)
+	err := filepath.WalkDir(root, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		switch {
+		case entry.IsDir() && entry.Name() == ".git" && rel != ".":
+			return filepath.SkipDir
+		case entry.IsDir():
+			index.addDir(rel)
+		default:
+			index.addFile(rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	index.sort()
+	return index, nil
+}
+
+func newIndex(source string) *Index {
+	return &Index{Source: source, dirs: map[string][]string{".": {}}}
+}
+
+func (i *Index) addDir(dir string) {
+	for dir != "." {
+		if _, ok := i.dirs[dir]; ok {
+			return
+		}
+		i.dirs[dir] = []string{}
+		dir = path.Dir(dir)
+	}
+}
+
+func (i *Index) addFile(file string) {
+	dir := path.Dir(file)
+	i.addDir(dir)
+	i.dirs[dir] = append(i.dirs[dir], path.Base(file))
+}
+
+// sort orders the directories like [filepath.WalkDir], a directory is
+// followed by its subdirectories
+func (i *Index) sort() {
+	i.order = make([]string, 0, len(i.dirs))
+	for dir := range i.dirs {
+		i.order = append(i.order, dir)
+		slices.Sort(i.dirs[dir])
+	}
+	slices.SortFunc(i.order, func(a, b string) int {
+		if a == "." || b == "." {
+			return strings.Compare(strings.TrimPrefix(a, "."), strings.TrimPrefix(b, "."))
+		}
+		return slices.Compare(strings.Split(a, "/"), strings.Split(b, "/"))
+	})
+}
+
+// Dirs returns the directories of the index relative to the root in the
+// order of [filepath.WalkDir]
+func (i *Index) Dirs() []string {
+	return i.order
+}
+
+// Files returns the names of the files in the directory relative to the root
+// and true if the directory is in the index
+func (i *Index) Files(dir string) ([]string, bool) {
+	files, ok := i.dirs[filepath.ToSlash(filepath.Clean(dir))]
+	return files, ok
+}
@@ -0,0 +1,61 @@
+package core_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/coopnorge/mage/internal/core"
+	"github.com/magefile/mage/sh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFiles(t *testing.T, root string, files ...string) {
+	t.Helper()
+	for _, file := range files {
+		require.NoError(t, os.MkdirAll(filepath.Join(root, filepath.Dir(file)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(root, file), []byte(file), 0o644))
+	}
+}
+
+func TestRepoIndex(t *testing.T) {
+	t.Run("Should walk directories outside of git repositories", func(t *testing.T) {
+		root := t.TempDir()
+		writeFiles(t, root, "app/go.mod", "app/main.go", "b/a/main.tf", "b-c/main.tf", ".git/HEAD")
+
+		index, err := core.RepoIndex(root)
+		require.NoError(t, err)
+		assert.Equal(t, core.IndexSourceWalk, index.Source)
+		assert.Equal(t, []string{".", "app", "b", "b/a", "b-c"}, index.Dirs())
+		files, ok := index.Files("app")
+		assert.True(t, ok)
+		assert.Equal(t, []string{"go.mod", "main.go"}, files)
+
+		again, err := core.RepoIndex(root)
+		require.NoError(t, err)
+		assert.Same(t, index, again)
+	})
+
+	t.Run("Should list the files in the git index", func(t *testing.T) {
+		root := t.TempDir()
+		writeFiles(t, root, "app/go.mod", "old/main.tf", "new/main.tf", "untracked/main.tf", "var/output/go.mod", "node_modules/pkg/go.mod")
+		require.NoError(t, os.WriteFile(filepath.Join(root, ".gitignore"), []byte("/var/\nnode_modules/\n"), 0o644))
+		for _, command := range []string{
+			"git init --quiet",
+			"git add .gitignore app/go.mod old/main.tf new/main.tf",
+		} {
+			cmd := strings.Fields(command)
+			require.NoError(t, sh.Run(cmd[0], append([]string{"-C", root}, cmd[1:]...)...))
+		}
+		require.NoError(t, os.RemoveAll(filepath.Join(root, "old")))
+
+		index, err := core.RepoIndex(root)
+		require.NoError(t, err)
+		assert.Equal(t, core.IndexSourceGit, index.Source)
+		assert.Equal(t, []string{".", "app", "new"}, index.Dirs())
+		_, ok := index.Files("var/output")
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,172 @@
+package devtool
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+
+	"github.com/coopnorge/mage/internal/core"
+	"github.com/hashicorp/go-version"
+	"github.com/magefile/mage/sh"
+)
+
+// Cosign holds the devtool for cosign
+type Cosign struct{}
+
+// CosignDockerfile the content of cosign.Dockerfile
+//
+//go:embed cosign/cosign.Dockerfile
+var CosignDockerfile string
+
+const cosignVersion = "2.5.0"
+
+// cosignPassthroughEnv are passed to cosign in docker when they are set: the
+// password of the signing key and the OIDC token request of GitHub Actions
+// used for keyless signing
+var cosignPassthroughEnv = []string{
+	"COSIGN_PASSWORD",
+	"ACTIONS_ID_TOKEN_REQUEST_URL",
+	"ACTIONS_ID_TOKEN_REQUEST_TOKEN",
+}
+
+// Run runs the cosign devtool. Paths in the arguments must be relative to the
+// root of the repository.
+func (cosign Cosign) Run(env map[string]string, args ...string) error {
+	if !isCommandAvailable("cosign") {
+		fmt.Println("cosign binary not found. Use 'brew install cosign' to install. Falling back to running the docker version")
+		return cosign.runInDocker(env, args...)
+	}
+
+	err := cosign.versionOK()
+	if err != nil {
+		fmt.Printf("cosign does not meet version constraints. Falling back to docker version\n error: %s\n", err)
+		return cosign.runInDocker(env, args...)
+	}
+
+	fmt.Println("Using native cosign")
+	return sh.RunWithV(env, "cosign", args...)
+}
+
+func (cosign Cosign) versionOK() error {
+	// example {"gitVersion": "v2.5.0", ...}
+	out, err := sh.Output("cosign", "version", "--json")
+	if err != nil {
+		return err
+	}
+	var info struct {
+		GitVersion string `json:"gitVersion"`
+	}
+	err = json.Unmarshal([]byte(out), &info)
+	if err != nil {
+		return err
+	}
+	current, err := version.NewVersion(info.GitVersion)
+	if err != nil {
+		return err
+	}
+	devtool, err := version.NewVersion(cosignVersion)
+	if err != nil {
+		return err
+	}
+	// signatures and attestations are compatible within a major version
+	constraintString := fmt.Sprintf(">= %s.0, < %s.0", strconv.Itoa(devtool.Segments()[0]), strconv.Itoa(devtool.Segments()[0]+1))
+	constraint, err := version.NewConstraint(constraintString)
+	if err != nil {
+		return err
+	}
+	if !constraint.Check(current) {
+		return fmt.Errorf("version found %s does not match constraint %s", current.Original(), constraint.String())
+	}
+	return nil
+}
+
+func (cosign Cosign) runInDocker(env map[string]string, args ...string) error {
+	image, err := cosign.buildImage()
+	if err != nil {
+		return err
+	}
+
+	path, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	dockerArgs := []string{
+		"--volume", fmt.Sprintf("%s:/app", path), // Mount the source code
+		"--workdir", "/app",
+		// The registry may be on localhost
+		"--network", "host",
+	}
+
+	// Use the credentials of docker login for the registries
+	home, err := os.UserHomeDir()
+	if err == nil {
+		dockerConfig := filepath.Join(home, ".docker", "config.json")
+		if _, err := os.Stat(dockerConfig); err == nil {
+			dockerArgs = append(dockerArgs, "--volume", fmt.Sprintf("%s:/root/.docker/config.json:ro", dockerConfig))
+		}
+	}
+
+	if env == nil {
+		env = map[string]string{}
+	}
+	for _, name := range cosignPassthroughEnv {
+		if value, ok := os.LookupEnv(name); ok {
+			if _, exists := env[name]; !exists {
+				env[name] = value
+			}
+		}
+	}
+
+	for k := range env {
+		// The values are passed in the environment of docker
+		dockerArgs = append(dockerArgs, "--env", k)
+	}
+
+	runArgs := []string{
+		"run",
+		"--rm",
+	}
+	runArgs = append(runArgs, dockerArgs...)
+	runArgs = append(runArgs, image)
+	runArgs = append(runArgs, args...)
+
+	return sh.RunWithV(env, "docker", runArgs...)
+}
+
+func (cosign Cosign) buildImage() (string, error) {
+	imageName := fmt.Sprintf("%s:%s", "cosign", cosignVersion)
+
+	// use cached if locally available
+	out, err := sh.Output("docker", "inspect", imageName, "--format", `{{.Architecture}}`)
+	if out == runtime.GOARCH && err == nil {
+		return imageName, nil
+	}
+
+	file, cleanup, err := core.WriteTempFile(core.OutputDir, fmt.Sprintf("%s.Dockerfile", "cosign"), CosignDockerfile)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	path, cleanup, err := core.MkdirTemp()
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	return imageName, sh.Run(
+		"docker", "buildx", "build",
+		"--platform", fmt.Sprintf("linux/%s", runtime.GOARCH),
+		"-f", file,
+		"-t", imageName,
+		"--load",
+		"--build-arg", fmt.Sprintf("%s=%s", "COSIGN_VERSION", cosignVersion),
+		"--build-arg", fmt.Sprintf("%s=%s", "TARGETARCH", runtime.GOARCH),
+		path,
+	)
+}
@@ -22,6 +22,19 @@ import (
 //go:embed tools.Dockerfile
 var ToolsDockerfile string
 
+// EmbeddedDockerfiles returns the embedded Dockerfiles of the devtools by
+// their path in this package
+func EmbeddedDockerfiles() map[string]string {
+	return map[string]string{
+		"tools.Dockerfile":                        ToolsDockerfile,
+		"catalog-info/validate-entity.Dockerfile": CatalogInfoDockerfile,
+		"cosign/cosign.Dockerfile":                CosignDockerfile,
+		"dyff/dyff.Dockerfile":                    DyffDockerfile,
+		"opa/opa.Dockerfile":                      OpaDockerfile,
+		"policy-bot/policy-bot.Dockerfile":        PolicyBotConfigCheckDocker,
+	}
+}
+
 // GetImageName returns the name of a devtools OCI image
 func GetImageName(target string) (string, error) {
 	repository := "unknown-coopnorge"
@@ -66,7 +79,11 @@ func Build(tool, dockerfile string) error {
 	// This is a bit hacky to use the local go binary instead of the container.
 	// We don't need to build a dependency here
 	// this is used for running the integration tests on targets.
-	if os.Getenv("GO_RUNTIME") == "local" && tool == "golang" {
+	config, err := core.CurrentConfig()
+	if err != nil {
+		return err
+	}
+	if config.Go.Runtime == "local" && tool == "golang" {
 		return nil
 	}
 
@@ -164,6 +181,26 @@ func getTool(dockerfile string, tool string) (*dockerDevTool, error) {
 	return &devtool, fmt.Errorf("unable to find devtool %s", tool)
 }
 
+// imageWithVersion returns the image reference of the devtool for the
+// requested version. The pinned image is returned when the version is empty
+// or equal to the pinned version.
+func (d dockerDevTool) imageWithVersion(v string) string {
+	if v == "" || strings.TrimPrefix(v, "v") == strings.TrimPrefix(d.version, "v") {
+		return d.image
+	}
+	return fmt.Sprintf("%s:%s", d.registry, v)
+}
+
+// PinnedVersion returns the version of a devtool as pinned in
+// tools.Dockerfile
+func PinnedVersion(tool string) (string, error) {
+	devtool, err := getTool(ToolsDockerfile, tool)
+	if err != nil {
+		return "", err
+	}
+	return devtool.version, nil
+}
+
 // devtoolOutput represents the output of a devtool to stdout and stderr
 type devtoolOutput struct {
 	// StdOut is the stdout stream to the console
@@ -69,17 +69,55 @@ func (g Go) runNative(env map[string]string, args ...string) error {
 	return err
 }
 
+// Output runs the Go devtool like [Go.Run] and returns the standard output,
+// the standard error is passed through. Paths in the output are in the
+// container when Go runs in docker, the working directory is mounted at
+// [GoDockerWorkdir].
+func (g Go) Output(env map[string]string, args ...string) (string, error) {
+	if !isCommandAvailable("go") || g.versionOK() != nil {
+		fmt.Fprintln(os.Stderr, "Native go not found or does not meet version constraints. Falling back to docker version")
+		runArgs, err := g.dockerRunArgs(env, args...)
+		if err != nil {
+			return "", err
+		}
+		return sh.OutputWith(env, "docker", runArgs...)
+	}
+	return sh.OutputWith(env, "go", args...)
+}
+
+// GoDockerWorkdir is the working directory of Go when it runs in docker
+const GoDockerWorkdir = "/app"
+
 // DevtoolGo runs the devtool for Go
 func (g Go) runInDocker(env map[string]string, args ...string) error {
-	devtool, err := getTool(ToolsDockerfile, "golang")
+	runArgs, err := g.dockerRunArgs(env, args...)
 	if err != nil {
 		return err
 	}
 
-	path, err := os.Getwd()
+	if core.Verbose() {
+		return sh.RunWith(env, "docker", runArgs...)
+	}
+	out, err := sh.OutputWith(env, "docker", runArgs...)
 	if err != nil {
+		fmt.Println(out)
 		return err
 	}
+	return err
+}
+
+// dockerRunArgs returns the arguments of docker to run Go with args in the
+// devtool container
+func (g Go) dockerRunArgs(env map[string]string, args ...string) ([]string, error) {
+	devtool, err := getTool(ToolsDockerfile, "golang")
+	if err != nil {
+		return nil, err
+	}
+
+	path, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
 
 	goModCache, err := sh.Output("go", "env", "GOMODCACHE")
 	if err != nil {
@@ -95,10 +133,10 @@ func (g Go) runInDocker(env map[string]string, args ...string) error {
 		"--volume", "$HOME/.cache:/root/.cache", // Mount caches, such as linter cache, Go build cache, etc.
 		"--volume", "$HOME/.gitconfig:/root/.gitconfig", // Mount Git config, for access to private repos
 		"--volume", "$HOME/.ssh:/root/.ssh", // Mount SSH config, for access to private repos
-		"--volume", fmt.Sprintf("%s:/app", path), // Mount the source code
+		"--volume", fmt.Sprintf("%s:%s", path, GoDockerWorkdir), // Mount the source code
 		"--env", "TESTCONTAINERS_HOST_OVERRIDE=host.docker.internal", // For testcontainers to work when running with docker-in-docker
 		"--add-host", "host.docker.internal:host-gateway", // For testcontainers to work when running with docker-in-docker
-		"--workdir", "/app",
+		"--workdir", GoDockerWorkdir,
 	}
 
 	if env == nil {
@@ -116,14 +154,5 @@ func (g Go) runInDocker(env map[string]string, args ...string) error {
 	runArgs = append(runArgs, devtool.image)
 	runArgs = append(runArgs, "go")
 	runArgs = append(runArgs, args...)
-
-	if core.Verbose() {
-		return sh.RunWith(env, "docker", runArgs...)
-	}
-	out, err := sh.OutputWith(env, "docker", runArgs...)
-	if err != nil {
-		fmt.Println(out)
-		return err
-	}
-	return err
+	return runArgs, nil
 }
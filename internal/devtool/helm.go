@@ -2,7 +2,6 @@ package devtool
 
 import (
 	"fmt"
-	"os"
 	"strconv"
 	"strings"
 
@@ -17,7 +16,11 @@ type Helm struct{}
 // Run runs the helm devtool. It returns stdout, stderr and error. If verbose
 // is enable on mage it will also stream stdout to the console
 func (helm Helm) Run(env map[string]string, workdir string, args ...string) (string, string, error) {
-	if val, found := os.LookupEnv("HELM_IN_DOCKER"); found && val == "1" {
+	config, err := core.CurrentConfig()
+	if err != nil {
+		return "", "", err
+	}
+	if config.Helm.InDocker {
 		return helm.runInDocker(env, workdir, args...)
 	}
 	if !isCommandAvailable("helm") {
@@ -25,7 +28,7 @@ func (helm Helm) Run(env map[string]string, workdir string, args ...string) (str
 		return helm.runInDocker(env, workdir, args...)
 	}
 
-	err := helm.versionOK()
+	err = helm.versionOK()
 	if err != nil {
 		fmt.Printf("helm does not meet version constraints. Falling back to docker verion\n error: %s\n", err)
 		return helm.runInDocker(env, workdir, args...)
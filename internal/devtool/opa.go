@@ -0,0 +1,156 @@
+package devtool
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/coopnorge/mage/internal/core"
+	"github.com/hashicorp/go-version"
+	"github.com/magefile/mage/sh"
+)
+
+// Opa holds the devtool for the Open Policy Agent
+type Opa struct{}
+
+// OpaDockerfile the content of opa.Dockerfile
+//
+//go:embed opa/opa.Dockerfile
+var OpaDockerfile string
+
+const opaVersion = "1.4.2"
+
+// Run runs the opa devtool. The workdir is relative to the root of the
+// repository.
+func (opa Opa) Run(env map[string]string, workdir string, args ...string) (string, string, error) {
+	config, err := core.CurrentConfig()
+	if err != nil {
+		return "", "", err
+	}
+	if config.OPA.InDocker {
+		return opa.runInDocker(env, workdir, args...)
+	}
+
+	if !isCommandAvailable("opa") {
+		fmt.Println("opa binary not found. Use 'brew install opa' to install. Falling back to running the docker version")
+		return opa.runInDocker(env, workdir, args...)
+	}
+
+	err = opa.versionOK()
+	if err != nil {
+		fmt.Printf("opa does not meet version constraints. Falling back to docker version\n error: %s\n", err)
+		return opa.runInDocker(env, workdir, args...)
+	}
+
+	fmt.Println("Using native opa")
+	return opa.runNative(env, workdir, args...)
+}
+
+func (opa Opa) versionOK() error {
+	// example Version: 1.4.2
+	out, err := sh.Output("opa", "version")
+	if err != nil {
+		return err
+	}
+	firstLine := strings.SplitN(out, "\n", 2)[0]
+	current, err := version.NewVersion(strings.TrimSpace(strings.TrimPrefix(firstLine, "Version:")))
+	if err != nil {
+		return err
+	}
+	devtool, err := version.NewVersion(opaVersion)
+	if err != nil {
+		return err
+	}
+	// policies are written in Rego v1, require the same major version
+	constraintString := fmt.Sprintf(">= %s.0, < %s.0", strconv.Itoa(devtool.Segments()[0]), strconv.Itoa(devtool.Segments()[0]+1))
+	constraint, err := version.NewConstraint(constraintString)
+	if err != nil {
+		return err
+	}
+	if !constraint.Check(current) {
+		return fmt.Errorf("version found %s does not match constraint %s", current.Original(), constraint.String())
+	}
+	return nil
+}
+
+func (opa Opa) runNative(env map[string]string, workdir string, args ...string) (string, string, error) {
+	outs := setupStdOutErr(false)
+	_, err := core.ExecAt(env, outs.StdOut, outs.StdErr, workdir, "opa", args...)
+
+	return outs.printOut(), outs.printErr(), err
+}
+
+func (opa Opa) runInDocker(env map[string]string, workdir string, args ...string) (string, string, error) {
+	image, err := opa.buildImage()
+	if err != nil {
+		return "", "", err
+	}
+
+	path, err := os.Getwd()
+	if err != nil {
+		return "", "", err
+	}
+
+	dockerArgs := []string{
+		"--volume", fmt.Sprintf("%s:/app", path), // Mount the source code
+		"--workdir", filepath.Join("/app", workdir), // set workdir to where we want to run
+	}
+
+	if env == nil {
+		env = map[string]string{}
+	}
+
+	for k, v := range env {
+		dockerArgs = append(dockerArgs, "--env", fmt.Sprintf("%s=%s", k, v))
+	}
+
+	runArgs := []string{
+		"run",
+		"--rm",
+	}
+	runArgs = append(runArgs, dockerArgs...)
+	runArgs = append(runArgs, image)
+	runArgs = append(runArgs, args...)
+
+	outs := setupStdOutErr(false)
+	_, err = core.Exec(env, outs.StdOut, outs.StdErr, "docker", runArgs...)
+
+	return outs.printOut(), outs.printErr(), err
+}
+
+func (opa Opa) buildImage() (string, error) {
+	imageName := fmt.Sprintf("%s:%s", "opa", opaVersion)
+
+	// use cached if locally available
+	out, err := sh.Output("docker", "inspect", imageName, "--format", `{{.Architecture}}`)
+	if out == runtime.GOARCH && err == nil {
+		return imageName, nil
+	}
+
+	file, cleanup, err := core.WriteTempFile(core.OutputDir, fmt.Sprintf("%s.Dockerfile", "opa"), OpaDockerfile)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	path, cleanup, err := core.MkdirTemp()
+	if err != nil {
+		return "", nil
+	}
+	defer cleanup()
+
+	return imageName, sh.Run(
+		"docker", "buildx", "build",
+		"--platform", fmt.Sprintf("linux/%s", runtime.GOARCH),
+		"-f", file,
+		"-t", imageName,
+		"--load",
+		"--build-arg", fmt.Sprintf("%s=%s", "OPA_VERSION", opaVersion),
+		"--build-arg", fmt.Sprintf("%s=%s", "TARGETARCH", runtime.GOARCH),
+		path,
+	)
+}
@@ -12,8 +12,19 @@ import (
 	"github.com/magefile/mage/sh"
 )
 
+// defaultTerraformConstraint is the version constraint the native terraform
+// binary has to satisfy when the project does not require a version
+const defaultTerraformConstraint = ">= 1.3.6, < 1.6.0"
+
 // Terraform holds the devtool for terraform
-type Terraform struct{}
+type Terraform struct {
+	// Version is the tag of the terraform image used when running in Docker.
+	// When empty the version pinned in tools.Dockerfile is used.
+	Version string
+	// Constraint is the version constraint the native terraform binary has
+	// to satisfy. When empty the default constraint is used.
+	Constraint string
+}
 
 // Run runs the terraform devtool
 func (tf Terraform) Run(env map[string]string, workdir string, args ...string) (string, string, error) {
@@ -48,7 +59,10 @@ func (tf Terraform) versionOK() error {
 	}
 
 	// set constraints in the current supported terraform versions in coop
-	constraintString := ">= 1.3.6, < 1.6.0"
+	constraintString := defaultTerraformConstraint
+	if tf.Constraint != "" {
+		constraintString = tf.Constraint
+	}
 	constraint, err := version.NewConstraint(constraintString)
 	if err != nil {
 		return err
@@ -115,7 +129,7 @@ func (tf Terraform) runInDocker(env map[string]string, workdir string, args ...s
 		"--rm",
 	}
 	runArgs = append(runArgs, dockerArgs...)
-	runArgs = append(runArgs, devtool.image)
+	runArgs = append(runArgs, devtool.imageWithVersion(tf.Version))
 	runArgs = append(runArgs, args...)
 
 	// if core.Verbose() {
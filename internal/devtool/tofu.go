@@ -11,8 +11,19 @@ import (
 	"github.com/magefile/mage/sh"
 )
 
+// defaultTofuConstraint is the version constraint the native tofu binary has
+// to satisfy when the project does not require a version
+const defaultTofuConstraint = ">= 1.6.3"
+
 // Tofu holds the devtool for OpenTofu
-type Tofu struct{}
+type Tofu struct {
+	// Version is the tag of the OpenTofu image used when running in Docker.
+	// When empty the version pinned in tools.Dockerfile is used.
+	Version string
+	// Constraint is the version constraint the native tofu binary has to
+	// satisfy. When empty the default constraint is used.
+	Constraint string
+}
 
 // Run runs the OpenTofu devtool
 func (t Tofu) Run(env map[string]string, workdir string, args ...string) (string, string, error) {
@@ -41,7 +52,10 @@ func (t Tofu) versionOK() error {
 		return err
 	}
 
-	constraintString := ">= 1.6.3"
+	constraintString := defaultTofuConstraint
+	if t.Constraint != "" {
+		constraintString = t.Constraint
+	}
 	constraint, err := version.NewConstraint(constraintString)
 	if err != nil {
 		return err
@@ -91,7 +105,7 @@ func (t Tofu) runInDocker(env map[string]string, workdir string, args ...string)
 		"--rm",
 	}
 	runArgs = append(runArgs, dockerArgs...)
-	runArgs = append(runArgs, devtool.image)
+	runArgs = append(runArgs, devtool.imageWithVersion(t.Version))
 	runArgs = append(runArgs, args...)
 
 	outs := setupStdOutErr(false)
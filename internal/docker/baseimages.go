@@ -0,0 +1,197 @@
+package docker
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// dockerHub is the registry of images without a registry in their name
+const dockerHub = "docker.io"
+
+// patchVersion matches tags like 3.24.1, v1.20.0 or 1.26.5-alpine3.22
+var patchVersion = regexp.MustCompile(`^(v?)(\d+)\.(\d+)\.(\d+)(-.+)?$`)
+
+// ImageReference is a reference to an image, like
+// docker.io/library/alpine:3.24.1@sha256:<digest>
+type ImageReference struct {
+	// Host is the registry of the image, docker.io when the name has no
+	// registry
+	Host string
+	// Repository is the repository in the registry, library/alpine for
+	// alpine on Docker Hub
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// ParseImageReference parses an image reference with an optional registry,
+// tag and digest
+func ParseImageReference(image string) (ImageReference, error) {
+	reference := ImageReference{}
+	name, digest, _ := strings.Cut(image, "@")
+	reference.Digest = digest
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, reference.Tag = name[:i], name[i+1:]
+	}
+	host, repository, ok := strings.Cut(name, "/")
+	if !ok || !strings.ContainsAny(host, ".:") && host != "localhost" {
+		host, repository = dockerHub, name
+	}
+	if host == dockerHub && !strings.Contains(repository, "/") {
+		repository = "library/" + repository
+	}
+	if repository == "" || strings.ToLower(repository) != repository {
+		return ImageReference{}, fmt.Errorf("invalid image reference %q", image)
+	}
+	reference.Host, reference.Repository = host, repository
+	return reference, nil
+}
+
+// PinnedImage is a base image pinned to a tag and a digest in a Dockerfile
+type PinnedImage struct {
+	// Source is the Dockerfile of the image
+	Source string
+	// Line is the line of the FROM instruction
+	Line int
+	// Image is the image as written in the Dockerfile
+	Image     string
+	Reference ImageReference
+}
+
+// FindPinnedImages returns the base images of the Dockerfile that are pinned
+// to a tag and a digest, see [RuleUnpinnedImage]. Images without a tag are
+// skipped as there is nothing to compare the digest with.
+func FindPinnedImages(source, dockerfileContent string) ([]PinnedImage, error) {
+	pins := []PinnedImage{}
+	for _, instruction := range ParseDockerfile(dockerfileContent) {
+		if instruction.Command != "FROM" {
+			continue
+		}
+		image, _ := fromImage(instruction.Args)
+		if strings.Contains(image, "$") || !strings.Contains(image, "@") {
+			continue
+		}
+		reference, err := ParseImageReference(image)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", source, instruction.Line, err)
+		}
+		if reference.Tag == "" {
+			continue
+		}
+		pins = append(pins, PinnedImage{Source: source, Line: instruction.Line, Image: image, Reference: reference})
+	}
+	return pins, nil
+}
+
+// BaseImageUpdate is a newer digest or a newer patch tag of a pinned image
+type BaseImageUpdate struct {
+	Pin PinnedImage
+	// Tag is the newer patch tag, or the tag of the pinned image when only
+	// its digest changed
+	Tag    string
+	Digest string
+}
+
+// Image returns the image of the pin with the tag and the digest of the
+// update
+func (u BaseImageUpdate) Image() string {
+	name, _, _ := strings.Cut(u.Pin.Image, "@")
+	name = strings.TrimSuffix(name, ":"+u.Pin.Reference.Tag)
+	return fmt.Sprintf("%s:%s@%s", name, u.Tag, u.Digest)
+}
+
+// BaseImageFailure is a pinned image that could not be checked
+type BaseImageFailure struct {
+	Pin PinnedImage
+	Err error
+}
+
+// CheckBaseImages compares the pinned images with their registries and
+// returns the updates. The digest of the newest patch tag with the same
+// major and minor version, prefix and suffix is used when there is one,
+// otherwise the current digest of the tag. registryFor returns the registry
+// of a host, like [NewRegistryForHost]. Pins whose registry fails are
+// returned as failures and the other pins are still checked.
+func CheckBaseImages(pins []PinnedImage, registryFor func(host string) *Registry) ([]BaseImageUpdate, []BaseImageFailure) {
+	registries := map[string]*Registry{}
+	tags := map[string][]string{}
+	digests := map[string]string{}
+	// errs are the failed requests by repository or by repository and tag
+	errs := map[string]error{}
+	updates := []BaseImageUpdate{}
+	failures := []BaseImageFailure{}
+	for _, pin := range pins {
+		reference := pin.Reference
+		registry, ok := registries[reference.Host]
+		if !ok {
+			registry = registryFor(reference.Host)
+			registries[reference.Host] = registry
+		}
+		repository := reference.Host + "/" + reference.Repository
+
+		tag := reference.Tag
+		if patchVersion.MatchString(tag) {
+			_, ok := tags[repository]
+			if !ok && errs[repository] == nil {
+				tags[repository], errs[repository] = registry.Tags(reference.Repository)
+			}
+			if errs[repository] != nil {
+				failures = append(failures, BaseImageFailure{Pin: pin, Err: errs[repository]})
+				continue
+			}
+			tag = newestPatch(tag, tags[repository])
+		}
+
+		key := repository + ":" + tag
+		_, ok = digests[key]
+		if !ok && errs[key] == nil {
+			digests[key], errs[key] = registry.ManifestDigest(reference.Repository, tag)
+		}
+		if errs[key] != nil {
+			failures = append(failures, BaseImageFailure{Pin: pin, Err: errs[key]})
+			continue
+		}
+		if tag != reference.Tag || digests[key] != reference.Digest {
+			updates = append(updates, BaseImageUpdate{Pin: pin, Tag: tag, Digest: digests[key]})
+		}
+	}
+	return updates, failures
+}
+
+// newestPatch returns the tag with the highest patch version of the same
+// major and minor version, prefix and suffix as the tag
+func newestPatch(tag string, tags []string) string {
+	current := patchVersion.FindStringSubmatch(tag)
+	newest, newestPatch := tag, patchNumber(current)
+	for _, candidate := range tags {
+		match := patchVersion.FindStringSubmatch(candidate)
+		if match == nil || match[1] != current[1] || match[2] != current[2] || match[3] != current[3] || match[5] != current[5] {
+			continue
+		}
+		if patch := patchNumber(match); patch > newestPatch {
+			newest, newestPatch = candidate, patch
+		}
+	}
+	return newest
+}
+
+func patchNumber(match []string) int {
+	patch, _ := strconv.Atoi(match[4])
+	return patch
+}
+
+// UpdateDockerfile returns the content of the Dockerfile with the images of
+// the updates of its pins replaced
+func UpdateDockerfile(dockerfileContent string, updates []BaseImageUpdate) string {
+	lines := strings.Split(dockerfileContent, "\n")
+	for _, update := range updates {
+		i := update.Pin.Line - 1
+		if i < 0 || i >= len(lines) {
+			continue
+		}
+		lines[i] = strings.Replace(lines[i], update.Pin.Image, update.Image(), 1)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,195 @@
+package docker_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/coopnorge/mage/internal/docker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	oldDigest    = "sha256:28bd5fe8b56d1bd048e5babf5b10710ebe0bae67db86916198a6eec434943f8b"
+	alpine3241   = "sha256:94c49256e2dec5add85c669fe7498aa93e188ebffb6c0c8ec4fe85105a19abdb"
+	alpine3242   = "sha256:3aff6657219a4d9c14e27fb1d8976c49c29fddb70ba835014f477e1c70636647"
+	node24Slim   = "sha256:b31e7a42fdf8b8aa5f5ed477c72d694301273f1069c5a2f71d53c6482e99a2fc"
+	scuttle1115  = "sha256:1b3fb35aa13dd80b30ecceee9f913156eace6cf7656129a99a2dfad5010f68a4"
+	registryAuth = "Bearer anonymous-token"
+)
+
+// tokenRegistry serves the tags and the manifest digests by repository and
+// tag like Docker Hub, requests need an anonymous bearer token and tags are
+// paginated by two
+func tokenRegistry(t *testing.T, manifests map[string]map[string]string) *docker.Registry {
+	t.Helper()
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			assert.Equal(t, "registry.test", r.URL.Query().Get("service"))
+			_ = json.NewEncoder(w).Encode(map[string]string{"token": strings.TrimPrefix(registryAuth, "Bearer ")})
+			return
+		}
+		path := strings.TrimPrefix(r.URL.Path, "/v2/")
+		repository, _, _ := strings.Cut(strings.Replace(path, "/tags/list", "/manifests/", 1), "/manifests/")
+		if r.Header.Get("Authorization") != registryAuth {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry.test",scope="repository:%s:pull"`, server.URL, repository))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if strings.HasSuffix(path, "/tags/list") {
+			tags := []string{}
+			for tag := range manifests[repository] {
+				tags = append(tags, tag)
+			}
+			slices.Sort(tags)
+			last, _ := strconv.Atoi(r.URL.Query().Get("last"))
+			end := min(last+2, len(tags))
+			if end < len(tags) {
+				w.Header().Set("Link", fmt.Sprintf(`</v2/%s/tags/list?last=%d&n=2>; rel="next"`, repository, end))
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"name": repository, "tags": tags[last:end]})
+			return
+		}
+		_, tag, _ := strings.Cut(path, "/manifests/")
+		digest, found := manifests[repository][tag]
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", digest)
+	}))
+	t.Cleanup(server.Close)
+	return docker.NewRegistry(server.URL)
+}
+
+func TestParseImageReference(t *testing.T) {
+	tests := []struct {
+		image  string
+		want   docker.ImageReference
+		errMsg string
+	}{
+		{
+			image: "alpine:3.24.1@" + alpine3241,
+			want:  docker.ImageReference{Host: "docker.io", Repository: "library/alpine", Tag: "3.24.1", Digest: alpine3241},
+		},
+		{
+			image: "docker.io/kvij/scuttle:1.1.15@" + scuttle1115,
+			want:  docker.ImageReference{Host: "docker.io", Repository: "kvij/scuttle", Tag: "1.1.15", Digest: scuttle1115},
+		},
+		{
+			image: "golangci/golangci-lint:v2.12.2",
+			want:  docker.ImageReference{Host: "docker.io", Repository: "golangci/golangci-lint", Tag: "v2.12.2"},
+		},
+		{
+			image: "ghcr.io/terraform-linters/tflint@" + alpine3241,
+			want:  docker.ImageReference{Host: "ghcr.io", Repository: "terraform-linters/tflint", Digest: alpine3241},
+		},
+		{
+			image: "localhost:5000/coopnorge/app1:latest",
+			want:  docker.ImageReference{Host: "localhost:5000", Repository: "coopnorge/app1", Tag: "latest"},
+		},
+		{
+			image:  "docker.io/Library/Alpine:3.24.1",
+			errMsg: `invalid image reference "docker.io/Library/Alpine:3.24.1"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			got, err := docker.ParseImageReference(tt.image)
+			if tt.errMsg != "" {
+				assert.EqualError(t, err, tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCheckBaseImages(t *testing.T) {
+	registry := tokenRegistry(t, map[string]map[string]string{
+		"library/alpine": {
+			"3.24.1":         alpine3241,
+			"3.24.2":         alpine3242,
+			"3.24.10-rc1":    oldDigest,
+			"3.25.0":         oldDigest,
+			"latest":         oldDigest,
+			"3.24.3-busybox": oldDigest,
+		},
+		"library/node": {
+			"24-slim": node24Slim,
+		},
+		"kvij/scuttle": {
+			"1.1.15": scuttle1115,
+		},
+	})
+	dockerfile := fmt.Sprintf(`FROM docker.io/kvij/scuttle:1.1.15@%s AS scuttle
+FROM alpine:3.24.1@%s AS downloader
+FROM node:24-slim@%s AS validator
+FROM docker.io/library/node:24-slim@%s
+FROM downloader
+FROM alpine@%s
+FROM ${BASE}`, scuttle1115, alpine3241, oldDigest, node24Slim, oldDigest)
+	pins, err := docker.FindPinnedImages("Dockerfile", dockerfile)
+	require.NoError(t, err)
+	require.Len(t, pins, 4)
+
+	updates, failures := docker.CheckBaseImages(pins, func(host string) *docker.Registry {
+		assert.Equal(t, "docker.io", host)
+		return registry
+	})
+	require.Empty(t, failures)
+	require.Len(t, updates, 2)
+	assert.Equal(t, "alpine:3.24.2@"+alpine3242, updates[0].Image())
+	assert.Equal(t, 2, updates[0].Pin.Line)
+	assert.Equal(t, "node:24-slim@"+node24Slim, updates[1].Image())
+	assert.Equal(t, 3, updates[1].Pin.Line)
+
+	want := fmt.Sprintf(`FROM docker.io/kvij/scuttle:1.1.15@%s AS scuttle
+FROM alpine:3.24.2@%s AS downloader
+FROM node:24-slim@%s AS validator
+FROM docker.io/library/node:24-slim@%s
+FROM downloader
+FROM alpine@%s
+FROM ${BASE}`, scuttle1115, alpine3242, node24Slim, node24Slim, oldDigest)
+	assert.Equal(t, want, docker.UpdateDockerfile(dockerfile, updates))
+}
+
+func TestCheckBaseImagesFailures(t *testing.T) {
+	registry := tokenRegistry(t, map[string]map[string]string{
+		"library/alpine": {
+			"3.24.1": alpine3241,
+			"3.24.2": alpine3242,
+		},
+	})
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(failing.Close)
+	dockerfile := fmt.Sprintf(`FROM node:24-slim@%s AS validator
+FROM ghcr.io/coopnorge/tool:1.2.3@%s AS tool
+FROM alpine:3.24.1@%s`, node24Slim, oldDigest, alpine3241)
+	pins, err := docker.FindPinnedImages("Dockerfile", dockerfile)
+	require.NoError(t, err)
+
+	updates, failures := docker.CheckBaseImages(pins, func(host string) *docker.Registry {
+		if host == "ghcr.io" {
+			return docker.NewRegistry(failing.URL)
+		}
+		return registry
+	})
+	require.Len(t, updates, 1)
+	assert.Equal(t, "alpine:3.24.2@"+alpine3242, updates[0].Image())
+	require.Len(t, failures, 2)
+	assert.Equal(t, 1, failures[0].Pin.Line)
+	assert.ErrorContains(t, failures[0].Err, "manifest library/node:24-slim: 404 Not Found")
+	assert.Equal(t, 2, failures[1].Pin.Line)
+	assert.ErrorContains(t, failures[1].Err, "500 Internal Server Error")
+}
@@ -1,6 +1,7 @@
 package docker
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -16,11 +17,6 @@ import (
 	"github.com/magefile/mage/sh"
 )
 
-const (
-	imageBaseEnv          = "OCI_IMAGE_BASE"
-	imageNameBaseFallback = "ocreg.invalid/coopnorge"
-)
-
 // Validate the content of a Dockerfile
 func Validate(dockerfileContent string) error {
 	dockerfilePath, cleanup, err := core.WriteTempFile("./var", "Dockerfile", dockerfileContent)
@@ -40,10 +36,16 @@ func Validate(dockerfileContent string) error {
 
 // BuildAndPush an OCI image for the provided platforms. Setting push to true
 // will push the images to the registries. When push is true images are not
-// tagged with latest.
+// tagged with latest. The image is tagged with the [Tags], they are recorded
+// in the metadata file with the images of the platforms from the OCI tarball,
+// the size and the duration of the build. Pushed images are signed when
+// docker.sign is true, see [Sign].
 func BuildAndPush(dockerfileContent, platforms, image, dockerContext, imagePath, metadatafile, app, binary string, shouldPush bool) error {
-	versionTag := getVersionTag()
-	versionTaggedImage := fmt.Sprintf("%s:%s", image, versionTag)
+	startedOn := time.Now()
+	tags, err := Tags()
+	if err != nil {
+		return err
+	}
 	latestImage := fmt.Sprintf("%s:latest", image)
 
 	repoURL, err := git.RepoURL()
@@ -80,7 +82,9 @@ func BuildAndPush(dockerfileContent, platforms, image, dockerContext, imagePath,
 		"--platform", platforms,
 		"--output", fmt.Sprintf("type=image,push=%v", shouldPush),
 		"--output", fmt.Sprintf("type=oci,dest=%s", imagePath),
-		"-t", versionTaggedImage,
+	}
+	for _, tag := range tags {
+		args = append(args, "-t", fmt.Sprintf("%s:%s", image, tag))
 	}
 
 	if !shouldPush {
@@ -95,7 +99,140 @@ func BuildAndPush(dockerfileContent, platforms, image, dockerContext, imagePath,
 		dockerContext,
 	)
 
-	return sh.RunV("docker", args...)
+	err = sh.RunV("docker", args...)
+	if err != nil {
+		return err
+	}
+	buildDuration := time.Since(startedOn)
+	archive, err := ReadOCIArchive(imagePath)
+	if err != nil {
+		return err
+	}
+	platformImages, err := archive.Platforms()
+	if err != nil {
+		return err
+	}
+	err = addMetadata(metadatafile, map[string]any{
+		tagsKey:          tags,
+		platformsKey:     platformImages,
+		sizeKey:          Size(platformImages),
+		buildDurationKey: buildDuration.Seconds(),
+	})
+	if err != nil {
+		return err
+	}
+
+	config, err := core.CurrentConfig()
+	if err != nil {
+		return err
+	}
+	if !shouldPush || !config.Docker.Sign {
+		return nil
+	}
+	metadata, err := ParseMetadata(metadatafile)
+	if err != nil {
+		return err
+	}
+	if metadata.Digest == "" {
+		return fmt.Errorf("digest of %s not found in: %s", image, metadatafile)
+	}
+	return Sign(fmt.Sprintf("%s@%s", image, metadata.Digest), NewProvenance(repoURL, gitSHA256, app, binary, startedOn))
+}
+
+const (
+	// skippedKey marks the metadata of a binary whose image build was
+	// skipped
+	skippedKey = "mage.skipped"
+	// tagsKey are the tags of the image in the metadata, the first is the
+	// primary tag
+	tagsKey = "mage.tags"
+	// platformsKey are the images of the platforms in the metadata, see
+	// [PlatformImage]
+	platformsKey = "mage.platforms"
+	// sizeKey is the size of the image in bytes in the metadata
+	sizeKey = "mage.size"
+	// buildDurationKey is the duration of the build in seconds in the
+	// metadata
+	buildDurationKey = "mage.build_duration_seconds"
+	// smokeTestKey is the result of the smoke test in the metadata, see
+	// [SmokeTestResult]
+	smokeTestKey = "mage.smoke_test"
+	// digestKey is the digest of the image written by buildx
+	digestKey = "containerimage.digest"
+)
+
+// recordedMetadata are the values of the metadata file that are not parsed
+// from the image name
+type recordedMetadata struct {
+	Tags                 []string                 `json:"mage.tags"`
+	Skipped              bool                     `json:"mage.skipped"`
+	Platforms            map[string]PlatformImage `json:"mage.platforms"`
+	Size                 int64                    `json:"mage.size"`
+	BuildDurationSeconds float64                  `json:"mage.build_duration_seconds"`
+	SmokeTest            *SmokeTestResult         `json:"mage.smoke_test"`
+	Digest               string                   `json:"containerimage.digest"`
+}
+
+// addMetadata adds the values to the metadata file written by buildx
+func addMetadata(metadatafile string, values map[string]any) error {
+	content, err := os.ReadFile(metadatafile)
+	if err != nil {
+		return err
+	}
+	data := map[string]any{}
+	err = json.Unmarshal(content, &data)
+	if err != nil {
+		return err
+	}
+	for key, value := range values {
+		data[key] = value
+	}
+	content, err = json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(metadatafile, content, 0o644)
+}
+
+// WriteSkippedMetadata writes the metadata file of a binary whose image
+// build was skipped because it did not change. The metadata references the
+// previous image and its digest, so the images of all binaries are listed by
+// [Images].
+func WriteSkippedMetadata(metadatafile, previousImage, digest string) error {
+	err := createDirForOutput(metadatafile)
+	if err != nil {
+		return err
+	}
+	_, tag := splitImageName(previousImage)
+	content, err := json.Marshal(map[string]any{
+		"image.name": previousImage,
+		skippedKey:   true,
+		tagsKey:      []string{tag},
+		digestKey:    digest,
+	})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(metadatafile, content, 0o644)
+}
+
+// ImageDigest returns the digest of the image in the registry, it returns an
+// error if the image does not exist
+func ImageDigest(image string) (string, error) {
+	var stdout bytes.Buffer
+	_, err := sh.Exec(nil, &stdout, io.Discard, "docker", "buildx", "imagetools", "inspect", image, "--format", "{{json .Manifest}}")
+	if err != nil {
+		return "", err
+	}
+	var descriptor Descriptor
+	err = json.Unmarshal(stdout.Bytes(), &descriptor)
+	if err != nil {
+		return "", err
+	}
+	if descriptor.Digest == "" {
+		return "", fmt.Errorf("digest of %s not found", image)
+	}
+	return descriptor.Digest, nil
 }
 
 // FindMetadataFiles ...
@@ -105,10 +242,27 @@ func FindMetadataFiles(base string) ([]string, error) {
 
 // Metadata ...
 type Metadata struct {
-	App       string
-	Binary    string
+	App    string
+	Binary string
+	// ImageName is the image with the primary tag
 	ImageName string
-	Tag       string
+	// Tag is the primary tag
+	Tag string
+	// Tags are all tags of the image except latest
+	Tags []string
+	// Digest is the digest of the image index or manifest
+	Digest string
+	// Platforms are the images by platform, like linux/amd64
+	Platforms map[string]PlatformImage
+	// Size is the compressed size of the image in bytes
+	Size int64
+	// BuildDuration is the duration of the build
+	BuildDuration time.Duration
+	// Skipped is true if the image was not built and ImageName is the
+	// previous image, see [WriteSkippedMetadata]
+	Skipped bool
+	// SmokeTest is the result of the smoke test, see [RecordSmokeTest]
+	SmokeTest *SmokeTestResult
 }
 
 // ParseMetadata ...
@@ -131,44 +285,91 @@ func ParseMetadata(filepath string) (Metadata, error) {
 		}
 	}()
 
-	bytes, err := io.ReadAll(file)
+	content, err := io.ReadAll(file)
 	if err != nil {
 		return Metadata{}, err
 	}
 
 	var data map[string]any
-	err = json.Unmarshal(bytes, &data)
+	err = json.Unmarshal(content, &data)
 	if err != nil {
 		return Metadata{}, err
 	}
 	if len(data) == 0 {
 		return Metadata{}, fmt.Errorf("no metadata found in: %s", filepath)
 	}
-	var imageNames []string
+	var repository string
+	var tags []string
 	for _, imageName := range strings.Split(fmt.Sprintf("%s", data["image.name"]), ",") {
-		if strings.HasSuffix(imageName, ":latest") {
+		name, tag := splitImageName(strings.TrimSpace(imageName))
+		if tag == "" || tag == "latest" {
 			continue
 		}
-		imageNames = append(imageNames, imageName)
+		if repository == "" {
+			repository = name
+		}
+		tags = append(tags, tag)
 	}
-	if len(imageNames) != 1 {
+	if repository == "" {
 		return Metadata{}, fmt.Errorf("image name not found in: %s", data["image.name"])
 	}
-	imageName := imageNames[0]
+	var recorded recordedMetadata
+	err = json.Unmarshal(content, &recorded)
+	if err != nil {
+		return Metadata{}, fmt.Errorf("%s: %w", filepath, err)
+	}
+	// The recorded tags keep the order of the tagging strategies
+	if len(recorded.Tags) > 0 {
+		tags = recorded.Tags
+	}
+	base, err := imageBase()
+	if err != nil {
+		return Metadata{}, err
+	}
 
 	return Metadata{
-		ImageName: imageName,
-		App:       getAppName(imageName),
-		Binary:    getBinaryName(imageName),
-		Tag:       getTag(imageName),
+		ImageName:     fmt.Sprintf("%s:%s", repository, tags[0]),
+		App:           getAppName(base, repository),
+		Binary:        getBinaryName(base, repository),
+		Tag:           tags[0],
+		Tags:          tags,
+		Digest:        recorded.Digest,
+		Platforms:     recorded.Platforms,
+		Size:          recorded.Size,
+		BuildDuration: time.Duration(recorded.BuildDurationSeconds * float64(time.Second)),
+		Skipped:       recorded.Skipped,
+		SmokeTest:     recorded.SmokeTest,
 	}, nil
 }
 
-type binaryImage = map[string]string
-type binaryImages = map[string]binaryImage
+// BinaryImage is the image of a binary in oci-images.json
+type BinaryImage struct {
+	// Image is the image with the primary tag
+	Image string `json:"image"`
+	// Tag is the primary tag
+	Tag string `json:"tag"`
+	// Tags are all tags separated by commas
+	Tags string `json:"tags"`
+	// Digest is the digest of the image index or manifest
+	Digest string `json:"digest,omitempty"`
+	// Reference is the image with the primary tag pinned to the digest
+	Reference string `json:"reference,omitempty"`
+	// Platforms are the images by platform, like linux/amd64
+	Platforms map[string]PlatformImage `json:"platforms,omitempty"`
+	// Size is the compressed size of the image in bytes
+	Size int64 `json:"size,omitempty"`
+	// BuildDuration is the duration of the build, like 1m30s
+	BuildDuration string `json:"build_duration,omitempty"`
+	// Skipped is true when the image was not built, see
+	// [WriteSkippedMetadata]
+	Skipped bool `json:"skipped,omitempty"`
+	// SmokeTest is the result of the smoke test of the image, see
+	// [SmokeTest]
+	SmokeTest *SmokeTestResult `json:"smoke_test,omitempty"`
+}
 
-// AppImages ...
-type AppImages = map[string]binaryImages
+// AppImages are the images by app and binary
+type AppImages = map[string]map[string]BinaryImage
 
 // Images ...
 func Images(imageDir string) (AppImages, error) {
@@ -184,51 +385,84 @@ func Images(imageDir string) (AppImages, error) {
 			return nil, err
 		}
 		if _, ok := result[metadata.App]; !ok {
-			result[metadata.App] = make(binaryImages)
+			result[metadata.App] = map[string]BinaryImage{}
 		}
-		if _, ok := result[metadata.App][metadata.Binary]; !ok {
-			result[metadata.App][metadata.Binary] = make(binaryImage)
+		image := BinaryImage{
+			Image:     metadata.ImageName,
+			Tag:       metadata.Tag,
+			Tags:      strings.Join(metadata.Tags, ","),
+			Digest:    metadata.Digest,
+			Platforms: metadata.Platforms,
+			Size:      metadata.Size,
+			Skipped:   metadata.Skipped,
+			SmokeTest: metadata.SmokeTest,
 		}
-		result[metadata.App][metadata.Binary]["tag"] = metadata.Tag
-		result[metadata.App][metadata.Binary]["image"] = metadata.ImageName
+		if metadata.Digest != "" {
+			image.Reference = fmt.Sprintf("%s@%s", metadata.ImageName, metadata.Digest)
+		}
+		if metadata.BuildDuration > 0 {
+			image.BuildDuration = metadata.BuildDuration.Round(time.Second).String()
+		}
+		result[metadata.App][metadata.Binary] = image
 	}
 	return result, nil
 }
 
+// ReadImages reads the images in oci-images.json, see [Images]
+func ReadImages(imagesFile string) (AppImages, error) {
+	content, err := os.ReadFile(imagesFile)
+	if err != nil {
+		return nil, err
+	}
+	images := AppImages{}
+	err = json.Unmarshal(content, &images)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", imagesFile, err)
+	}
+	return images, nil
+}
+
 // FullyQualifiedlImageName ...
-func FullyQualifiedlImageName(app, binary string) string {
-	return fmt.Sprintf("%s/%s/%s", imageBase(), app, binary)
+func FullyQualifiedlImageName(app, binary string) (string, error) {
+	base, err := imageBase()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/%s/%s", base, app, binary), nil
 }
 
-func imageBase() string {
-	imageBase, ok := os.LookupEnv(imageBaseEnv)
-	if !ok || imageBase == "" {
-		imageBase = imageNameBaseFallback
+// imageBase returns the registry and path prefix of the images, see
+// [core.DockerConfig]
+func imageBase() (string, error) {
+	config, err := core.CurrentConfig()
+	if err != nil {
+		return "", err
 	}
-	return imageBase
+	return config.Docker.OCIImageBase, nil
 }
 
-func getAppName(imageName string) string {
-	imageName = strings.TrimPrefix(imageName, fmt.Sprintf("%s/", imageBase()))
-	imageName = strings.Split(imageName, ":")[0]
-	return strings.Split(imageName, "/")[0]
+func getAppName(base, repository string) string {
+	repository = strings.TrimPrefix(repository, fmt.Sprintf("%s/", base))
+	return strings.Split(repository, "/")[0]
 }
 
-func getBinaryName(imageName string) string {
-	imageName = strings.TrimPrefix(imageName, fmt.Sprintf("%s/", imageBase()))
-	imageName = strings.Split(imageName, ":")[0]
-	return strings.Split(imageName, "/")[1]
+func getBinaryName(base, repository string) string {
+	repository = strings.TrimPrefix(repository, fmt.Sprintf("%s/", base))
+	parts := strings.Split(repository, "/")
+	return parts[len(parts)-1]
 }
 
-func getTag(imageName string) string {
-	return strings.Split(imageName, ":")[1]
+// splitImageName returns the repository and the tag of an image, the port of
+// a registry is not a tag
+func splitImageName(imageName string) (string, string) {
+	i := strings.LastIndex(imageName, ":")
+	if i < 0 || strings.Contains(imageName[i:], "/") {
+		return imageName, ""
+	}
+	return imageName[:i], imageName[i+1:]
 }
 
 func createDirForOutput(file string) error {
 	dir := path.Dir(file)
 	return os.MkdirAll(dir, 0700)
 }
-
-func getVersionTag() string {
-	return time.Now().Format("v2006.01.02150405")
-}
@@ -1,6 +1,7 @@
 package docker_test
 
 import (
+	"path/filepath"
 	"testing"
 
 	"github.com/coopnorge/mage/internal/docker"
@@ -12,6 +13,9 @@ func TestParseMetadata(t *testing.T) {
 		name      string
 		file      string
 		imageName string
+		tags      []string
+		digest    string
+		skipped   bool
 		want      docker.Metadata
 		wantErr   bool
 		errMsg    string
@@ -20,6 +24,27 @@ func TestParseMetadata(t *testing.T) {
 			name:      "good metadata",
 			file:      "./testdata/parse-metadata/good_metadata.json",
 			imageName: "ocreg.invalid/coopnorge/helloworld/helloworld:v2025.03.11135857",
+			tags:      []string{"v2025.03.11135857"},
+			digest:    "sha256:94c49256e2dec5add85c669fe7498aa93e188ebffb6c0c8ec4fe85105a19abdb",
+		},
+		{
+			name:      "multiple tags",
+			file:      "./testdata/parse-metadata/multiple-tags_metadata.json",
+			imageName: "ocreg.invalid/coopnorge/helloworld/helloworld:v1.2.0",
+			tags:      []string{"v1.2.0", "0f5e8c1d2a3b4c5d6e7f8091a2b3c4d5e6f70812"},
+		},
+		{
+			name:      "multiple tags without recorded tags",
+			file:      "./testdata/parse-metadata/unrecorded-tags_metadata.json",
+			imageName: "localhost:5000/helloworld/helloworld:feature-login",
+			tags:      []string{"feature-login", "v2025.03.11135857"},
+		},
+		{
+			name:      "skipped metadata",
+			file:      "./testdata/parse-metadata/skipped_metadata.json",
+			imageName: "ocreg.invalid/coopnorge/helloworld/helloworld:v2025.03.10120000",
+			tags:      []string{"v2025.03.10120000"},
+			skipped:   true,
 		},
 		{
 			name:    "only latest tag",
@@ -50,6 +75,12 @@ func TestParseMetadata(t *testing.T) {
 				assert.NoError(t, gotErr)
 				assert.NotZero(t, got)
 				assert.Equal(t, tt.imageName, got.ImageName)
+				assert.Equal(t, tt.tags, got.Tags)
+				assert.Equal(t, tt.tags[0], got.Tag)
+				assert.Equal(t, tt.skipped, got.Skipped)
+				if tt.digest != "" {
+					assert.Equal(t, tt.digest, got.Digest)
+				}
 			}
 		})
 	}
@@ -86,31 +117,49 @@ func TestImages(t *testing.T) {
 	tests := []struct {
 		name     string
 		imageDir string
-		want     map[string]map[string]map[string]string
+		want     docker.AppImages
 		wantErr  bool
 	}{
 		{
 			name:     "base case",
 			imageDir: "./testdata/send-metadata-to-github",
-			want: map[string]map[string]map[string]string{
+			want: docker.AppImages{
 				"app1": {
 					"binary1": {
-						"image": "ocreg.invalid/coopnorge/app1/binary1:v2025.03.11135857",
-						"tag":   "v2025.03.11135857",
+						Image:     "ocreg.invalid/coopnorge/app1/binary1:v2025.03.11135857",
+						Tag:       "v2025.03.11135857",
+						Tags:      "v2025.03.11135857",
+						Digest:    "sha256:94c49256e2dec5add85c669fe7498aa93e188ebffb6c0c8ec4fe85105a19abdb",
+						Reference: "ocreg.invalid/coopnorge/app1/binary1:v2025.03.11135857@sha256:94c49256e2dec5add85c669fe7498aa93e188ebffb6c0c8ec4fe85105a19abdb",
+						Platforms: map[string]docker.PlatformImage{
+							"linux/amd64": {Digest: "sha256:5f0b6c1fa41bb1a0b3cb4b4c9b6d4b1c1b5c2a5c0e8c2f2e3a9b7d1a4c6e8f0a", Size: 7340032},
+							"linux/arm64": {Digest: "sha256:8d3c1a6f0e2b4d5c7a9e1f3b5d7c9a1e3f5b7d9c1a3e5f7b9d1c3a5e7f9b1d3c", Size: 6815744},
+						},
+						Size:          14155776,
+						BuildDuration: "1m23s",
 					},
 					"binary2": {
-						"image": "ocreg.invalid/coopnorge/app1/binary2:v2025.03.11135857",
-						"tag":   "v2025.03.11135857",
+						Image:     "ocreg.invalid/coopnorge/app1/binary2:v2025.03.11135857",
+						Tag:       "v2025.03.11135857",
+						Tags:      "v2025.03.11135857",
+						Digest:    "sha256:94c49256e2dec5add85c669fe7498aa93e188ebffb6c0c8ec4fe85105a19abdb",
+						Reference: "ocreg.invalid/coopnorge/app1/binary2:v2025.03.11135857@sha256:94c49256e2dec5add85c669fe7498aa93e188ebffb6c0c8ec4fe85105a19abdb",
 					},
 				},
 				"app2": {
 					"binary1": {
-						"image": "ocreg.invalid/coopnorge/app2/binary1:v2025.03.11135857",
-						"tag":   "v2025.03.11135857",
+						Image:     "ocreg.invalid/coopnorge/app2/binary1:v2025.03.11135857",
+						Tag:       "v2025.03.11135857",
+						Tags:      "v2025.03.11135857",
+						Digest:    "sha256:94c49256e2dec5add85c669fe7498aa93e188ebffb6c0c8ec4fe85105a19abdb",
+						Reference: "ocreg.invalid/coopnorge/app2/binary1:v2025.03.11135857@sha256:94c49256e2dec5add85c669fe7498aa93e188ebffb6c0c8ec4fe85105a19abdb",
 					},
 					"binary2": {
-						"image": "ocreg.invalid/coopnorge/app2/binary2:v2025.03.11135857",
-						"tag":   "v2025.03.11135857",
+						Image:     "ocreg.invalid/coopnorge/app2/binary2:v2025.03.11135857",
+						Tag:       "v2025.03.11135857",
+						Tags:      "v2025.03.11135857",
+						Digest:    "sha256:94c49256e2dec5add85c669fe7498aa93e188ebffb6c0c8ec4fe85105a19abdb",
+						Reference: "ocreg.invalid/coopnorge/app2/binary2:v2025.03.11135857@sha256:94c49256e2dec5add85c669fe7498aa93e188ebffb6c0c8ec4fe85105a19abdb",
 					},
 				},
 			},
@@ -125,3 +174,24 @@ func TestImages(t *testing.T) {
 		})
 	}
 }
+
+func TestWriteSkippedMetadata(t *testing.T) {
+	imageDir := t.TempDir()
+	err := docker.WriteSkippedMetadata(filepath.Join(imageDir, "app1", "oci", "binary1", "metadata.json"), "ocreg.invalid/coopnorge/app1/binary1:v2025.03.10120000", "sha256:94c49256e2dec5add85c669fe7498aa93e188ebffb6c0c8ec4fe85105a19abdb")
+	assert.NoError(t, err)
+
+	got, err := docker.Images(imageDir)
+	assert.NoError(t, err)
+	assert.Equal(t, docker.AppImages{
+		"app1": {
+			"binary1": {
+				Image:     "ocreg.invalid/coopnorge/app1/binary1:v2025.03.10120000",
+				Tag:       "v2025.03.10120000",
+				Tags:      "v2025.03.10120000",
+				Digest:    "sha256:94c49256e2dec5add85c669fe7498aa93e188ebffb6c0c8ec4fe85105a19abdb",
+				Reference: "ocreg.invalid/coopnorge/app1/binary1:v2025.03.10120000@sha256:94c49256e2dec5add85c669fe7498aa93e188ebffb6c0c8ec4fe85105a19abdb",
+				Skipped:   true,
+			},
+		},
+	}, got)
+}
@@ -0,0 +1,168 @@
+package docker
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// RequiredArgs are the build arguments a Dockerfile for a binary has to
+// declare, they are set by [BuildAndPush]
+var RequiredArgs = []string{"APP", "BINARY", "GIT_COMMIT_SHA"}
+
+// Instruction is an instruction in a Dockerfile
+type Instruction struct {
+	// Line is the line the instruction starts on
+	Line int
+	// Command is the upper case name of the instruction, like FROM or RUN
+	Command string
+	// Args is the rest of the instruction with continued lines joined
+	Args string
+}
+
+// ParseDockerfile returns the instructions of a Dockerfile. Comments and
+// empty lines are skipped and lines ending with a backslash are joined with
+// the next line.
+func ParseDockerfile(dockerfileContent string) []Instruction {
+	instructions := []Instruction{}
+	var current *Instruction
+	for i, line := range strings.Split(dockerfileContent, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		continued := strings.HasSuffix(trimmed, "\\")
+		trimmed = strings.TrimSpace(strings.TrimSuffix(trimmed, "\\"))
+		if current == nil {
+			command, args, _ := strings.Cut(trimmed, " ")
+			current = &Instruction{
+				Line:    i + 1,
+				Command: strings.ToUpper(command),
+				Args:    strings.TrimSpace(args),
+			}
+		} else if trimmed != "" {
+			current.Args = strings.TrimSpace(current.Args + " " + trimmed)
+		}
+		if !continued {
+			instructions = append(instructions, *current)
+			current = nil
+		}
+	}
+	if current != nil {
+		instructions = append(instructions, *current)
+	}
+	return instructions
+}
+
+// Args returns the names of the build arguments declared with ARG
+func Args(instructions []Instruction) []string {
+	args := []string{}
+	for _, instruction := range instructions {
+		if instruction.Command != "ARG" {
+			continue
+		}
+		for _, field := range strings.Fields(instruction.Args) {
+			name, _, _ := strings.Cut(field, "=")
+			if !slices.Contains(args, name) {
+				args = append(args, name)
+			}
+		}
+	}
+	return args
+}
+
+// ValidateRequiredArgs returns an error if the Dockerfile does not declare
+// all [RequiredArgs]
+func ValidateRequiredArgs(dockerfileContent string) error {
+	declared := Args(ParseDockerfile(dockerfileContent))
+	missing := []string{}
+	for _, arg := range RequiredArgs {
+		if !slices.Contains(declared, arg) {
+			missing = append(missing, arg)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required ARG: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// FinalStage returns the instructions after the last FROM instruction
+func FinalStage(instructions []Instruction) []Instruction {
+	for i := len(instructions) - 1; i >= 0; i-- {
+		if instructions[i].Command == "FROM" {
+			return instructions[i+1:]
+		}
+	}
+	return instructions
+}
+
+// Labels returns the keys of the labels set with LABEL, both the key=value
+// form with quoted values and the legacy LABEL key value form
+func Labels(instructions []Instruction) []string {
+	labels := []string{}
+	for _, instruction := range instructions {
+		if instruction.Command != "LABEL" {
+			continue
+		}
+		for _, key := range labelKeys(instruction.Args) {
+			if !slices.Contains(labels, key) {
+				labels = append(labels, key)
+			}
+		}
+	}
+	return labels
+}
+
+// labelKeys returns the keys of the arguments of a LABEL instruction
+func labelKeys(args string) []string {
+	keys := []string{}
+	for rest := strings.TrimSpace(args); rest != ""; rest = strings.TrimSpace(rest) {
+		key, value, found := strings.Cut(rest, "=")
+		if !found || strings.ContainsAny(key, " \t") {
+			key, _, _ = strings.Cut(rest, " ")
+			return append(keys, strings.Trim(key, `"'`))
+		}
+		keys = append(keys, strings.Trim(key, `"'`))
+		rest = skipLabelValue(value)
+	}
+	return keys
+}
+
+// skipLabelValue returns s after the quoted or unquoted value at its start
+func skipLabelValue(s string) string {
+	if s == "" {
+		return s
+	}
+	if quote := s[0]; quote == '"' || quote == '\'' {
+		for i := 1; i < len(s); i++ {
+			switch s[i] {
+			case '\\':
+				i++
+			case quote:
+				return s[i+1:]
+			}
+		}
+		return ""
+	}
+	if i := strings.IndexAny(s, " \t"); i >= 0 {
+		return s[i:]
+	}
+	return ""
+}
+
+// ValidateRequiredLabels returns an error if the final stage of the
+// Dockerfile does not set all labels with LABEL
+func ValidateRequiredLabels(dockerfileContent string, labels []string) error {
+	declared := Labels(FinalStage(ParseDockerfile(dockerfileContent)))
+	missing := []string{}
+	for _, label := range labels {
+		if !slices.Contains(declared, label) {
+			missing = append(missing, label)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required LABEL in the final stage: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package docker_test
+
+import (
+	"testing"
+
+	"github.com/coopnorge/mage/internal/docker"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDockerfile(t *testing.T) {
+	dockerfile := `# syntax=docker/dockerfile:1
+FROM alpine AS runtime
+
+arg APP
+RUN \
+    apk --no-cache add \
+        tzdata \
+    && \
+    true
+# comment
+CMD ["sh", "-c", "exec ${APP_BIN}"]`
+
+	want := []docker.Instruction{
+		{Line: 2, Command: "FROM", Args: "alpine AS runtime"},
+		{Line: 4, Command: "ARG", Args: "APP"},
+		{Line: 5, Command: "RUN", Args: "apk --no-cache add tzdata && true"},
+		{Line: 11, Command: "CMD", Args: `["sh", "-c", "exec ${APP_BIN}"]`},
+	}
+	assert.Equal(t, want, docker.ParseDockerfile(dockerfile))
+}
+
+func TestValidateRequiredArgs(t *testing.T) {
+	tests := []struct {
+		name       string
+		dockerfile string
+		errMsg     string
+	}{
+		{
+			name: "all required args",
+			dockerfile: `FROM alpine
+ARG APP
+ARG BINARY
+ARG GIT_COMMIT_SHA`,
+		},
+		{
+			name: "args with defaults on one line",
+			dockerfile: `FROM alpine
+ARG APP=app BINARY=server GIT_COMMIT_SHA`,
+		},
+		{
+			name: "missing args",
+			dockerfile: `FROM gcr.io/distroless/static
+ARG APP
+LABEL BINARY=server`,
+			errMsg: "missing required ARG: BINARY, GIT_COMMIT_SHA",
+		},
+		{
+			name:       "empty dockerfile",
+			dockerfile: "",
+			errMsg:     "missing required ARG: APP, BINARY, GIT_COMMIT_SHA",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := docker.ValidateRequiredArgs(tt.dockerfile)
+			if tt.errMsg != "" {
+				assert.EqualError(t, err, tt.errMsg)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateRequiredLabels(t *testing.T) {
+	labels := []string{"org.opencontainers.image.source", "org.opencontainers.image.revision"}
+	tests := []struct {
+		name       string
+		dockerfile string
+		errMsg     string
+	}{
+		{
+			name: "labels in the final stage",
+			dockerfile: `FROM golang AS build
+FROM alpine
+LABEL org.opencontainers.image.source=${GIT_REPOSITORY_URL}
+LABEL org.opencontainers.image.revision=${GIT_COMMIT_SHA}`,
+		},
+		{
+			name: "labels on one line with quoted values",
+			dockerfile: `FROM alpine
+LABEL "org.opencontainers.image.source"="https://example.com/a b" \
+      org.opencontainers.image.revision='abc'`,
+		},
+		{
+			name: "legacy label form",
+			dockerfile: `FROM alpine
+LABEL org.opencontainers.image.source https://example.com
+LABEL org.opencontainers.image.revision=abc`,
+		},
+		{
+			name: "labels only in a previous stage",
+			dockerfile: `FROM golang AS build
+LABEL org.opencontainers.image.source=${GIT_REPOSITORY_URL}
+FROM alpine
+LABEL org.opencontainers.image.revision=${GIT_COMMIT_SHA}`,
+			errMsg: "missing required LABEL in the final stage: org.opencontainers.image.source",
+		},
+		{
+			name:       "no labels",
+			dockerfile: "FROM alpine",
+			errMsg:     "missing required LABEL in the final stage: org.opencontainers.image.source, org.opencontainers.image.revision",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := docker.ValidateRequiredLabels(tt.dockerfile, labels)
+			if tt.errMsg != "" {
+				assert.EqualError(t, err, tt.errMsg)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
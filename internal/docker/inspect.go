@@ -0,0 +1,249 @@
+package docker
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+)
+
+// secretFileNames are the patterns of the names of files that look like
+// secrets
+var secretFileNames = []string{
+	".env", ".env.*",
+	"*.key", "*.p12", "*.pfx", "*.jks",
+	"id_rsa", "id_dsa", "id_ecdsa", "id_ed25519",
+	".netrc", ".git-credentials", ".pgpass", "credentials.json",
+}
+
+// secretFilePaths are the paths of files that look like secrets
+var secretFilePaths = []string{
+	".aws/credentials",
+	".docker/config.json",
+	".kube/config",
+}
+
+// InspectPolicy is what an image must comply with, see [Inspect]
+type InspectPolicy struct {
+	// RequiredLabels must be set in the image config
+	RequiredLabels []string
+	// MaxSize is the largest compressed size of the image of a platform in
+	// bytes, there is no limit when it is 0
+	MaxSize int64
+}
+
+// Layer is a layer of the image of a platform
+type Layer struct {
+	Digest string
+	Size   int64
+	// CreatedBy is the build step that created the layer
+	CreatedBy string
+}
+
+// Inspection is the result of [Inspect]
+type Inspection struct {
+	// Platforms are the images by platform
+	Platforms map[string]PlatformImage
+	// Layers are the layers by platform
+	Layers map[string][]Layer
+	// Findings are the violations of the policy
+	Findings []string
+}
+
+// Inspect reads the OCI image layout tarball of an image, like the image.tar
+// written by [BuildAndPush], and checks the image of every platform against
+// the policy: the image does not run as root, has the required labels, does
+// not contain files that look like secrets and is not larger than the
+// maximum size. Layers are streamed from the tarball, no docker daemon is
+// needed.
+func Inspect(imagePath string, policy InspectPolicy) (*Inspection, error) {
+	archive, err := ReadOCIArchive(imagePath)
+	if err != nil {
+		return nil, err
+	}
+	platforms, err := archive.Platforms()
+	if err != nil {
+		return nil, err
+	}
+	result := &Inspection{Platforms: platforms, Layers: map[string][]Layer{}}
+	layerPlatforms := map[string][]string{}
+	layers := map[string]Descriptor{}
+
+	for _, platform := range sortedKeys(platforms) {
+		image := platforms[platform]
+		result.Layers[platform] = imageLayers(image)
+		for _, layer := range image.Manifest.Layers {
+			layers[layer.Digest] = layer
+			layerPlatforms[layer.Digest] = append(layerPlatforms[layer.Digest], platform)
+		}
+
+		user := image.Config.Config.User
+		if isRoot(user) {
+			result.Findings = append(result.Findings, fmt.Sprintf("%s: runs as root, set USER in the Dockerfile", platform))
+		}
+		for _, label := range policy.RequiredLabels {
+			if image.Config.Config.Labels[label] == "" {
+				result.Findings = append(result.Findings, fmt.Sprintf("%s: label %s is missing", platform, label))
+			}
+		}
+		if policy.MaxSize > 0 && image.Size > policy.MaxSize {
+			result.Findings = append(result.Findings, fmt.Sprintf("%s: size %s is larger than %s", platform, FormatSize(image.Size), FormatSize(policy.MaxSize)))
+		}
+	}
+
+	secrets := map[string][]string{}
+	err = archive.walkLayers(layers, func(layer Descriptor, header *tar.Header) error {
+		if header.Typeflag != tar.TypeReg || !isSecretFile(header.Name) {
+			return nil
+		}
+		file := "/" + strings.TrimPrefix(path.Clean(header.Name), "/")
+		if !slices.Contains(secrets[layer.Digest], file) {
+			secrets[layer.Digest] = append(secrets[layer.Digest], file)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, digest := range sortedKeys(secrets) {
+		for _, file := range secrets[digest] {
+			result.Findings = append(result.Findings, fmt.Sprintf("%s: %s looks like a secret, layer %s", strings.Join(layerPlatforms[digest], ", "), file, digest))
+		}
+	}
+	return result, nil
+}
+
+// imageLayers returns the layers of an image with the build steps that
+// created them
+func imageLayers(image PlatformImage) []Layer {
+	steps := []string{}
+	for _, history := range image.Config.History {
+		if !history.EmptyLayer {
+			steps = append(steps, history.CreatedBy)
+		}
+	}
+	result := []Layer{}
+	for i, layer := range image.Manifest.Layers {
+		createdBy := ""
+		if len(steps) == len(image.Manifest.Layers) {
+			createdBy = steps[i]
+		}
+		result = append(result, Layer{Digest: layer.Digest, Size: layer.Size, CreatedBy: createdBy})
+	}
+	return result
+}
+
+// isRoot returns true if the user of an image is root, images without a user
+// run as root
+func isRoot(user string) bool {
+	name, _, _ := strings.Cut(user, ":")
+	return name == "" || name == "root" || name == "0"
+}
+
+// isSecretFile returns true if the file in a layer looks like a secret
+func isSecretFile(name string) bool {
+	name = path.Clean("/" + name)
+	base := path.Base(name)
+	if strings.HasPrefix(base, ".wh.") {
+		// whiteouts mark deleted files
+		return false
+	}
+	for _, pattern := range secretFileNames {
+		if ok, _ := path.Match(pattern, base); ok {
+			return true
+		}
+	}
+	for _, secretPath := range secretFilePaths {
+		if strings.HasSuffix(name, "/"+secretPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// walkLayers streams the files of the layers in the tarball, layers are read
+// once even if they are shared by platforms
+func (a *OCIArchive) walkLayers(layers map[string]Descriptor, fn func(layer Descriptor, header *tar.Header) error) error {
+	file, err := os.Open(a.path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	reader := tar.NewReader(file)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", a.path, err)
+		}
+		name := path.Clean(header.Name)
+		if !strings.HasPrefix(name, "blobs/") {
+			continue
+		}
+		layer, ok := layers[blobDigest(name)]
+		if !ok {
+			continue
+		}
+		err = walkLayer(reader, layer, fn)
+		if err != nil {
+			return fmt.Errorf("%s: layer %s: %w", a.path, layer.Digest, err)
+		}
+	}
+}
+
+// walkLayer streams the files of a layer
+func walkLayer(content io.Reader, layer Descriptor, fn func(layer Descriptor, header *tar.Header) error) error {
+	switch {
+	case strings.HasSuffix(layer.MediaType, "tar+gzip") || strings.HasSuffix(layer.MediaType, "tar.gzip"):
+		gz, err := gzip.NewReader(content)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = gz.Close()
+		}()
+		content = gz
+	case strings.HasSuffix(layer.MediaType, "tar"):
+	default:
+		return fmt.Errorf("unsupported media type %s", layer.MediaType)
+	}
+
+	reader := tar.NewReader(content)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		err = fn(layer, header)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// FormatSize formats a size in bytes with binary units
+func FormatSize(size int64) string {
+	switch {
+	case size >= 1<<30:
+		return fmt.Sprintf("%.1f GiB", float64(size)/(1<<30))
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(size)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", size)
+	}
+}
@@ -0,0 +1,127 @@
+package docker_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"testing"
+
+	"github.com/coopnorge/mage/internal/docker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gzipLayer returns a gzip compressed layer with empty files
+func gzipLayer(t *testing.T, files ...string) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	gz := gzip.NewWriter(&buffer)
+	writer := tar.NewWriter(gz)
+	for _, file := range files {
+		require.NoError(t, writer.WriteHeader(&tar.Header{Name: file, Mode: 0o644, Typeflag: tar.TypeReg}))
+	}
+	require.NoError(t, writer.Close())
+	require.NoError(t, gz.Close())
+	return buffer.Bytes()
+}
+
+func TestInspect(t *testing.T) {
+	labels := map[string]any{
+		"org.opencontainers.image.source":   "https://github.com/coopnorge/helloworld",
+		"org.opencontainers.image.revision": "0f5e8c1d2a3b4c5d6e7f8091a2b3c4d5e6f70812",
+	}
+	history := []map[string]any{
+		{"created_by": "ADD alpine-minirootfs.tar.gz / # buildkit"},
+		{"created_by": "ARG APP", "empty_layer": true},
+		{"created_by": "COPY ./var/app1/bin/linux/amd64/binary1 /usr/local/bin/ # buildkit"},
+	}
+	base := gzipLayer(t, "etc/ssl/certs/ca-certificates.crt", "usr/share/apk/keys/alpine.rsa.pub")
+
+	tests := []struct {
+		name     string
+		user     string
+		labels   map[string]any
+		layer    []byte
+		policy   docker.InspectPolicy
+		findings []string
+	}{
+		{
+			name:   "compliant image",
+			user:   "binary1:app1",
+			labels: labels,
+			layer:  gzipLayer(t, "usr/local/bin/binary1"),
+			policy: docker.InspectPolicy{RequiredLabels: []string{"org.opencontainers.image.source"}, MaxSize: 1 << 20},
+		},
+		{
+			name:     "root user",
+			user:     "0:0",
+			labels:   labels,
+			layer:    gzipLayer(t, "usr/local/bin/binary1"),
+			findings: []string{"linux/amd64: runs as root, set USER in the Dockerfile"},
+		},
+		{
+			name:     "no user",
+			labels:   labels,
+			layer:    gzipLayer(t, "usr/local/bin/binary1"),
+			findings: []string{"linux/amd64: runs as root, set USER in the Dockerfile"},
+		},
+		{
+			name:     "missing label",
+			user:     "binary1",
+			layer:    gzipLayer(t, "usr/local/bin/binary1"),
+			policy:   docker.InspectPolicy{RequiredLabels: []string{"org.opencontainers.image.revision"}},
+			findings: []string{"linux/amd64: label org.opencontainers.image.revision is missing"},
+		},
+		{
+			name:     "too large",
+			user:     "binary1",
+			labels:   labels,
+			layer:    gzipLayer(t, "usr/local/bin/binary1"),
+			policy:   docker.InspectPolicy{MaxSize: 100},
+			findings: []string{"linux/amd64: size"},
+		},
+		{
+			name:   "secrets",
+			user:   "binary1",
+			labels: labels,
+			layer:  gzipLayer(t, "usr/local/bin/binary1", "var/opt/app1/.env", "root/.aws/credentials", "app/tls.key", "app/.wh.id_rsa"),
+			findings: []string{
+				"linux/amd64: /var/opt/app1/.env looks like a secret",
+				"linux/amd64: /root/.aws/credentials looks like a secret",
+				"linux/amd64: /app/tls.key looks like a secret",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blobs := ociBlobs{}
+			manifest := configuredImageManifest(t, blobs, map[string]any{
+				"os":           "linux",
+				"architecture": "amd64",
+				"config":       map[string]any{"User": tt.user, "Labels": tt.labels},
+				"history":      history,
+			}, base, tt.layer)
+
+			got, err := docker.Inspect(writeOCIArchive(t, blobs, manifest), tt.policy)
+			require.NoError(t, err)
+
+			layers := got.Layers["linux/amd64"]
+			require.Len(t, layers, 2)
+			assert.Equal(t, int64(len(tt.layer)), layers[1].Size)
+			assert.Equal(t, "COPY ./var/app1/bin/linux/amd64/binary1 /usr/local/bin/ # buildkit", layers[1].CreatedBy)
+			assert.Len(t, got.Findings, len(tt.findings))
+			for i, finding := range tt.findings {
+				if i < len(got.Findings) {
+					assert.Contains(t, got.Findings[i], finding)
+				}
+			}
+		})
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	assert.Equal(t, "512 B", docker.FormatSize(512))
+	assert.Equal(t, "1.5 KiB", docker.FormatSize(1536))
+	assert.Equal(t, "7.0 MiB", docker.FormatSize(7340032))
+	assert.Equal(t, "2.0 GiB", docker.FormatSize(2<<30))
+}
@@ -0,0 +1,228 @@
+package docker
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/coopnorge/mage/internal/core"
+)
+
+// Lint rules of [Lint]
+const (
+	// RuleUnpinnedImage reports base images without a digest
+	RuleUnpinnedImage = "unpinned-image"
+	// RuleAPKCache reports apk add without --no-cache
+	RuleAPKCache = "apk-cache"
+	// RuleRootUser reports final stages without a USER or with root as USER
+	RuleRootUser = "root-user"
+	// RuleAddURL reports ADD from a URL without a checksum
+	RuleAddURL = "add-url"
+)
+
+// HadolintCodes are the codes of the hadolint rules matching the Rule
+// constants, they ignore the rules like their names. DL3018, pinning the
+// versions of apk add, is included since it is ignored on the same lines as
+// DL3019 in most Dockerfiles.
+var HadolintCodes = map[string][]string{
+	RuleUnpinnedImage: {"DL3006", "DL3007"},
+	RuleAPKCache:      {"DL3018", "DL3019"},
+	RuleRootUser:      {"DL3002"},
+	RuleAddURL:        {"DL3020"},
+}
+
+// IsRule returns true if the name is the rule or one of its
+// [HadolintCodes]
+func IsRule(rule, name string) bool {
+	return rule == name || slices.ContainsFunc(HadolintCodes[rule], func(code string) bool {
+		return strings.EqualFold(code, name)
+	})
+}
+
+// discoveryExcludes are excluded from the discovery of Dockerfiles in
+// addition to [core.DefaultExcludes]
+var discoveryExcludes = []core.Rule{
+	{Pattern: "vendor/", Reason: "vendor directory"},
+	{Pattern: "testdata/", Reason: "testdata directory"},
+}
+
+// Finding is a violation of a lint rule in a Dockerfile
+type Finding struct {
+	// Line is the line of the instruction
+	Line    int
+	Rule    string
+	Message string
+}
+
+// ignorePragma is the comment ignoring rules for the next instruction, like
+// hadolint
+const ignorePragma = "hadolint ignore="
+
+// Lint checks the Dockerfile with hadolint-style rules, see the Rule
+// constants. Images referenced with build arguments and previous stages are
+// not checked for digests. Findings of rules in a # hadolint ignore=<rule>
+// comment on the line before an instruction are not reported, rules are
+// named or hadolint codes, see [IsRule].
+func Lint(dockerfileContent string) []Finding {
+	findings := []Finding{}
+	stages := []string{}
+	var lastFrom, lastUser *Instruction
+	instructions := ParseDockerfile(dockerfileContent)
+	for _, instruction := range instructions {
+		switch instruction.Command {
+		case "FROM":
+			lastFrom, lastUser = &instruction, nil
+			image, stage := fromImage(instruction.Args)
+			checked := image != "scratch" && !strings.ContainsAny(image, "$@") && !slices.Contains(stages, strings.ToLower(image))
+			if stage != "" {
+				stages = append(stages, strings.ToLower(stage))
+			}
+			if checked {
+				findings = append(findings, Finding{Line: instruction.Line, Rule: RuleUnpinnedImage,
+					Message: fmt.Sprintf("base image %s is not pinned to a digest, use %s@sha256:<digest>", image, image)})
+			}
+		case "RUN":
+			if apkAddWithCache(instruction.Args) {
+				findings = append(findings, Finding{Line: instruction.Line, Rule: RuleAPKCache,
+					Message: "apk add without --no-cache keeps the package index in the image"})
+			}
+		case "USER":
+			lastUser = &instruction
+		case "ADD":
+			if url := addURL(instruction.Args); url != "" {
+				findings = append(findings, Finding{Line: instruction.Line, Rule: RuleAddURL,
+					Message: fmt.Sprintf("ADD downloads %s without verifying it, add --checksum or download and verify it in RUN", url)})
+			}
+		}
+	}
+	switch {
+	// A final stage that only references an image is not built, like the
+	// stages of devtools/Dockerfile pinning the images of tools
+	case lastFrom == nil || instructions[len(instructions)-1].Command == "FROM":
+	case lastUser == nil:
+		findings = append(findings, Finding{Line: lastFrom.Line, Rule: RuleRootUser,
+			Message: "the final stage has no USER and runs as root"})
+	case isRoot(lastUser.Args):
+		findings = append(findings, Finding{Line: lastUser.Line, Rule: RuleRootUser,
+			Message: fmt.Sprintf("the final stage runs as %s", lastUser.Args)})
+	}
+	ignored := ignoredRules(dockerfileContent)
+	findings = slices.DeleteFunc(findings, func(finding Finding) bool {
+		return slices.ContainsFunc(ignored[finding.Line], func(name string) bool {
+			return IsRule(finding.Rule, name)
+		})
+	})
+	slices.SortStableFunc(findings, func(a, b Finding) int { return a.Line - b.Line })
+	return findings
+}
+
+// ignoredRules returns the rules of the ignore pragmas by the line of the
+// instruction following them
+func ignoredRules(dockerfileContent string) map[int][]string {
+	ignored := map[int][]string{}
+	rules := []string{}
+	for i, line := range strings.Split(dockerfileContent, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if comment, ok := strings.CutPrefix(trimmed, "#"); ok {
+			if list, ok := strings.CutPrefix(strings.TrimSpace(comment), ignorePragma); ok {
+				for _, rule := range strings.Split(list, ",") {
+					rules = append(rules, strings.TrimSpace(rule))
+				}
+			}
+			continue
+		}
+		if trimmed == "" || len(rules) == 0 {
+			continue
+		}
+		ignored[i+1], rules = rules, []string{}
+	}
+	return ignored
+}
+
+// fromImage returns the image and the name of the stage of a FROM instruction
+func fromImage(args string) (string, string) {
+	fields := slices.DeleteFunc(strings.Fields(args), func(field string) bool {
+		return strings.HasPrefix(field, "--")
+	})
+	if len(fields) == 0 {
+		return "", ""
+	}
+	if len(fields) == 3 && strings.EqualFold(fields[1], "AS") {
+		return fields[0], fields[2]
+	}
+	return fields[0], ""
+}
+
+// apkAddWithCache returns true if a command of the shell form RUN adds apk
+// packages without --no-cache
+func apkAddWithCache(args string) bool {
+	replacer := strings.NewReplacer("&&", ";", "||", ";", "|", ";", "\n", ";")
+	for _, command := range strings.Split(replacer.Replace(args), ";") {
+		fields := strings.FieldsFunc(command, func(r rune) bool {
+			return r == ' ' || r == '\t' || r == '[' || r == ']' || r == ',' || r == '"'
+		})
+		i := slices.Index(fields, "apk")
+		if i < 0 || !slices.Contains(fields[i:], "add") {
+			continue
+		}
+		if !slices.Contains(fields[i:], "--no-cache") {
+			return true
+		}
+	}
+	return false
+}
+
+// addURL returns the first source of an ADD instruction that is a URL when
+// the instruction has no checksum
+func addURL(args string) string {
+	fields := strings.Fields(args)
+	if slices.ContainsFunc(fields, func(field string) bool { return strings.HasPrefix(field, "--checksum") }) {
+		return ""
+	}
+	sources := slices.DeleteFunc(fields, func(field string) bool {
+		return strings.HasPrefix(field, "--")
+	})
+	if len(sources) < 2 {
+		return ""
+	}
+	for _, source := range sources[:len(sources)-1] {
+		if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+			return source
+		}
+	}
+	return ""
+}
+
+// IsDockerfile returns true if the name of a file is a Dockerfile, like
+// Dockerfile, app.Dockerfile or Dockerfile.dev
+func IsDockerfile(name string) bool {
+	lower := strings.ToLower(name)
+	if strings.HasSuffix(lower, ".dockerignore") {
+		return false
+	}
+	// Only Dockerfile.dev and not dockerfile.go
+	return lower == "dockerfile" || strings.HasSuffix(lower, ".dockerfile") || strings.HasPrefix(name, "Dockerfile.")
+}
+
+// FindDockerfiles returns the Dockerfiles in the base directory, excluded
+// directories are skipped, see [core.Discovery]
+func FindDockerfiles(base string) ([]string, error) {
+	discovery, err := core.NewDiscovery(base, discoveryExcludes...)
+	if err != nil {
+		return nil, err
+	}
+	dockerfiles := []string{}
+	err = discovery.Walk(false, func(dir core.Dir, _ bool, _ string) error {
+		for _, name := range dir.Files {
+			if IsDockerfile(name) {
+				dockerfiles = append(dockerfiles, filepath.Join(dir.Path, name))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dockerfiles, nil
+}
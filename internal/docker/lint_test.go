@@ -0,0 +1,166 @@
+package docker_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/coopnorge/mage/internal/docker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name       string
+		dockerfile string
+		want       []docker.Finding
+	}{
+		{
+			name: "compliant",
+			dockerfile: `FROM --platform=$BUILDPLATFORM docker.io/library/golang:1.26@sha256:94c49256e2dec5add85c669fe7498aa93e188ebffb6c0c8ec4fe85105a19abdb AS build
+ARG BASE=scratch
+FROM ${BASE} AS base
+FROM build
+RUN apk --no-cache update && \
+    apk --no-cache add tzdata
+ADD --checksum=sha256:24454f830cdb571e2c4ad15481119c43b3cafd48dd869a9b2945d1036d1dc68d https://example.com/tool.tar.gz /tmp/
+ADD ./config /etc/app/
+USER app:app`,
+		},
+		{
+			name: "unpinned base images",
+			dockerfile: `FROM docker.io/library/alpine:3.24.1 AS alpine
+FROM alpine
+FROM scratch
+USER 1000`,
+			want: []docker.Finding{
+				{Line: 1, Rule: docker.RuleUnpinnedImage, Message: "base image docker.io/library/alpine:3.24.1 is not pinned to a digest, use docker.io/library/alpine:3.24.1@sha256:<digest>"},
+			},
+		},
+		{
+			name: "apk add with cache",
+			dockerfile: `FROM scratch
+RUN apk --no-cache update && apk add \
+    tzdata
+RUN ["apk", "add", "curl"]
+USER app`,
+			want: []docker.Finding{
+				{Line: 2, Rule: docker.RuleAPKCache, Message: "apk add without --no-cache keeps the package index in the image"},
+				{Line: 4, Rule: docker.RuleAPKCache, Message: "apk add without --no-cache keeps the package index in the image"},
+			},
+		},
+		{
+			name: "only image references",
+			dockerfile: `# Do not remove, used by pallet validation
+FROM ghcr.io/coopnorge/engineering-docker-images/e0/techdocs:latest@sha256:316ea57a8872fb4df6a1d9a43c4e34fe3602f515fa48a43ae8b25a30fa615fcd AS techdocs`,
+		},
+		{
+			name: "missing user in the final stage",
+			dockerfile: `FROM scratch AS build
+USER app
+FROM scratch
+COPY --from=build /app /app`,
+			want: []docker.Finding{
+				{Line: 3, Rule: docker.RuleRootUser, Message: "the final stage has no USER and runs as root"},
+			},
+		},
+		{
+			name: "root user",
+			dockerfile: `FROM scratch
+USER app
+USER root:root`,
+			want: []docker.Finding{
+				{Line: 3, Rule: docker.RuleRootUser, Message: "the final stage runs as root:root"},
+			},
+		},
+		{
+			name: "add from a URL",
+			dockerfile: `FROM scratch
+ADD --chmod=755 https://example.com/tool /usr/local/bin/tool
+USER app`,
+			want: []docker.Finding{
+				{Line: 2, Rule: docker.RuleAddURL, Message: "ADD downloads https://example.com/tool without verifying it, add --checksum or download and verify it in RUN"},
+			},
+		},
+		{
+			name: "ignored rules",
+			dockerfile: `# hadolint ignore=root-user, unpinned-image
+FROM alpine:3.24.1
+# Needs the package index at runtime
+# hadolint ignore=apk-cache
+RUN apk add tzdata
+# hadolint ignore=apk-cache
+RUN apk add curl && \
+    apk add git
+
+# hadolint ignore=add-url
+USER app
+ADD https://example.com/tool /usr/local/bin/tool`,
+			want: []docker.Finding{
+				{Line: 12, Rule: docker.RuleAddURL, Message: "ADD downloads https://example.com/tool without verifying it, add --checksum or download and verify it in RUN"},
+			},
+		},
+		{
+			name: "rules ignored with hadolint codes",
+			dockerfile: `# hadolint ignore=DL3002,DL3006
+FROM alpine
+# hadolint ignore=DL3018
+RUN apk add tzdata
+# hadolint ignore=dl3020
+ADD https://example.com/tool /usr/local/bin/tool`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := docker.Lint(tt.dockerfile)
+			if len(tt.want) == 0 {
+				assert.Empty(t, got)
+				return
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestIsRule(t *testing.T) {
+	assert.True(t, docker.IsRule(docker.RuleRootUser, "root-user"))
+	assert.True(t, docker.IsRule(docker.RuleRootUser, "DL3002"))
+	assert.True(t, docker.IsRule(docker.RuleAPKCache, "dl3019"))
+	assert.False(t, docker.IsRule(docker.RuleRootUser, "DL3020"))
+	assert.False(t, docker.IsRule(docker.RuleRootUser, "ROOT-USER"))
+}
+
+func TestLintEmbeddedDockerfile(t *testing.T) {
+	content, err := os.ReadFile(filepath.Join("..", "..", "targets", "goapp", "app.Dockerfile"))
+	require.NoError(t, err)
+	assert.Empty(t, docker.Lint(string(content)))
+}
+
+func TestFindDockerfiles(t *testing.T) {
+	base := t.TempDir()
+	for _, file := range []string{
+		"Dockerfile",
+		"app1/cmd/server/Dockerfile",
+		"tools/tools.Dockerfile",
+		"tools/Dockerfile.dev",
+		"tools/Dockerfile.dockerignore",
+		"internal/docker/dockerfile.go",
+		"app1/testdata/Dockerfile",
+		"vendor/example/Dockerfile",
+		"README.md",
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Join(base, filepath.Dir(file)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(base, file), []byte("FROM scratch\n"), 0o644))
+	}
+
+	got, err := docker.FindDockerfiles(base)
+	require.NoError(t, err)
+	want := []string{
+		filepath.Join(base, "Dockerfile"),
+		filepath.Join(base, "app1/cmd/server/Dockerfile"),
+		filepath.Join(base, "tools/Dockerfile.dev"),
+		filepath.Join(base, "tools/tools.Dockerfile"),
+	}
+	assert.ElementsMatch(t, want, got)
+}
@@ -0,0 +1,265 @@
+package docker
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+)
+
+const (
+	mediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+	mediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	// referenceTypeAnnotation marks the attestation manifests of buildx
+	referenceTypeAnnotation = "vnd.docker.reference.type"
+	// maxJSONBlobSize is the size of the largest blob read into memory,
+	// manifests and configs are small
+	maxJSONBlobSize = 4 << 20
+)
+
+// Descriptor references a blob in an OCI image layout
+type Descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Platform    *OCIPlatform      `json:"platform,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// OCIPlatform is the platform of an image manifest
+type OCIPlatform struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// String returns the platform like os/arch/variant
+func (p OCIPlatform) String() string {
+	if p.Variant != "" {
+		return fmt.Sprintf("%s/%s/%s", p.OS, p.Architecture, p.Variant)
+	}
+	return fmt.Sprintf("%s/%s", p.OS, p.Architecture)
+}
+
+// index is an OCI image index or the index.json of a layout
+type index struct {
+	Manifests []Descriptor `json:"manifests"`
+}
+
+// Manifest is an OCI image manifest
+type Manifest struct {
+	Config Descriptor   `json:"config"`
+	Layers []Descriptor `json:"layers"`
+}
+
+// ImageConfig is the part of an OCI image config used by the targets
+type ImageConfig struct {
+	OCIPlatform
+	Config struct {
+		User   string            `json:"User"`
+		Labels map[string]string `json:"Labels"`
+	} `json:"config"`
+	History []History `json:"history"`
+}
+
+// History is a step of the build of an image, steps with a layer are in the
+// order of the layers
+type History struct {
+	CreatedBy  string `json:"created_by"`
+	EmptyLayer bool   `json:"empty_layer"`
+}
+
+// PlatformImage is the image of a platform in a multi-platform image
+type PlatformImage struct {
+	// Digest is the digest of the image manifest
+	Digest string `json:"digest"`
+	// Size is the compressed size of the config and the layers in bytes
+	Size int64 `json:"size"`
+	// Manifest is the image manifest
+	Manifest Manifest `json:"-"`
+	// Config is the image config
+	Config ImageConfig `json:"-"`
+}
+
+// OCIArchive is a tarball of an OCI image layout, like the image.tar written
+// by [BuildAndPush]. Only the index is read when the archive is opened, the
+// manifests and configs are read from the tarball when they are referenced
+// and kept in memory. Layers are only streamed, see [OCIArchive.walkLayers].
+type OCIArchive struct {
+	path  string
+	blobs map[string][]byte
+	index index
+}
+
+// ReadOCIArchive reads the index of the OCI image layout in the tarball
+func ReadOCIArchive(archive string) (*OCIArchive, error) {
+	result := &OCIArchive{path: archive, blobs: map[string][]byte{}}
+	found, err := result.readEntry("index.json", func(reader io.Reader, _ *tar.Header) error {
+		err := json.NewDecoder(reader).Decode(&result.index)
+		if err != nil {
+			return fmt.Errorf("%s: index.json: %w", archive, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("%s: index.json not found", archive)
+	}
+	return result, nil
+}
+
+// readEntry calls read with the first regular file named name in the
+// tarball. The content of other files is skipped, not read. Returns false if
+// there is no such file.
+func (a *OCIArchive) readEntry(name string, read func(reader io.Reader, header *tar.Header) error) (bool, error) {
+	file, err := os.Open(a.path)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	reader := tar.NewReader(file)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", a.path, err)
+		}
+		if path.Clean(header.Name) == name && header.Typeflag == tar.TypeReg {
+			return true, read(reader, header)
+		}
+	}
+}
+
+// blob returns the content of a JSON blob, it is read from the tarball the
+// first time
+func (a *OCIArchive) blob(digest string) ([]byte, error) {
+	if content, ok := a.blobs[digest]; ok {
+		return content, nil
+	}
+	alg, hash, ok := strings.Cut(digest, ":")
+	if !ok {
+		return nil, fmt.Errorf("%s: invalid digest %s", a.path, digest)
+	}
+	var content []byte
+	found, err := a.readEntry(path.Join("blobs", alg, hash), func(reader io.Reader, header *tar.Header) error {
+		if header.Size > maxJSONBlobSize {
+			return fmt.Errorf("%s: blob %s is larger than %d bytes", a.path, digest, maxJSONBlobSize)
+		}
+		var err error
+		content, err = io.ReadAll(reader)
+		if err != nil {
+			return fmt.Errorf("%s: %w", a.path, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("%s: blob %s not found", a.path, digest)
+	}
+	a.blobs[digest] = content
+	return content, nil
+}
+
+// blobDigest returns the digest of a blob from its path, blobs/<alg>/<hash>
+func blobDigest(name string) string {
+	parts := strings.Split(name, "/")
+	return fmt.Sprintf("%s:%s", parts[len(parts)-2], parts[len(parts)-1])
+}
+
+// Platforms returns the images by platform, attestation manifests are not
+// images
+func (a *OCIArchive) Platforms() (map[string]PlatformImage, error) {
+	result := map[string]PlatformImage{}
+	err := a.addPlatforms(a.index.Manifests, result)
+	if err != nil {
+		return nil, err
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("%s: no image manifests found", a.path)
+	}
+	return result, nil
+}
+
+func (a *OCIArchive) addPlatforms(descriptors []Descriptor, result map[string]PlatformImage) error {
+	for _, descriptor := range descriptors {
+		if descriptor.Annotations[referenceTypeAnnotation] == "attestation-manifest" {
+			continue
+		}
+		if descriptor.MediaType == mediaTypeOCIIndex || descriptor.MediaType == mediaTypeDockerManifestList {
+			var nested index
+			err := a.decode(descriptor.Digest, &nested)
+			if err != nil {
+				return err
+			}
+			err = a.addPlatforms(nested.Manifests, result)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		image := PlatformImage{Digest: descriptor.Digest}
+		err := a.decode(descriptor.Digest, &image.Manifest)
+		if err != nil {
+			return err
+		}
+		err = a.decode(image.Manifest.Config.Digest, &image.Config)
+		if err != nil {
+			return err
+		}
+		image.Size = image.Manifest.Config.Size
+		for _, layer := range image.Manifest.Layers {
+			image.Size += layer.Size
+		}
+		platform := image.Config.OCIPlatform
+		if descriptor.Platform != nil {
+			platform = *descriptor.Platform
+		}
+		result[platform.String()] = image
+	}
+	return nil
+}
+
+// decode decodes a JSON blob
+func (a *OCIArchive) decode(digest string, v any) error {
+	content, err := a.blob(digest)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(content, v)
+	if err != nil {
+		return fmt.Errorf("%s: blob %s: %w", a.path, digest, err)
+	}
+	return nil
+}
+
+// Size returns the compressed size of the configs and the layers of all
+// platforms in bytes, blobs shared by platforms are counted once
+func Size(platforms map[string]PlatformImage) int64 {
+	seen := []string{}
+	var size int64
+	for _, image := range platforms {
+		for _, descriptor := range append([]Descriptor{image.Manifest.Config}, image.Manifest.Layers...) {
+			if slices.Contains(seen, descriptor.Digest) {
+				continue
+			}
+			seen = append(seen, descriptor.Digest)
+			size += descriptor.Size
+		}
+	}
+	return size
+}
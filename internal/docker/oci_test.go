@@ -0,0 +1,169 @@
+package docker_test
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/coopnorge/mage/internal/docker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ociBlobs builds the blobs of an OCI image layout
+type ociBlobs map[string][]byte
+
+func (b ociBlobs) add(t *testing.T, mediaType string, content any) docker.Descriptor {
+	t.Helper()
+	data, ok := content.([]byte)
+	if !ok {
+		var err error
+		data, err = json.Marshal(content)
+		require.NoError(t, err)
+	}
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+	b[digest] = data
+	return docker.Descriptor{MediaType: mediaType, Digest: digest, Size: int64(len(data))}
+}
+
+// writeOCIArchive writes the blobs and index.json to a tarball like buildx
+// does with --output type=oci
+func writeOCIArchive(t *testing.T, blobs ociBlobs, manifests ...docker.Descriptor) string {
+	t.Helper()
+	archive := filepath.Join(t.TempDir(), "image.tar")
+	file, err := os.Create(archive)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, file.Close())
+	}()
+	writer := tar.NewWriter(file)
+
+	write := func(name string, content []byte) {
+		require.NoError(t, writer.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		_, err := writer.Write(content)
+		require.NoError(t, err)
+	}
+	write("oci-layout", []byte(`{"imageLayoutVersion":"1.0.0"}`))
+	for digest, content := range blobs {
+		write(fmt.Sprintf("blobs/sha256/%s", digest[len("sha256:"):]), content)
+	}
+	index, err := json.Marshal(map[string]any{"schemaVersion": 2, "manifests": manifests})
+	require.NoError(t, err)
+	write("index.json", index)
+	require.NoError(t, writer.Close())
+	return archive
+}
+
+// imageManifest adds the config, the layers and the manifest of a platform
+func imageManifest(t *testing.T, blobs ociBlobs, platform docker.OCIPlatform, layers ...[]byte) docker.Descriptor {
+	t.Helper()
+	return configuredImageManifest(t, blobs, map[string]any{
+		"os":           platform.OS,
+		"architecture": platform.Architecture,
+		"config":       map[string]any{"User": "app:app"},
+	}, layers...)
+}
+
+// configuredImageManifest adds the image config, the layers and the manifest
+// of a platform
+func configuredImageManifest(t *testing.T, blobs ociBlobs, imageConfig map[string]any, layers ...[]byte) docker.Descriptor {
+	t.Helper()
+	config := blobs.add(t, "application/vnd.oci.image.config.v1+json", imageConfig)
+	layerDescriptors := []docker.Descriptor{}
+	for _, layer := range layers {
+		layerDescriptors = append(layerDescriptors, blobs.add(t, "application/vnd.oci.image.layer.v1.tar+gzip", layer))
+	}
+	return blobs.add(t, "application/vnd.oci.image.manifest.v1+json", map[string]any{
+		"schemaVersion": 2,
+		"config":        config,
+		"layers":        layerDescriptors,
+	})
+}
+
+func TestOCIArchivePlatforms(t *testing.T) {
+	blobs := ociBlobs{}
+	base := []byte("shared base layer")
+	amd64 := imageManifest(t, blobs, docker.OCIPlatform{OS: "linux", Architecture: "amd64"}, base, []byte("amd64 binary"))
+	amd64.Platform = &docker.OCIPlatform{OS: "linux", Architecture: "amd64"}
+	arm64 := imageManifest(t, blobs, docker.OCIPlatform{OS: "linux", Architecture: "arm64"}, base, []byte("arm64 binary!"))
+	arm64.Platform = &docker.OCIPlatform{OS: "linux", Architecture: "arm64"}
+	attestation := imageManifest(t, blobs, docker.OCIPlatform{OS: "unknown", Architecture: "unknown"}, []byte("provenance"))
+	attestation.Platform = &docker.OCIPlatform{OS: "unknown", Architecture: "unknown"}
+	attestation.Annotations = map[string]string{"vnd.docker.reference.type": "attestation-manifest"}
+	imageIndex := blobs.add(t, "application/vnd.oci.image.index.v1+json", map[string]any{
+		"schemaVersion": 2,
+		"manifests":     []docker.Descriptor{amd64, arm64, attestation},
+	})
+
+	t.Run("multi-platform image", func(t *testing.T) {
+		archive, err := docker.ReadOCIArchive(writeOCIArchive(t, blobs, imageIndex))
+		require.NoError(t, err)
+		got, err := archive.Platforms()
+		require.NoError(t, err)
+
+		assert.Len(t, got, 2)
+		assert.Equal(t, amd64.Digest, got["linux/amd64"].Digest)
+		assert.Equal(t, arm64.Digest, got["linux/arm64"].Digest)
+		amd64Config := got["linux/amd64"].Manifest.Config.Size
+		assert.Equal(t, amd64Config+int64(len(base))+int64(len("amd64 binary")), got["linux/amd64"].Size)
+		assert.Equal(t, "app:app", got["linux/arm64"].Config.Config.User)
+
+		arm64Config := got["linux/arm64"].Manifest.Config.Size
+		want := amd64Config + arm64Config + int64(len(base)) + int64(len("amd64 binary")) + int64(len("arm64 binary!"))
+		assert.Equal(t, want, docker.Size(got))
+	})
+
+	t.Run("single platform image without platform in the index", func(t *testing.T) {
+		single := amd64
+		single.Platform = nil
+		archive, err := docker.ReadOCIArchive(writeOCIArchive(t, blobs, single))
+		require.NoError(t, err)
+		got, err := archive.Platforms()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"linux/amd64"}, keys(got))
+	})
+
+	t.Run("missing blob", func(t *testing.T) {
+		missing := docker.Descriptor{MediaType: "application/vnd.oci.image.manifest.v1+json", Digest: "sha256:0000"}
+		archive, err := docker.ReadOCIArchive(writeOCIArchive(t, ociBlobs{}, missing))
+		require.NoError(t, err)
+		_, err = archive.Platforms()
+		assert.ErrorContains(t, err, "blob sha256:0000 not found")
+	})
+
+	t.Run("manifest too large to read", func(t *testing.T) {
+		large := ociBlobs{}
+		manifest := large.add(t, "application/vnd.oci.image.manifest.v1+json", make([]byte, 4<<20+1))
+		archive, err := docker.ReadOCIArchive(writeOCIArchive(t, large, manifest))
+		require.NoError(t, err)
+		_, err = archive.Platforms()
+		assert.ErrorContains(t, err, fmt.Sprintf("blob %s is larger than 4194304 bytes", manifest.Digest))
+	})
+
+	t.Run("not an OCI archive", func(t *testing.T) {
+		_, err := docker.ReadOCIArchive(writeOCIArchiveWithoutIndex(t))
+		assert.ErrorContains(t, err, "index.json not found")
+	})
+}
+
+func writeOCIArchiveWithoutIndex(t *testing.T) string {
+	t.Helper()
+	archive := filepath.Join(t.TempDir(), "image.tar")
+	file, err := os.Create(archive)
+	require.NoError(t, err)
+	require.NoError(t, tar.NewWriter(file).Close())
+	require.NoError(t, file.Close())
+	return archive
+}
+
+func keys[V any](m map[string]V) []string {
+	result := []string{}
+	for k := range m {
+		result = append(result, k)
+	}
+	return result
+}
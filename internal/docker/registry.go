@@ -0,0 +1,359 @@
+package docker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/magefile/mage/sh"
+)
+
+const (
+	// registryImage is the image of the local registry
+	registryImage = "docker.io/library/registry:2"
+	// registryStartTimeout is how long to wait for the local registry
+	registryStartTimeout = 30 * time.Second
+)
+
+// manifestMediaTypes are accepted when fetching manifests
+var manifestMediaTypes = []string{
+	mediaTypeOCIIndex,
+	mediaTypeDockerManifestList,
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// Registry is a client of the OCI distribution API of a registry. Public
+// repositories are read with anonymous bearer tokens, like on Docker Hub and
+// ghcr.io, registries without authentication like a [LocalRegistry] are read
+// directly.
+type Registry struct {
+	// URL is the base URL of the registry, like http://localhost:5000
+	URL    string
+	client *http.Client
+	// tokens are the bearer tokens by repository
+	tokens map[string]string
+}
+
+// NewRegistry returns a client of the registry at the base URL
+func NewRegistry(url string) *Registry {
+	return &Registry{URL: strings.TrimSuffix(url, "/"), client: &http.Client{Timeout: 30 * time.Second}, tokens: map[string]string{}}
+}
+
+// NewRegistryForHost returns a client of the registry of images on the host,
+// see [ImageReference]
+func NewRegistryForHost(host string) *Registry {
+	switch {
+	case host == dockerHub:
+		return NewRegistry("https://registry-1.docker.io")
+	case host == "localhost" || strings.HasPrefix(host, "localhost:") || strings.HasPrefix(host, "127.0.0.1:"):
+		return NewRegistry("http://" + host)
+	default:
+		return NewRegistry("https://" + host)
+	}
+}
+
+// Host returns the host of the registry used in image names
+func (r *Registry) Host() string {
+	_, host, _ := strings.Cut(r.URL, "://")
+	return host
+}
+
+// do sends the request for the repository, when the registry requires a
+// bearer token an anonymous token to pull the repository is requested and
+// the request is sent again
+func (r *Registry) do(method, url, repository string, header http.Header) (*http.Response, error) {
+	request := func(token string) (*http.Response, error) {
+		request, err := http.NewRequest(method, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		for key, values := range header {
+			request.Header[key] = values
+		}
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+		return r.client.Do(request)
+	}
+
+	response, err := request(r.tokens[repository])
+	if err != nil || response.StatusCode != http.StatusUnauthorized {
+		return response, err
+	}
+	challenge := bearerChallenge(response.Header.Get("WWW-Authenticate"))
+	_ = response.Body.Close()
+	if challenge["realm"] == "" {
+		return nil, fmt.Errorf("%s %s: %s", method, url, response.Status)
+	}
+	token, err := r.token(challenge)
+	if err != nil {
+		return nil, err
+	}
+	r.tokens[repository] = token
+	return request(token)
+}
+
+// token requests an anonymous bearer token for the challenge
+func (r *Registry) token(challenge map[string]string) (string, error) {
+	query := url.Values{}
+	for _, key := range []string{"service", "scope"} {
+		if challenge[key] != "" {
+			query.Set(key, challenge[key])
+		}
+	}
+	response, err := r.client.Get(fmt.Sprintf("%s?%s", challenge["realm"], query.Encode()))
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token of %s: %s", challenge["realm"], response.Status)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	err = json.NewDecoder(response.Body).Decode(&token)
+	if err != nil {
+		return "", fmt.Errorf("token of %s: %w", challenge["realm"], err)
+	}
+	if token.Token != "" {
+		return token.Token, nil
+	}
+	return token.AccessToken, nil
+}
+
+// bearerChallenge returns the parameters of a WWW-Authenticate header, like
+// Bearer realm="https://auth.docker.io/token",service="registry.docker.io"
+func bearerChallenge(header string) map[string]string {
+	params := map[string]string{}
+	_, header, _ = strings.Cut(header, "Bearer ")
+	for _, match := range challengeParam.FindAllStringSubmatch(header, -1) {
+		params[match[1]] = match[2]
+	}
+	return params
+}
+
+var challengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// Tags returns the tags of the repository
+func (r *Registry) Tags(repository string) ([]string, error) {
+	result := []string{}
+	next := fmt.Sprintf("%s/v2/%s/tags/list", r.URL, repository)
+	for next != "" {
+		response, err := r.do(http.MethodGet, next, repository, nil)
+		if err != nil {
+			return nil, err
+		}
+		if response.StatusCode != http.StatusOK {
+			_ = response.Body.Close()
+			return nil, fmt.Errorf("tags of %s: %s", repository, response.Status)
+		}
+		var tags struct {
+			Tags []string `json:"tags"`
+		}
+		err = json.NewDecoder(response.Body).Decode(&tags)
+		_ = response.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("tags of %s: %w", repository, err)
+		}
+		result = append(result, tags.Tags...)
+		next = nextPage(r.URL, response.Header.Get("Link"))
+	}
+	return result, nil
+}
+
+// nextPage returns the URL of the next page in a Link header, like
+// </v2/library/alpine/tags/list?last=3.20&n=100>; rel="next"
+func nextPage(base, link string) string {
+	target, rel, ok := strings.Cut(link, ";")
+	if !ok || !strings.Contains(rel, `rel="next"`) {
+		return ""
+	}
+	target = strings.Trim(strings.TrimSpace(target), "<>")
+	if strings.HasPrefix(target, "/") {
+		return base + target
+	}
+	return target
+}
+
+// ManifestDigest returns the digest of the manifest or the index of the
+// repository referenced by a tag or a digest
+func (r *Registry) ManifestDigest(repository, reference string) (string, error) {
+	header := http.Header{"Accept": {strings.Join(manifestMediaTypes, ", ")}}
+	response, err := r.do(http.MethodHead, fmt.Sprintf("%s/v2/%s/manifests/%s", r.URL, repository, reference), repository, header)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	_, _ = io.Copy(io.Discard, response.Body)
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("manifest %s:%s: %s", repository, reference, response.Status)
+	}
+	digest := response.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", fmt.Errorf("manifest %s:%s: no Docker-Content-Digest header", repository, reference)
+	}
+	return digest, nil
+}
+
+// VerifyImages checks that every built image in oci-images.json is in the
+// registry: all tags reference the digest of the image and the manifests of
+// all platforms exist. Skipped images are not pushed and not checked.
+func (r *Registry) VerifyImages(images AppImages) error {
+	errs := []error{}
+	checked := 0
+	for _, app := range sortedKeys(images) {
+		for _, binary := range sortedKeys(images[app]) {
+			image := images[app][binary]
+			if image.Skipped {
+				continue
+			}
+			checked++
+			repository, _ := splitImageName(image.Image)
+			host, repository, ok := strings.Cut(repository, "/")
+			if !ok || host != r.Host() {
+				errs = append(errs, fmt.Errorf("%s/%s: %s is not in %s", app, binary, image.Image, r.Host()))
+				continue
+			}
+			errs = append(errs, r.verifyImage(repository, image))
+		}
+	}
+	if checked == 0 {
+		return fmt.Errorf("no built images to verify")
+	}
+	return errors.Join(errs...)
+}
+
+func (r *Registry) verifyImage(repository string, image BinaryImage) error {
+	pushedTags, err := r.Tags(repository)
+	if err != nil {
+		return err
+	}
+	errs := []error{}
+	for _, tag := range strings.Split(image.Tags, ",") {
+		if !slices.Contains(pushedTags, tag) {
+			errs = append(errs, fmt.Errorf("%s: tag %s not pushed", repository, tag))
+			continue
+		}
+		digest, err := r.ManifestDigest(repository, tag)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if image.Digest != "" && digest != image.Digest {
+			errs = append(errs, fmt.Errorf("%s:%s: digest %s, want %s", repository, tag, digest, image.Digest))
+		}
+	}
+	for _, platform := range sortedKeys(image.Platforms) {
+		_, err := r.ManifestDigest(repository, image.Platforms[platform].Digest)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", platform, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// LocalRegistry is a throwaway registry container and a buildx builder on
+// the host network that can push to it
+type LocalRegistry struct {
+	*Registry
+	container string
+	builder   string
+}
+
+// StartLocalRegistry starts a registry container on a random port of
+// localhost and a buildx builder for it, see [LocalRegistry.Env]. Stop it
+// with [LocalRegistry.Stop].
+func StartLocalRegistry() (*LocalRegistry, error) {
+	container, err := sh.Output("docker", "run", "--detach", "--rm", "--publish", "127.0.0.1::5000", registryImage)
+	if err != nil {
+		return nil, err
+	}
+	registry := &LocalRegistry{container: container}
+
+	address, err := sh.Output("docker", "port", container, "5000/tcp")
+	if err != nil {
+		return nil, errors.Join(err, registry.Stop())
+	}
+	_, port, ok := strings.Cut(strings.Split(address, "\n")[0], ":")
+	if !ok {
+		return nil, errors.Join(fmt.Errorf("unable to get the port of the registry from %q", address), registry.Stop())
+	}
+	// buildkit pushes to registries on localhost with plain HTTP
+	registry.Registry = NewRegistry(fmt.Sprintf("http://localhost:%s", port))
+
+	registry.builder = fmt.Sprintf("mage-registry-%s", port)
+	err = sh.Run("docker", "buildx", "create", "--name", registry.builder, "--driver", "docker-container", "--driver-opt", "network=host")
+	if err != nil {
+		registry.builder = ""
+		return nil, errors.Join(err, registry.Stop())
+	}
+
+	err = registry.wait()
+	if err != nil {
+		return nil, errors.Join(err, registry.Stop())
+	}
+	return registry, nil
+}
+
+// wait waits until the registry answers
+func (r *LocalRegistry) wait() error {
+	deadline := time.Now().Add(registryStartTimeout)
+	for {
+		response, err := r.client.Get(fmt.Sprintf("%s/v2/", r.URL))
+		if err == nil {
+			_ = response.Body.Close()
+			if response.StatusCode == http.StatusOK {
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("registry %s did not start in %s", r.URL, registryStartTimeout)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// Env returns the environment that pushes every image to the registry with
+// its builder, images are not signed
+func (r *LocalRegistry) Env() map[string]string {
+	return map[string]string{
+		"OCI_IMAGE_BASE":         fmt.Sprintf("%s/coopnorge", r.Host()),
+		"PUSH_IMAGE":             "true",
+		"DOCKER_BUILD_UNCHANGED": "true",
+		"DOCKER_SIGN":            "false",
+		"BUILDX_BUILDER":         r.builder,
+	}
+}
+
+// Stop removes the registry container and the builder
+func (r *LocalRegistry) Stop() error {
+	errs := []error{}
+	if r.builder != "" {
+		errs = append(errs, sh.Run("docker", "buildx", "rm", "--force", r.builder))
+	}
+	errs = append(errs, sh.Run("docker", "rm", "--force", r.container))
+	return errors.Join(errs...)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := []string{}
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
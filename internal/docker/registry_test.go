@@ -0,0 +1,195 @@
+package docker_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/coopnorge/mage/internal/docker"
+	"github.com/magefile/mage/sh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRegistry serves the tags and the manifest digests by repository and
+// reference of the OCI distribution API
+func fakeRegistry(t *testing.T, manifests map[string]map[string]string) *docker.Registry {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/v2/")
+		if repository, ok := strings.CutSuffix(path, "/tags/list"); ok {
+			tags := []string{}
+			for reference := range manifests[repository] {
+				if !strings.HasPrefix(reference, "sha256:") {
+					tags = append(tags, reference)
+				}
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"name": repository, "tags": tags})
+			return
+		}
+		repository, reference, ok := strings.Cut(path, "/manifests/")
+		digest, found := manifests[repository][reference]
+		if !ok || !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", digest)
+	}))
+	t.Cleanup(server.Close)
+	return docker.NewRegistry(server.URL)
+}
+
+func TestRegistryVerifyImages(t *testing.T) {
+	index := "sha256:94c49256e2dec5add85c669fe7498aa93e188ebffb6c0c8ec4fe85105a19abdb"
+	amd64 := "sha256:5f0b6c1f5f0b6c1f5f0b6c1f5f0b6c1f5f0b6c1f5f0b6c1f5f0b6c1f5f0b6c1f"
+	registry := fakeRegistry(t, map[string]map[string]string{
+		"coopnorge/app1/binary1": {
+			"v2025.03.11135857": index,
+			"feature-login":     index,
+			index:               index,
+			amd64:               amd64,
+		},
+	})
+	image := func(repository, tags, digest string, platforms ...string) docker.BinaryImage {
+		result := docker.BinaryImage{
+			Image:     fmt.Sprintf("%s/%s:%s", registry.Host(), repository, strings.Split(tags, ",")[0]),
+			Tags:      tags,
+			Digest:    digest,
+			Platforms: map[string]docker.PlatformImage{},
+		}
+		for _, platform := range platforms {
+			name, digest, _ := strings.Cut(platform, "=")
+			result.Platforms[name] = docker.PlatformImage{Digest: digest}
+		}
+		return result
+	}
+
+	tests := []struct {
+		name   string
+		images docker.AppImages
+		errMsg []string
+	}{
+		{
+			name: "pushed",
+			images: docker.AppImages{"app1": {
+				"binary1": image("coopnorge/app1/binary1", "v2025.03.11135857,feature-login", index, "linux/amd64="+amd64),
+			}},
+		},
+		{
+			name: "skipped images are not verified",
+			images: docker.AppImages{"app1": {
+				"binary1": image("coopnorge/app1/binary1", "v2025.03.11135857", index),
+				"binary2": {Image: "ocreg.invalid/coopnorge/app1/binary2:v2025.03.10120000", Skipped: true},
+			}},
+		},
+		{
+			name: "missing tag",
+			images: docker.AppImages{"app1": {
+				"binary1": image("coopnorge/app1/binary1", "v2025.03.11135857,v1.2.3", index),
+			}},
+			errMsg: []string{"coopnorge/app1/binary1: tag v1.2.3 not pushed"},
+		},
+		{
+			name: "tag of another digest",
+			images: docker.AppImages{"app1": {
+				"binary1": image("coopnorge/app1/binary1", "v2025.03.11135857", amd64),
+			}},
+			errMsg: []string{fmt.Sprintf("coopnorge/app1/binary1:v2025.03.11135857: digest %s, want %s", index, amd64)},
+		},
+		{
+			name: "missing platform manifest",
+			images: docker.AppImages{"app1": {
+				"binary1": image("coopnorge/app1/binary1", "v2025.03.11135857", index, "linux/arm64=sha256:0000"),
+			}},
+			errMsg: []string{"linux/arm64: manifest coopnorge/app1/binary1:sha256:0000: 404 Not Found"},
+		},
+		{
+			name: "image in another registry",
+			images: docker.AppImages{"app1": {
+				"binary1": {Image: "ocreg.invalid/coopnorge/app1/binary1:v2025.03.11135857", Tags: "v2025.03.11135857"},
+			}},
+			errMsg: []string{fmt.Sprintf("app1/binary1: ocreg.invalid/coopnorge/app1/binary1:v2025.03.11135857 is not in %s", registry.Host())},
+		},
+		{
+			name: "no built images",
+			images: docker.AppImages{"app1": {
+				"binary1": {Image: "ocreg.invalid/coopnorge/app1/binary1:v2025.03.10120000", Skipped: true},
+			}},
+			errMsg: []string{"no built images to verify"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := registry.VerifyImages(tt.images)
+			if len(tt.errMsg) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			for _, errMsg := range tt.errMsg {
+				assert.ErrorContains(t, err, errMsg)
+			}
+		})
+	}
+}
+
+func TestLocalRegistry(t *testing.T) {
+	if testing.Short() {
+		t.Skip("needs a docker daemon")
+	}
+	if _, err := exec.LookPath("docker"); err != nil {
+		t.Skip("needs docker")
+	}
+	registry, err := docker.StartLocalRegistry()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, registry.Stop())
+	})
+
+	t.Chdir(t.TempDir())
+	for k, v := range registry.Env() {
+		t.Setenv(k, v)
+	}
+	for _, command := range []string{
+		"git init",
+		"git config user.email test@example.com",
+		"git config user.name test",
+		"git remote add origin https://github.com/coopnorge/helloworld.git",
+		"git commit --allow-empty -m initial",
+	} {
+		args := strings.Split(command, " ")
+		require.NoError(t, sh.Run(args[0], args[1:]...))
+	}
+	require.NoError(t, os.WriteFile("hello.txt", []byte("hello"), 0o644))
+	dockerfile := strings.Join([]string{
+		"FROM scratch",
+		"ARG APP",
+		"ARG BINARY",
+		"ARG GIT_COMMIT_SHA",
+		"COPY hello.txt /hello.txt",
+	}, "\n")
+
+	image, err := docker.FullyQualifiedlImageName("app1", "binary1")
+	require.NoError(t, err)
+	imageDir := filepath.Join("var", "app1", "oci", "binary1")
+	err = docker.BuildAndPush(dockerfile, "linux/amd64,linux/arm64", image, ".", filepath.Join(imageDir, "image.tar"), filepath.Join(imageDir, "metadata.json"), "app1", "binary1", true)
+	require.NoError(t, err)
+
+	images, err := docker.Images("var")
+	require.NoError(t, err)
+	pushed := images["app1"]["binary1"]
+	assert.ElementsMatch(t, []string{"linux/amd64", "linux/arm64"}, keys(pushed.Platforms))
+	assert.NoError(t, registry.VerifyImages(images))
+
+	tags, err := registry.Tags("coopnorge/app1/binary1")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, strings.Split(pushed.Tags, ","), tags)
+	digest, err := registry.ManifestDigest("coopnorge/app1/binary1", pushed.Tag)
+	require.NoError(t, err)
+	assert.Equal(t, pushed.Digest, digest)
+}
@@ -0,0 +1,220 @@
+package docker
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/coopnorge/mage/internal/core"
+	"github.com/coopnorge/mage/internal/devtool"
+	"github.com/coopnorge/mage/internal/git"
+)
+
+const (
+	// githubOIDCIssuer issues the identity tokens of GitHub Actions used for
+	// keyless signing
+	githubOIDCIssuer = "https://token.actions.githubusercontent.com"
+	// provenanceType is the cosign attestation type of [Provenance]
+	provenanceType = "slsaprovenance1"
+	// buildType describes how the image is built from the build arguments
+	buildType = "https://github.com/coopnorge/mage/docker-build@v1"
+)
+
+var cosign devtool.Cosign
+
+// Provenance is a SLSA v1 provenance predicate of an image, see
+// https://slsa.dev/spec/v1.0/provenance
+type Provenance struct {
+	BuildDefinition BuildDefinition `json:"buildDefinition"`
+	RunDetails      RunDetails      `json:"runDetails"`
+}
+
+// BuildDefinition describes the inputs of the build
+type BuildDefinition struct {
+	BuildType string `json:"buildType"`
+	// ExternalParameters are the build arguments of the image
+	ExternalParameters   map[string]string    `json:"externalParameters"`
+	ResolvedDependencies []ResourceDescriptor `json:"resolvedDependencies"`
+}
+
+// ResourceDescriptor is an artifact used by the build
+type ResourceDescriptor struct {
+	URI    string            `json:"uri"`
+	Digest map[string]string `json:"digest"`
+}
+
+// RunDetails describes the builder and the run of the build
+type RunDetails struct {
+	Builder  Builder       `json:"builder"`
+	Metadata BuildMetadata `json:"metadata"`
+}
+
+// Builder is the identity of the builder
+type Builder struct {
+	ID string `json:"id"`
+}
+
+// BuildMetadata identifies the run of the build
+type BuildMetadata struct {
+	InvocationID string `json:"invocationId,omitempty"`
+	StartedOn    string `json:"startedOn"`
+}
+
+// NewProvenance returns the provenance of an image built from the commit of
+// the repository with the build arguments of [BuildAndPush]. In GitHub Actions
+// the builder is the workflow and the invocation is the workflow run.
+func NewProvenance(repoURL, commitSHA, app, binary string, startedOn time.Time) Provenance {
+	builderID := "local"
+	invocationID := ""
+	if workflowRef := os.Getenv("GITHUB_WORKFLOW_REF"); workflowRef != "" {
+		server := os.Getenv("GITHUB_SERVER_URL")
+		builderID = fmt.Sprintf("%s/%s", server, workflowRef)
+		invocationID = fmt.Sprintf("%s/%s/actions/runs/%s/attempts/%s", server, os.Getenv("GITHUB_REPOSITORY"), os.Getenv("GITHUB_RUN_ID"), os.Getenv("GITHUB_RUN_ATTEMPT"))
+	}
+	return Provenance{
+		BuildDefinition: BuildDefinition{
+			BuildType: buildType,
+			ExternalParameters: map[string]string{
+				"GIT_REPOSITORY_URL": repoURL,
+				"GIT_COMMIT_SHA":     commitSHA,
+				"APP":                app,
+				"BINARY":             binary,
+			},
+			ResolvedDependencies: []ResourceDescriptor{
+				{
+					URI:    fmt.Sprintf("git+%s", repoURL),
+					Digest: map[string]string{"gitCommit": commitSHA},
+				},
+			},
+		},
+		RunDetails: RunDetails{
+			Builder: Builder{ID: builderID},
+			Metadata: BuildMetadata{
+				InvocationID: invocationID,
+				StartedOn:    startedOn.UTC().Format(time.RFC3339),
+			},
+		},
+	}
+}
+
+// Sign signs the image by digest with cosign and attests its provenance. The
+// image is signed with docker.sign_key, or keyless with the OIDC token of
+// GitHub Actions.
+func Sign(imageDigest string, provenance Provenance) error {
+	if !strings.Contains(imageDigest, "@sha256:") {
+		return fmt.Errorf("image %s is not referenced by digest", imageDigest)
+	}
+	config, err := core.CurrentConfig()
+	if err != nil {
+		return err
+	}
+	keyArgs := []string{}
+	if config.Docker.SignKey != "" {
+		keyArgs = append(keyArgs, "--key", config.Docker.SignKey)
+	}
+
+	fmt.Printf("Signing %s\n", imageDigest)
+	err = cosign.Run(nil, slices.Concat([]string{"sign", "--yes"}, keyArgs, []string{imageDigest})...)
+	if err != nil {
+		return err
+	}
+
+	content, err := json.MarshalIndent(provenance, "", "  ")
+	if err != nil {
+		return err
+	}
+	predicate, cleanup, err := core.WriteTempFile(core.OutputDir, "provenance.json", string(content))
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	fmt.Printf("Attesting the provenance of %s\n", imageDigest)
+	return cosign.Run(nil, slices.Concat([]string{"attest", "--yes", "--type", provenanceType, "--predicate", predicate}, keyArgs, []string{imageDigest})...)
+}
+
+// Verify verifies the signatures and the provenance of the images in
+// oci-images.json, see [Images]. Signatures are verified with
+// docker.verify_key, or keyless against docker.certificate_identity.
+func Verify(imagesFile string) error {
+	images, err := ReadImages(imagesFile)
+	if err != nil {
+		return err
+	}
+	verifyArgs, err := verifyArgs()
+	if err != nil {
+		return err
+	}
+
+	imageNames := []string{}
+	for _, binaries := range images {
+		for _, image := range binaries {
+			// The digest pins the verified image
+			if image.Reference != "" {
+				imageNames = append(imageNames, image.Reference)
+			} else {
+				imageNames = append(imageNames, image.Image)
+			}
+		}
+	}
+	if len(imageNames) == 0 {
+		return fmt.Errorf("no images in %s", imagesFile)
+	}
+	slices.Sort(imageNames)
+
+	for _, image := range imageNames {
+		fmt.Printf("Verifying %s\n", image)
+		err := cosign.Run(nil, slices.Concat([]string{"verify"}, verifyArgs, []string{image})...)
+		if err != nil {
+			return fmt.Errorf("signature of %s: %w", image, err)
+		}
+		err = cosign.Run(nil, slices.Concat([]string{"verify-attestation", "--type", provenanceType}, verifyArgs, []string{image})...)
+		if err != nil {
+			return fmt.Errorf("provenance of %s: %w", image, err)
+		}
+	}
+	return nil
+}
+
+// verifyArgs returns the arguments of cosign verify for the configured key or
+// keyless identity
+func verifyArgs() ([]string, error) {
+	config, err := core.CurrentConfig()
+	if err != nil {
+		return nil, err
+	}
+	if config.Docker.VerifyKey != "" {
+		return []string{"--key", config.Docker.VerifyKey}, nil
+	}
+	identity := config.Docker.CertificateIdentity
+	if identity == "" {
+		repoURL, err := git.RepoURL()
+		if err != nil {
+			return nil, err
+		}
+		identity, err = ownerIdentity(repoURL)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return []string{
+		"--certificate-identity-regexp", identity,
+		"--certificate-oidc-issuer", githubOIDCIssuer,
+	}, nil
+}
+
+// ownerIdentity returns a regular expression matching the workflows of the
+// owner of the repository. Images are signed by reusable workflows, so the
+// identity is not a workflow of the repository itself.
+func ownerIdentity(repoURL string) (string, error) {
+	parts := strings.Split(strings.TrimSuffix(repoURL, "/"), "/")
+	if len(parts) < 5 {
+		return "", fmt.Errorf("unable to get the owner of %s", repoURL)
+	}
+	owner := strings.Join(parts[:len(parts)-1], "/")
+	return fmt.Sprintf("^%s/", regexp.QuoteMeta(owner)), nil
+}
@@ -0,0 +1,75 @@
+package docker
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewProvenance(t *testing.T) {
+	startedOn := time.Date(2025, 3, 11, 13, 58, 57, 0, time.UTC)
+
+	tests := []struct {
+		name             string
+		env              map[string]string
+		wantBuilderID    string
+		wantInvocationID string
+	}{
+		{
+			name:          "local build",
+			env:           map[string]string{"GITHUB_WORKFLOW_REF": ""},
+			wantBuilderID: "local",
+		},
+		{
+			name: "GitHub Actions",
+			env: map[string]string{
+				"GITHUB_WORKFLOW_REF": "coopnorge/helloworld/.github/workflows/cicd.yaml@refs/heads/main",
+				"GITHUB_SERVER_URL":   "https://github.com",
+				"GITHUB_REPOSITORY":   "coopnorge/helloworld",
+				"GITHUB_RUN_ID":       "1234",
+				"GITHUB_RUN_ATTEMPT":  "2",
+			},
+			wantBuilderID:    "https://github.com/coopnorge/helloworld/.github/workflows/cicd.yaml@refs/heads/main",
+			wantInvocationID: "https://github.com/coopnorge/helloworld/actions/runs/1234/attempts/2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			got := NewProvenance("https://github.com/coopnorge/helloworld", "0f5e8c1d", "helloworld", "server", startedOn)
+
+			assert.Equal(t, map[string]string{
+				"GIT_REPOSITORY_URL": "https://github.com/coopnorge/helloworld",
+				"GIT_COMMIT_SHA":     "0f5e8c1d",
+				"APP":                "helloworld",
+				"BINARY":             "server",
+			}, got.BuildDefinition.ExternalParameters)
+			assert.Equal(t, []ResourceDescriptor{{
+				URI:    "git+https://github.com/coopnorge/helloworld",
+				Digest: map[string]string{"gitCommit": "0f5e8c1d"},
+			}}, got.BuildDefinition.ResolvedDependencies)
+			assert.Equal(t, tt.wantBuilderID, got.RunDetails.Builder.ID)
+			assert.Equal(t, tt.wantInvocationID, got.RunDetails.Metadata.InvocationID)
+
+			content, err := json.Marshal(got)
+			require.NoError(t, err)
+			assert.Contains(t, string(content), `"startedOn":"2025-03-11T13:58:57Z"`)
+		})
+	}
+}
+
+func TestOwnerIdentity(t *testing.T) {
+	got, err := ownerIdentity("https://github.com/coopnorge/helloworld")
+	assert.NoError(t, err)
+	assert.Equal(t, `^https://github\.com/coopnorge/`, got)
+	assert.Regexp(t, got, "https://github.com/coopnorge/mage/.github/workflows/reusable-goapp-build.yaml@refs/heads/main")
+	assert.NotRegexp(t, got, "https://github.com/coopnorge-fork/mage/.github/workflows/reusable-goapp-build.yaml@refs/heads/main")
+
+	_, err = ownerIdentity("https://github.com")
+	assert.Error(t, err)
+}
@@ -0,0 +1,234 @@
+package docker
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/magefile/mage/sh"
+)
+
+// SmokeTest runs an image and checks that it starts, see [SmokeTest.Run]
+type SmokeTest struct {
+	// Args are passed to the binary when HTTPPath is empty
+	Args []string
+	// Entrypoint replaces the entrypoint of the image to run the binary
+	// when HTTPPath is empty, the name of the binary when it is empty
+	Entrypoint string
+	// Env are the environment variables of the container, KEY=VALUE
+	Env []string
+	// HTTPPath is requested on HTTPPort of the container when it is set,
+	// the container runs its default command
+	HTTPPath string
+	// HTTPPort is the port of the container serving HTTPPath
+	HTTPPort int
+	// HTTPStatus is the expected status of HTTPPath
+	HTTPStatus int
+	// Timeout is how long the binary may run or HTTPPath may take to
+	// respond
+	Timeout time.Duration
+}
+
+// SmokeTestResult is the result of the smoke test of an image
+type SmokeTestResult struct {
+	Passed bool `json:"passed"`
+	// Platform is the platform of the image that ran
+	Platform string `json:"platform"`
+	// ExitCode is the exit code of the container if it exited
+	ExitCode *int `json:"exit_code,omitempty"`
+	// HTTPStatus is the last status returned by the HTTP path
+	HTTPStatus int `json:"http_status,omitempty"`
+	// Duration is how long the smoke test took, like 1.2s
+	Duration string `json:"duration"`
+	// Message explains why the smoke test failed
+	Message string `json:"message,omitempty"`
+}
+
+// LoadImage loads the image of the platform in the OCI image layout tarball
+// into docker and returns its name
+func LoadImage(imagePath, platform string) (string, error) {
+	archive, err := ReadOCIArchive(imagePath)
+	if err != nil {
+		return "", err
+	}
+	platforms, err := archive.Platforms()
+	if err != nil {
+		return "", err
+	}
+	if _, ok := platforms[platform]; !ok {
+		return "", fmt.Errorf("%s: no image for %s, found %s", imagePath, platform, strings.Join(sortedKeys(platforms), ", "))
+	}
+	out, err := sh.Output("docker", "load", "--input", imagePath)
+	if err != nil {
+		return "", err
+	}
+	return loadedImage(out)
+}
+
+// loadedImage returns the first image in the output of docker load
+func loadedImage(out string) (string, error) {
+	for _, line := range strings.Split(out, "\n") {
+		for _, prefix := range []string{"Loaded image: ", "Loaded image ID: "} {
+			if image, ok := strings.CutPrefix(strings.TrimSpace(line), prefix); ok {
+				return image, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no image loaded: %s", out)
+}
+
+// Run runs the image of the platform. Without HTTPPath the binary runs as
+// the entrypoint of the container with Args and must exit with 0 within
+// Timeout, the entrypoint and the command of the image are not used. With
+// HTTPPath the container runs its own entrypoint and command and HTTPPath
+// must return HTTPStatus within Timeout. The logs of the container are
+// printed when the smoke test fails.
+func (s SmokeTest) Run(image, binary, platform string) (SmokeTestResult, error) {
+	startedOn := time.Now()
+	container, err := sh.Output("docker", s.runArgs(image, binary, platform)...)
+	if err != nil {
+		return SmokeTestResult{}, err
+	}
+	defer func() {
+		_ = sh.Run("docker", "rm", "--force", container)
+	}()
+
+	var result SmokeTestResult
+	if s.HTTPPath != "" {
+		result, err = s.checkHTTP(container)
+		if err != nil {
+			return SmokeTestResult{}, err
+		}
+	} else {
+		result = s.checkExit(container)
+	}
+	result.Platform = platform
+	result.Duration = time.Since(startedOn).Round(time.Millisecond).String()
+	if !result.Passed {
+		_ = sh.RunV("docker", "logs", container)
+	}
+	return result, nil
+}
+
+// runArgs returns the arguments of docker run for the image
+func (s SmokeTest) runArgs(image, binary, platform string) []string {
+	args := []string{"run", "--detach", "--platform", platform}
+	for _, env := range s.Env {
+		args = append(args, "--env", env)
+	}
+	if s.HTTPPath != "" {
+		return append(args, "--publish", fmt.Sprintf("127.0.0.1::%d", s.HTTPPort), image)
+	}
+	entrypoint := s.Entrypoint
+	if entrypoint == "" {
+		entrypoint = binary
+	}
+	args = append(args, "--entrypoint", entrypoint, image)
+	return append(args, s.Args...)
+}
+
+// checkExit waits for the container to exit with 0
+func (s SmokeTest) checkExit(container string) SmokeTestResult {
+	type exit struct {
+		out string
+		err error
+	}
+	done := make(chan exit, 1)
+	go func() {
+		out, err := sh.Output("docker", "wait", container)
+		done <- exit{out: out, err: err}
+	}()
+
+	select {
+	case exit := <-done:
+		if exit.err != nil {
+			return SmokeTestResult{Message: exit.err.Error()}
+		}
+		return exitResult(exit.out)
+	case <-time.After(s.Timeout):
+		return SmokeTestResult{Message: fmt.Sprintf("did not exit within %s", s.Timeout)}
+	}
+}
+
+// exitResult returns the result of the exit code printed by docker wait
+func exitResult(out string) SmokeTestResult {
+	code, err := strconv.Atoi(strings.TrimSpace(out))
+	if err != nil {
+		return SmokeTestResult{Message: fmt.Sprintf("unexpected exit code %q", out)}
+	}
+	result := SmokeTestResult{ExitCode: &code, Passed: code == 0}
+	if !result.Passed {
+		result.Message = fmt.Sprintf("exited with %d", code)
+	}
+	return result
+}
+
+// checkHTTP requests HTTPPath on the published port of the container
+func (s SmokeTest) checkHTTP(container string) (SmokeTestResult, error) {
+	address, err := sh.Output("docker", "port", container, fmt.Sprintf("%d/tcp", s.HTTPPort))
+	if err != nil {
+		return SmokeTestResult{}, err
+	}
+	url := fmt.Sprintf("http://%s%s", strings.Split(address, "\n")[0], s.HTTPPath)
+	exited := func() (*int, error) {
+		out, err := sh.Output("docker", "inspect", "--format", "{{.State.Running}} {{.State.ExitCode}}", container)
+		if err != nil {
+			return nil, err
+		}
+		state, code, _ := strings.Cut(out, " ")
+		if state == "true" {
+			return nil, nil
+		}
+		exitCode, err := strconv.Atoi(code)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected state of %s: %s", container, out)
+		}
+		return &exitCode, nil
+	}
+	return waitForHTTP(url, s.HTTPStatus, s.Timeout, exited)
+}
+
+// waitForHTTP requests the URL until it returns the status or the timeout
+// expires. exited returns the exit code of the container when it is not
+// running.
+func waitForHTTP(url string, status int, timeout time.Duration, exited func() (*int, error)) (SmokeTestResult, error) {
+	client := &http.Client{Timeout: time.Second}
+	deadline := time.Now().Add(timeout)
+	result := SmokeTestResult{}
+	for {
+		exitCode, err := exited()
+		if err != nil {
+			return SmokeTestResult{}, err
+		}
+		if exitCode != nil {
+			result.ExitCode = exitCode
+			result.Message = fmt.Sprintf("exited with %d before %s returned %d", *exitCode, url, status)
+			return result, nil
+		}
+		response, err := client.Get(url)
+		if err == nil {
+			_ = response.Body.Close()
+			result.HTTPStatus = response.StatusCode
+			if response.StatusCode == status {
+				result.Passed = true
+				return result, nil
+			}
+		}
+		if time.Now().After(deadline) {
+			result.Message = fmt.Sprintf("%s did not return %d within %s", url, status, timeout)
+			if result.HTTPStatus != 0 {
+				result.Message = fmt.Sprintf("%s, last status %d", result.Message, result.HTTPStatus)
+			}
+			return result, nil
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// RecordSmokeTest adds the result of the smoke test to the metadata file, it
+// is listed by [Images]
+func RecordSmokeTest(metadatafile string, result SmokeTestResult) error {
+	return addMetadata(metadatafile, map[string]any{smokeTestKey: result})
+}
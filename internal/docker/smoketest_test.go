@@ -0,0 +1,152 @@
+package docker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadedImage(t *testing.T) {
+	tests := []struct {
+		name   string
+		out    string
+		want   string
+		errMsg string
+	}{
+		{
+			name: "tagged image",
+			out:  "Loaded image: ocreg.invalid/coopnorge/app1/binary1:v2025.03.11135857",
+			want: "ocreg.invalid/coopnorge/app1/binary1:v2025.03.11135857",
+		},
+		{
+			name: "image without a name",
+			out:  "Loaded image ID: sha256:94c49256e2dec5add85c669fe7498aa93e188ebffb6c0c8ec4fe85105a19abdb",
+			want: "sha256:94c49256e2dec5add85c669fe7498aa93e188ebffb6c0c8ec4fe85105a19abdb",
+		},
+		{
+			name: "multiple tags",
+			out:  "Loaded image: ocreg.invalid/coopnorge/app1/binary1:v1.2.0\nLoaded image: ocreg.invalid/coopnorge/app1/binary1:main",
+			want: "ocreg.invalid/coopnorge/app1/binary1:v1.2.0",
+		},
+		{
+			name:   "nothing loaded",
+			out:    "open image.tar: no such file or directory",
+			errMsg: "no image loaded",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loadedImage(tt.out)
+			if tt.errMsg != "" {
+				assert.ErrorContains(t, err, tt.errMsg)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRunArgs(t *testing.T) {
+	tests := []struct {
+		name      string
+		smokeTest SmokeTest
+		want      []string
+	}{
+		{
+			name:      "binary as entrypoint",
+			smokeTest: SmokeTest{Args: []string{"--help"}, Env: []string{"LOG_LEVEL=debug"}},
+			want:      []string{"run", "--detach", "--platform", "linux/amd64", "--env", "LOG_LEVEL=debug", "--entrypoint", "binary1", "image", "--help"},
+		},
+		{
+			name:      "configured entrypoint",
+			smokeTest: SmokeTest{Args: []string{"version", "--short"}, Entrypoint: "/app/binary1"},
+			want:      []string{"run", "--detach", "--platform", "linux/amd64", "--entrypoint", "/app/binary1", "image", "version", "--short"},
+		},
+		{
+			name:      "entrypoint of the image",
+			smokeTest: SmokeTest{Args: []string{"--help"}, Entrypoint: "/app/binary1", HTTPPath: "/healthz", HTTPPort: 8080},
+			want:      []string{"run", "--detach", "--platform", "linux/amd64", "--publish", "127.0.0.1::8080", "image"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.smokeTest.runArgs("image", "binary1", "linux/amd64"))
+		})
+	}
+}
+
+func TestExitResult(t *testing.T) {
+	passed := exitResult("0\n")
+	assert.True(t, passed.Passed)
+	assert.Equal(t, 0, *passed.ExitCode)
+
+	failed := exitResult("2")
+	assert.False(t, failed.Passed)
+	assert.Equal(t, "exited with 2", failed.Message)
+
+	unexpected := exitResult("")
+	assert.False(t, unexpected.Passed)
+	assert.Nil(t, unexpected.ExitCode)
+}
+
+func TestWaitForHTTP(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" || requests.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(server.Close)
+	running := func() (*int, error) { return nil, nil }
+
+	t.Run("eventually healthy", func(t *testing.T) {
+		got, err := waitForHTTP(server.URL+"/healthz", http.StatusOK, 5*time.Second, running)
+		require.NoError(t, err)
+		assert.True(t, got.Passed)
+		assert.Equal(t, http.StatusOK, got.HTTPStatus)
+	})
+
+	t.Run("unexpected status", func(t *testing.T) {
+		got, err := waitForHTTP(server.URL+"/ready", http.StatusOK, 300*time.Millisecond, running)
+		require.NoError(t, err)
+		assert.False(t, got.Passed)
+		assert.Contains(t, got.Message, "/ready did not return 200 within 300ms, last status 503")
+	})
+
+	t.Run("exited container", func(t *testing.T) {
+		exited := func() (*int, error) {
+			code := 1
+			return &code, nil
+		}
+		got, err := waitForHTTP(server.URL+"/healthz", http.StatusOK, 5*time.Second, exited)
+		require.NoError(t, err)
+		assert.False(t, got.Passed)
+		assert.Equal(t, 1, *got.ExitCode)
+		assert.Contains(t, got.Message, "exited with 1 before")
+	})
+}
+
+func TestRecordSmokeTest(t *testing.T) {
+	imageDir := t.TempDir()
+	metadataFile := filepath.Join(imageDir, "app1", "oci", "binary1", "metadata.json")
+	require.NoError(t, os.MkdirAll(filepath.Dir(metadataFile), 0o755))
+	content, err := os.ReadFile(filepath.Join("testdata", "parse-metadata", "good_metadata.json"))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(metadataFile, content, 0o644))
+
+	code := 0
+	result := SmokeTestResult{Passed: true, Platform: "linux/amd64", ExitCode: &code, Duration: "1.2s"}
+	require.NoError(t, RecordSmokeTest(metadataFile, result))
+
+	images, err := Images(imageDir)
+	require.NoError(t, err)
+	assert.Equal(t, &result, images["helloworld"]["helloworld"].SmokeTest)
+}
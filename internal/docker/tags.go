@@ -0,0 +1,115 @@
+package docker
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coopnorge/mage/internal/core"
+	"github.com/coopnorge/mage/internal/git"
+)
+
+const (
+	// TagTimestamp tags the images with the time of the build,
+	// vYYYY.MM.DDhhmmss
+	TagTimestamp = "timestamp"
+	// TagSHA tags the images with the hash of the current commit
+	TagSHA = "sha"
+	// TagSemver tags the images with the nearest semver git tag, see
+	// [git.Describe]
+	TagSemver = "semver"
+	// TagBranch tags the images with the name of the branch, used for
+	// previews of pull requests
+	TagBranch = "branch"
+
+	// maxTagLength is the maximum length of a tag in the OCI distribution
+	// spec
+	maxTagLength = 128
+	// semverTagPattern matches the git tags used by [TagSemver]
+	semverTagPattern = "v[0-9]*.[0-9]*.[0-9]*"
+)
+
+var (
+	tagsOnce sync.Once
+	tags     []string
+	tagsErr  error
+
+	invalidTagChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+)
+
+// Tags returns the tags of the images for the strategies in docker.tags, the
+// first tag is the primary tag. The tags are computed once, so all images of
+// a run get the same tags.
+func Tags() ([]string, error) {
+	tagsOnce.Do(func() {
+		config, err := core.CurrentConfig()
+		if err != nil {
+			tagsErr = err
+			return
+		}
+		tags, tagsErr = tagsFor(config.Docker.Tags, time.Now())
+	})
+	return tags, tagsErr
+}
+
+// tagsFor returns the tags for the strategies without duplicates
+func tagsFor(strategies []string, now time.Time) ([]string, error) {
+	result := []string{}
+	for _, strategy := range strategies {
+		var tag string
+		var err error
+		switch strategy {
+		case TagTimestamp:
+			tag = now.Format("v2006.01.02150405")
+		case TagSHA:
+			tag, err = git.SHA256()
+		case TagSemver:
+			tag, err = git.Describe(semverTagPattern)
+		case TagBranch:
+			tag, err = branch()
+		default:
+			err = fmt.Errorf("unknown tagging strategy %q", strategy)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("tagging strategy %s: %w", strategy, err)
+		}
+		tag = SanitizeTag(tag)
+		if tag == "" {
+			return nil, fmt.Errorf("tagging strategy %s: empty tag", strategy)
+		}
+		if !slices.Contains(result, tag) {
+			result = append(result, tag)
+		}
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no tagging strategies in docker.tags")
+	}
+	return result, nil
+}
+
+// branch returns the name of the branch, the source branch of a pull request
+// in GitHub Actions
+func branch() (string, error) {
+	// GITHUB_HEAD_REF is only set for pull requests
+	for _, env := range []string{"GITHUB_HEAD_REF", "GITHUB_REF_NAME"} {
+		if name := os.Getenv(env); name != "" {
+			return name, nil
+		}
+	}
+	return git.CurrentBranch()
+}
+
+// SanitizeTag replaces the characters that are not allowed in a tag with -
+// and shortens it to the maximum length of a tag
+func SanitizeTag(tag string) string {
+	tag = invalidTagChars.ReplaceAllString(tag, "-")
+	tag = strings.TrimLeft(tag, ".-")
+	if len(tag) > maxTagLength {
+		tag = tag[:maxTagLength]
+	}
+	return tag
+}
@@ -0,0 +1,117 @@
+package docker
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/magefile/mage/sh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTagsFor(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("GITHUB_HEAD_REF", "")
+	t.Setenv("GITHUB_REF_NAME", "")
+	for _, command := range []string{
+		"git init --initial-branch=feature/login",
+		"git config user.email test@example.com",
+		"git config user.name test",
+		"git commit --allow-empty -m initial",
+		"git tag v1.2.3",
+	} {
+		args := strings.Split(command, " ")
+		require.NoError(t, sh.Run(args[0], args[1:]...))
+	}
+	sha, err := sh.Output("git", "rev-parse", "HEAD")
+	require.NoError(t, err)
+	now := time.Date(2025, 3, 11, 13, 58, 57, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		strategies []string
+		env        map[string]string
+		want       []string
+		errMsg     string
+	}{
+		{
+			name:       "timestamp",
+			strategies: []string{TagTimestamp},
+			want:       []string{"v2025.03.11135857"},
+		},
+		{
+			name:       "multiple tags in order",
+			strategies: []string{TagSemver, TagSHA, TagTimestamp},
+			want:       []string{"v1.2.3", sha, "v2025.03.11135857"},
+		},
+		{
+			name:       "branch",
+			strategies: []string{TagBranch},
+			want:       []string{"feature-login"},
+		},
+		{
+			name:       "branch of a pull request",
+			strategies: []string{TagBranch, TagTimestamp},
+			env:        map[string]string{"GITHUB_HEAD_REF": "renovate/golang.org/x/net"},
+			want:       []string{"renovate-golang.org-x-net", "v2025.03.11135857"},
+		},
+		{
+			name:       "duplicate tags",
+			strategies: []string{TagSHA, TagSHA},
+			want:       []string{sha},
+		},
+		{
+			name:       "unknown strategy",
+			strategies: []string{"date"},
+			errMsg:     `unknown tagging strategy "date"`,
+		},
+		{
+			name:   "no strategies",
+			errMsg: "no tagging strategies in docker.tags",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			got, err := tagsFor(tt.strategies, now)
+			if tt.errMsg != "" {
+				assert.ErrorContains(t, err, tt.errMsg)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	t.Run("semver after the tag", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(filepath.Join(".", "main.go"), []byte("package main\n"), 0o644))
+		require.NoError(t, sh.Run("git", "add", "main.go"))
+		require.NoError(t, sh.Run("git", "commit", "-m", "main"))
+		got, err := tagsFor([]string{TagSemver}, now)
+		assert.NoError(t, err)
+		assert.Len(t, got, 1)
+		assert.Regexp(t, `^v1\.2\.3-1-g[0-9a-f]+$`, got[0])
+	})
+}
+
+func TestSanitizeTag(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want string
+	}{
+		{tag: "v2025.03.11135857", want: "v2025.03.11135857"},
+		{tag: "feature/login", want: "feature-login"},
+		{tag: "-.fix", want: "fix"},
+		{tag: strings.Repeat("a", 130), want: strings.Repeat("a", 128)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			assert.Equal(t, tt.want, SanitizeTag(tt.tag))
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package docker
+
+import (
+	"fmt"
+	"path"
+	"slices"
+)
+
+// PreviousImage is the image of a binary in a previous release
+type PreviousImage struct {
+	Image  string
+	Digest string
+}
+
+// UnchangedImages finds the images of previous releases for the binaries
+// without changes since the last release, see [UnchangedImages.Find]
+type UnchangedImages struct {
+	// Binaries are the binaries by app
+	Binaries map[string][]string
+	// ChangedFiles returns the files changed since the last release
+	ChangedFiles func() ([]string, error)
+	// Affected returns the binaries by app affected by the changed files
+	Affected func(changedFiles []string) (map[string][]string, error)
+	// Dockerfile replaces the embedded Dockerfile of the binaries, every
+	// image is built when it changed
+	Dockerfile string
+	// Releases returns the tags of the most recent releases, the newest
+	// first
+	Releases func() ([]string, error)
+	// ImageName returns the image of a binary without a tag, like
+	// [FullyQualifiedlImageName]
+	ImageName func(app, binary string) (string, error)
+	// Digest returns the digest of an image in its registry, like
+	// [ImageDigest]
+	Digest func(image string) (string, error)
+}
+
+// Find returns the image of the most recent release that has one by app and
+// binary for the binaries that are not affected by the changed files.
+// Binaries without an image in the releases are built. When the changes or
+// the releases can not be detected, or the Dockerfile changed, every image is
+// built and no image is returned.
+func (u UnchangedImages) Find() (map[string]map[string]PreviousImage, error) {
+	images := map[string]map[string]PreviousImage{}
+	changedFiles, err := u.ChangedFiles()
+	if err != nil {
+		fmt.Printf("Unable to detect the changed binaries, building every image: %s\n", err)
+		return images, nil
+	}
+	affected, err := u.Affected(changedFiles)
+	if err != nil {
+		fmt.Printf("Unable to detect the changed binaries, building every image: %s\n", err)
+		return images, nil
+	}
+	if u.Dockerfile != "" && slices.Contains(changedFiles, path.Clean(u.Dockerfile)) {
+		fmt.Printf("%s changed, building every image\n", u.Dockerfile)
+		return images, nil
+	}
+	tags, err := u.Releases()
+	if err != nil {
+		fmt.Printf("Unable to get the releases, building every image: %s\n", err)
+		return images, nil
+	}
+
+	for _, app := range sortedKeys(u.Binaries) {
+		for _, binary := range u.Binaries[app] {
+			if slices.Contains(affected[app], binary) {
+				continue
+			}
+			image, err := u.ImageName(app, binary)
+			if err != nil {
+				return nil, err
+			}
+			for _, tag := range tags {
+				taggedImage := fmt.Sprintf("%s:%s", image, tag)
+				digest, err := u.Digest(taggedImage)
+				if err != nil {
+					continue
+				}
+				if images[app] == nil {
+					images[app] = map[string]PreviousImage{}
+				}
+				images[app][binary] = PreviousImage{Image: taggedImage, Digest: digest}
+				break
+			}
+		}
+	}
+	return images, nil
+}
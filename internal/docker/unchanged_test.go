@@ -0,0 +1,105 @@
+package docker_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/coopnorge/mage/internal/docker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnchangedImagesFind(t *testing.T) {
+	// digests are the images pushed in the releases
+	digests := map[string]string{
+		"ocreg.invalid/coopnorge/app1/binary1:v2025.03.11135857": "sha256:11",
+		"ocreg.invalid/coopnorge/app1/binary2:v2025.03.10120000": "sha256:22",
+		"ocreg.invalid/coopnorge/app2/binary1:v2025.03.11135857": "sha256:31",
+	}
+	releases := []string{"v2025.03.11135857", "v2025.03.10120000"}
+	binaries := map[string][]string{"app1": {"binary1", "binary2", "binary3"}, "app2": {"binary1"}}
+
+	tests := []struct {
+		name         string
+		changedFiles []string
+		changedErr   error
+		affected     map[string][]string
+		dockerfile   string
+		releasesErr  error
+		want         map[string]map[string]docker.PreviousImage
+	}{
+		{
+			name:         "unchanged binaries use the most recent release with an image",
+			changedFiles: []string{"app2/cmd/binary1/main.go"},
+			affected:     map[string][]string{"app2": {"binary1"}},
+			want: map[string]map[string]docker.PreviousImage{
+				"app1": {
+					"binary1": {Image: "ocreg.invalid/coopnorge/app1/binary1:v2025.03.11135857", Digest: "sha256:11"},
+					"binary2": {Image: "ocreg.invalid/coopnorge/app1/binary2:v2025.03.10120000", Digest: "sha256:22"},
+				},
+			},
+		},
+		{
+			name:         "changed Dockerfile builds every image",
+			changedFiles: []string{"build/Dockerfile"},
+			affected:     map[string][]string{},
+			dockerfile:   "./build/Dockerfile",
+			want:         map[string]map[string]docker.PreviousImage{},
+		},
+		{
+			name:         "unchanged Dockerfile",
+			changedFiles: []string{"README.md"},
+			affected:     map[string][]string{"app1": {"binary1", "binary2"}},
+			dockerfile:   "build/Dockerfile",
+			want: map[string]map[string]docker.PreviousImage{
+				"app2": {
+					"binary1": {Image: "ocreg.invalid/coopnorge/app2/binary1:v2025.03.11135857", Digest: "sha256:31"},
+				},
+			},
+		},
+		{
+			name:       "unknown changes build every image",
+			changedErr: errors.New("no release named Go OCI Release found"),
+			want:       map[string]map[string]docker.PreviousImage{},
+		},
+		{
+			name:         "unknown releases build every image",
+			changedFiles: []string{},
+			affected:     map[string][]string{},
+			releasesErr:  errors.New("403 Forbidden"),
+			want:         map[string]map[string]docker.PreviousImage{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unchanged := docker.UnchangedImages{
+				Binaries: binaries,
+				ChangedFiles: func() ([]string, error) {
+					return tt.changedFiles, tt.changedErr
+				},
+				Affected: func(changedFiles []string) (map[string][]string, error) {
+					assert.Equal(t, tt.changedFiles, changedFiles)
+					return tt.affected, nil
+				},
+				Dockerfile: tt.dockerfile,
+				Releases: func() ([]string, error) {
+					return releases, tt.releasesErr
+				},
+				ImageName: func(app, binary string) (string, error) {
+					return fmt.Sprintf("ocreg.invalid/coopnorge/%s/%s", app, binary), nil
+				},
+				Digest: func(image string) (string, error) {
+					digest, ok := digests[image]
+					if !ok {
+						return "", fmt.Errorf("%s: not found", image)
+					}
+					return digest, nil
+				},
+			}
+			got, err := unchanged.Find()
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
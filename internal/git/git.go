@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
@@ -53,102 +54,248 @@ func NormalizeGitURL(rawURL string) (string, error) {
 	return "", fmt.Errorf("unable to parse remote url: %s", rawURL)
 }
 
-// DiffToMain returns a list of files that have been changed
-// compared to the main branch. Files have to be staged or committed.
-func DiffToMain() ([]string, error) {
-	// git diff
-	// --name-only # only list file names
-	// --no-renames # rename of file is shown as delete and add
+const (
+	// remote is the remote the default branch is fetched from
+	remote = "origin"
+	// deepenBy is the number of commits fetched per attempt when the
+	// merge-base is missing in a shallow clone
+	deepenBy = 50
+	// maxDeepen is the number of attempts before the clone is unshallowed
+	maxDeepen = 4
+)
 
-	changedFiles := []string{}
-	changedFilesFromEnv, ok := os.LookupEnv("CHANGED_FILES")
-	if ok {
-		changedFiles = strings.Split(changedFilesFromEnv, ",")
-		return changedFiles, nil
+// DiffToMain returns a list of files that have been changed compared to the
+// merge-base of HEAD and the default branch, so changes made on the default
+// branch after branching are not included. Both sides of renames and
+// uncommitted changes are included, untracked files when
+// git.include_untracked is set.
+func DiffToMain() ([]string, error) {
+	config, err := core.CurrentConfig()
+	if err != nil {
+		return nil, err
 	}
-	// We assume the default branch is main, preferred origin/main. We should
-	// add the ability for adding a specific branch as well.
-	diffBranch := "origin/main"
-	if checkBranch(diffBranch) != nil {
-		diffBranch = "main"
+	if config.IsSet("git.changed_files") {
+		return config.Git.ChangedFiles, nil
 	}
-	if checkBranch(diffBranch) != nil {
-		return changedFiles, fmt.Errorf("unable to find branch %s", diffBranch)
+	ref, err := defaultBranchRef(config.Git.DefaultBranch)
+	if err != nil {
+		return []string{}, err
 	}
-	gitDiff, err := sh.Output("git", "diff", "--name-only", "--no-renames", diffBranch)
+	base, err := mergeBase(ref, config.Git.DefaultBranch)
 	if err != nil {
 		return []string{}, err
 	}
-	changedFiles = append(changedFiles, strings.Split(gitDiff, "\n")...)
-	return changedFiles, nil
+	return diff(base, config.Git.IncludeUntracked)
 }
 
-// DiffToTagPattern returns a list of files that have been changed
-// compared to the most recent tags of a certain pattern.
-func DiffToTagPattern(releasePrefix string) ([]string, error) {
-	// git diff
-	// --name-only # only list file names
-	// --no-renames # rename of file is shown as delete and add
+// DefaultBranchRef returns the ref of the default branch, the remote branch
+// is preferred over the local branch. In a shallow clone without the branch
+// it is fetched.
+func DefaultBranchRef() (string, error) {
+	config, err := core.CurrentConfig()
+	if err != nil {
+		return "", err
+	}
+	return defaultBranchRef(config.Git.DefaultBranch)
+}
 
-	changedFiles := []string{}
+func defaultBranchRef(branch string) (string, error) {
+	remoteRef := fmt.Sprintf("%s/%s", remote, branch)
+	for _, ref := range []string{remoteRef, branch} {
+		if checkBranch(ref) == nil {
+			return ref, nil
+		}
+	}
+	shallow, err := isShallow()
+	if err != nil {
+		return "", err
+	}
+	if shallow {
+		err = sh.Run("git", "fetch", "--depth=1", remote, fmt.Sprintf("+refs/heads/%s:refs/remotes/%s", branch, remoteRef))
+		if err == nil {
+			return remoteRef, nil
+		}
+	}
+	return "", fmt.Errorf("unable to find branch %s or %s", remoteRef, branch)
+}
 
-	changedFilesFromEnv, ok := os.LookupEnv("CHANGED_FILES")
-	if ok {
-		changedFiles = strings.Split(changedFilesFromEnv, ",")
-		return changedFiles, nil
+// mergeBase returns the best common ancestor of ref and HEAD. When it is
+// missing in a shallow clone the history is deepened until it is found.
+func mergeBase(ref, branch string) (string, error) {
+	for attempt := 0; ; attempt++ {
+		base, err := sh.Output("git", "merge-base", ref, "HEAD")
+		if err == nil {
+			return base, nil
+		}
+		shallow, shallowErr := isShallow()
+		if shallowErr != nil {
+			return "", shallowErr
+		}
+		if !shallow {
+			return "", fmt.Errorf("unable to find the merge-base of %s and HEAD: %w", ref, err)
+		}
+		args := []string{"fetch", fmt.Sprintf("--deepen=%d", deepenBy), remote, branch}
+		if attempt >= maxDeepen {
+			args = []string{"fetch", "--unshallow", remote, branch}
+		}
+		err = sh.Run("git", args...)
+		if err != nil {
+			return "", fmt.Errorf("failed to fetch the history of %s: %w", ref, err)
+		}
 	}
+}
 
-	ref := "origin/main"
-	onMain, err := onMainBranch()
+func isShallow() (bool, error) {
+	out, err := sh.Output("git", "rev-parse", "--is-shallow-repository")
 	if err != nil {
-		return nil, fmt.Errorf("failed to check if commit is on main branch: %w", err)
+		return false, err
 	}
+	return out == "true", nil
+}
 
-	if onMain {
-		releaseRef, createdAt, err := github.GetLatestReleaseTagWithPrefix(releasePrefix)
-		if err != nil {
-			return nil, fmt.Errorf("getting releases from github failed: %w", err)
-		}
-		// if no relelease is found, use CHANGES from dorny path filter. next release should
-		// create release.
-		// TODO: implement native model to do changes against github api
-		if releaseRef == "" {
-			changedFilesFromEnv, ok := os.LookupEnv("CHANGES")
-			if !ok {
-				return nil, fmt.Errorf("the environment varariable $CHANGES is required but not found. This is required to detect changes on main")
-			}
-			changedFiles = strings.Split(changedFilesFromEnv, ",")
-			return changedFiles, nil
+// diff returns the files changed in the working tree compared to ref,
+// including both sides of renames
+func diff(ref string, includeUntracked bool) ([]string, error) {
+	// git diff
+	// --name-status # list the status and file names, renames list both
+	// -z # do not quote file names
+	out, err := sh.Output("git", "diff", "--name-status", "-z", ref)
+	if err != nil {
+		return nil, err
+	}
+	changedFiles := []string{}
+	fields := strings.Split(out, "\x00")
+	for i := 0; i < len(fields); i++ {
+		status := fields[i]
+		if status == "" {
+			continue
 		}
-		ref = releaseRef
-		currentCommit, err := getTimeStampOfCurrentCommit()
+		// renames and copies are followed by the source and the
+		// destination, other changes by the file
+		files := 1
+		if strings.HasPrefix(status, "R") || strings.HasPrefix(status, "C") {
+			files = 2
+		}
+		for j := 0; j < files && i+1 < len(fields); j++ {
+			i++
+			changedFiles = append(changedFiles, fields[i])
+		}
+	}
+	if includeUntracked {
+		untracked, err := sh.Output("git", "ls-files", "--others", "--exclude-standard", "-z")
 		if err != nil {
-			return nil, fmt.Errorf("failed to get timetamp of current commit: %w ", err)
+			return nil, err
 		}
-		if currentCommit.Before(createdAt) || currentCommit.Equal(createdAt) {
-			return nil, fmt.Errorf("current commit creation date (%s) is created before or is equal the most recent release %s (%s)", currentCommit.String(), ref, createdAt.String())
+		for _, file := range strings.Split(untracked, "\x00") {
+			if file != "" {
+				changedFiles = append(changedFiles, file)
+			}
 		}
 	}
+	slices.Sort(changedFiles)
+	return slices.Compact(changedFiles), nil
+}
+
+// DiffToTagPattern returns a list of files that have been changed
+// compared to the most recent tags of a certain pattern. On other branches
+// than the default branch the changes are compared to the default branch,
+// see [DiffToMain].
+func DiffToTagPattern(releasePrefix string) ([]string, error) {
+	changedFiles := []string{}
+
+	config, err := core.CurrentConfig()
+	if err != nil {
+		return nil, err
+	}
+	if config.IsSet("git.changed_files") {
+		return config.Git.ChangedFiles, nil
+	}
+
+	onMain, err := onDefaultBranch(config.Git.DefaultBranch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if commit is on %s branch: %w", config.Git.DefaultBranch, err)
+	}
+	if !onMain {
+		return DiffToMain()
+	}
 
-	gitDiff, err := sh.Output("git", "diff", "--name-only", "--no-renames", ref)
+	releaseRef, createdAt, err := github.GetLatestReleaseTagWithPrefix(releasePrefix)
 	if err != nil {
-		return changedFiles, err
+		return nil, fmt.Errorf("getting releases from github failed: %w", err)
 	}
-	changedFiles = append(changedFiles, strings.Split(gitDiff, "\n")...)
-	return changedFiles, nil
+	// if no relelease is found, use CHANGES from dorny path filter. next release should
+	// create release.
+	// TODO: implement native model to do changes against github api
+	if releaseRef == "" {
+		changedFilesFromEnv, ok := os.LookupEnv("CHANGES")
+		if !ok {
+			return nil, fmt.Errorf("the environment varariable $CHANGES is required but not found. This is required to detect changes on main")
+		}
+		changedFiles = strings.Split(changedFilesFromEnv, ",")
+		return changedFiles, nil
+	}
+	currentCommit, err := getTimeStampOfCurrentCommit()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get timetamp of current commit: %w ", err)
+	}
+	if currentCommit.Before(createdAt) || currentCommit.Equal(createdAt) {
+		return nil, fmt.Errorf("current commit creation date (%s) is created before or is equal the most recent release %s (%s)", currentCommit.String(), releaseRef, createdAt.String())
+	}
+	return diff(releaseRef, config.Git.IncludeUntracked)
 }
 
-// OnMainBranch returns true the current branch is the main branch
-func onMainBranch() (bool, error) {
-	branch, err := sh.Output("git", "rev-parse", "--abbrev-ref", "HEAD")
+// DiffToLatestRelease returns the files changed compared to the most recent
+// release whose name starts with the prefix. Unlike [DiffToTagPattern] the
+// release is used on every branch, so changes made on the default branch
+// after the release are included. CHANGED_FILES replaces the detection. See
+// [DiffToTag].
+func DiffToLatestRelease(releasePrefix string) ([]string, error) {
+	config, err := core.CurrentConfig()
+	if err != nil {
+		return nil, err
+	}
+	if config.IsSet("git.changed_files") {
+		return config.Git.ChangedFiles, nil
+	}
+	tag, _, err := github.GetLatestReleaseTagWithPrefix(releasePrefix)
+	if err != nil {
+		return nil, fmt.Errorf("getting releases from github failed: %w", err)
+	}
+	if tag == "" {
+		return nil, fmt.Errorf("no release named %s found", releasePrefix)
+	}
+	return DiffToTag(tag)
+}
+
+// DiffToTag returns the files changed in the working tree compared to the
+// tag, see [DiffToMain] for what is included. A tag missing in a shallow
+// clone is fetched.
+func DiffToTag(tag string) ([]string, error) {
+	config, err := core.CurrentConfig()
+	if err != nil {
+		return nil, err
+	}
+	ref := "refs/tags/" + tag
+	if checkBranch(ref) != nil {
+		err = sh.Run("git", "fetch", "--depth=1", remote, fmt.Sprintf("+%s:%s", ref, ref))
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch the tag %s: %w", tag, err)
+		}
+	}
+	return diff(ref, config.Git.IncludeUntracked)
+}
+
+// onDefaultBranch returns true the current branch is the default branch
+func onDefaultBranch(branch string) (bool, error) {
+	current, err := CurrentBranch()
 	if err != nil {
 		return false, err
 	}
-	return branch == "main", nil
+	return current == branch, nil
 }
 
 func checkBranch(branch string) error {
-	return sh.Run("git", "rev-parse", "--verify", branch)
+	return sh.Run("git", "rev-parse", "--verify", "--quiet", branch)
 }
 
 // IsTracked returns true if the file is tracked by git
@@ -161,6 +308,17 @@ func CurrentBranch() (string, error) {
 	return sh.Output("git", "rev-parse", "--abbrev-ref", "HEAD")
 }
 
+// Describe returns the nearest tag matching the pattern reachable from the
+// current commit, suffixed with the number of commits since the tag and the
+// abbreviated hash when the commit is not tagged, like v1.2.3-4-g1a2b3c4
+func Describe(pattern string) (string, error) {
+	out, err := sh.Output("git", "describe", "--tags", "--match", pattern)
+	if err != nil {
+		return "", fmt.Errorf("no tag matching %s: %w", pattern, err)
+	}
+	return out, nil
+}
+
 func getTimeStampOfCurrentCommit() (time.Time, error) {
 	out, err := sh.Output("git", "show", "--no-patch", `--format=%cI`)
 	if err != nil {
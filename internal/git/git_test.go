@@ -1,6 +1,7 @@
 package git_test
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -72,11 +73,12 @@ func TestNormalizeGitURL(t *testing.T) {
 
 func TestGitDiff(t *testing.T) {
 	tests := []struct {
-		name            string
-		commands        []string
-		want            []string
-		wantErr         bool
-		changedFilesEnv string
+		name             string
+		commands         []string
+		want             []string
+		wantErr          bool
+		changedFilesEnv  string
+		includeUntracked bool
 	}{
 		{
 			name:     "no git directory",
@@ -96,7 +98,7 @@ func TestGitDiff(t *testing.T) {
 				`git commit -am "init"`,
 				"git checkout -b diff-one",
 			},
-			want:    []string{""},
+			want:    []string{},
 			wantErr: false,
 		},
 		{
@@ -159,6 +161,21 @@ func TestGitDiff(t *testing.T) {
 			want:    []string{"1.txt", "3.txt", "4.txt"},
 			wantErr: false,
 		},
+		{
+			name: "untracked file",
+			commands: []string{
+				"cp $TD/3.txt ./5.txt",
+			},
+			want:    []string{"1.txt", "3.txt", "4.txt"},
+			wantErr: false,
+		},
+		{
+			name:             "include untracked file",
+			commands:         []string{},
+			want:             []string{"1.txt", "3.txt", "4.txt", "5.txt"},
+			includeUntracked: true,
+			wantErr:          false,
+		},
 		{
 			name:            "env override",
 			commands:        []string{},
@@ -178,6 +195,7 @@ func TestGitDiff(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GIT_INCLUDE_UNTRACKED", fmt.Sprint(tt.includeUntracked))
 			for _, command := range tt.commands {
 				cmd := strings.Fields(command)
 				assert.NoError(t, sh.RunWith(env, cmd[0], cmd[1:]...))
@@ -196,3 +214,71 @@ func TestGitDiff(t *testing.T) {
 		})
 	}
 }
+
+func TestDiffToMainMergeBase(t *testing.T) {
+	env := map[string]string{
+		"GIT_AUTHOR_NAME":     "Mage CI",
+		"GIT_AUTHOR_EMAIL":    "mage@coop.no",
+		"GIT_COMMITTER_NAME":  "Mage CI",
+		"GIT_COMMITTER_EMAIL": "mage@coop.no",
+	}
+	run := func(t *testing.T, commands ...string) {
+		t.Helper()
+		for _, command := range commands {
+			cmd := strings.Fields(command)
+			require.NoError(t, sh.RunWith(env, cmd[0], cmd[1:]...))
+		}
+	}
+	write := func(t *testing.T, file string) {
+		t.Helper()
+		require.NoError(t, os.WriteFile(file, []byte(file), 0o644))
+	}
+	t.Setenv("CHANGED_FILES", "")
+	require.NoError(t, os.Unsetenv("CHANGED_FILES"))
+	t.Setenv("GIT_DEFAULT_BRANCH", "trunk")
+	t.Setenv("GIT_INCLUDE_UNTRACKED", "false")
+
+	upstream := t.TempDir()
+	t.Chdir(upstream)
+	run(t, "git init --quiet --initial-branch trunk")
+	write(t, "a.txt")
+	run(t, "git add a.txt", "git commit --quiet -m a")
+	for i := range 3 {
+		write(t, fmt.Sprintf("history-%d.txt", i))
+		run(t, "git add .", fmt.Sprintf("git commit --quiet -m history-%d", i))
+	}
+	run(t, "git checkout --quiet -b feature")
+	write(t, "b.txt")
+	run(t, "git add b.txt", "git commit --quiet -m b", "git mv a.txt renamed.txt", "git commit --quiet -m rename")
+	run(t, "git checkout --quiet trunk")
+	write(t, "c.txt")
+	run(t, "git add c.txt", "git commit --quiet -m c", "git checkout --quiet feature")
+
+	t.Run("Should ignore changes on the default branch after branching", func(t *testing.T) {
+		got, err := git.DiffToMain()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a.txt", "b.txt", "renamed.txt"}, got)
+	})
+
+	t.Run("Should compare to a tag fetched in shallow clones", func(t *testing.T) {
+		t.Chdir(upstream)
+		run(t, "git tag v1.0.0 trunk")
+		clone := filepath.Join(t.TempDir(), "clone")
+		run(t, fmt.Sprintf("git clone --quiet --depth=1 --no-tags --branch feature file://%s %s", upstream, clone))
+		t.Chdir(clone)
+
+		got, err := git.DiffToTag("v1.0.0")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a.txt", "b.txt", "c.txt", "renamed.txt"}, got)
+	})
+
+	t.Run("Should deepen shallow clones to find the merge-base", func(t *testing.T) {
+		clone := filepath.Join(t.TempDir(), "clone")
+		run(t, fmt.Sprintf("git clone --quiet --depth=1 --branch feature file://%s %s", upstream, clone))
+		t.Chdir(clone)
+
+		got, err := git.DiffToMain()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a.txt", "b.txt", "renamed.txt"}, got)
+	})
+}
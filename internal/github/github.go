@@ -109,24 +109,68 @@ func CreateCommentInPR(filename string) error {
 	return sh.Run("gh", "pr", "comment", prNumber, "--body-file", filename)
 }
 
+// StickyCommentInPR keeps a single visible comment in the current PR. The most
+// recent comment containing searchString is hidden as outdated and a new
+// comment with the body sourced from filename is created.
+func StickyCommentInPR(searchString, filename string) error {
+	found, id, err := FindCommentInPR(searchString)
+	if err != nil {
+		return err
+	}
+	if found {
+		err := HideComment(id)
+		if err != nil {
+			return err
+		}
+	}
+	return CreateCommentInPR(filename)
+}
+
 // PrintActionMessage prints a action message in github action using the
 // ::<level> format. It makes sure the encoding is correct. The first input the level, the
 // second is the is the title and the third the message
 // level can be debug, notice, warning, error. It will return a error if the
 // level is not allowed.
 func PrintActionMessage(level, title, message string) {
+	level = actionLevel(level)
+	fmt.Printf("::%s title=%s::%s", level, gitHubActionsEscape(title), gitHubActionsEscape(message))
+}
+
+// PrintFileActionMessage prints a action message in github action that
+// annotates a line in a file. The line is omitted when it is 0. See
+// [PrintActionMessage] for the allowed levels.
+func PrintFileActionMessage(level, title, file string, line int, message string) {
+	level = actionLevel(level)
+	properties := fmt.Sprintf("file=%s", gitHubActionsEscapeProperty(file))
+	if line > 0 {
+		properties = fmt.Sprintf("%s,line=%d", properties, line)
+	}
+	fmt.Printf("::%s %s,title=%s::%s\n", level, properties, gitHubActionsEscapeProperty(title), gitHubActionsEscape(message))
+}
+
+// actionLevel returns the level if it is allowed, otherwise an error is
+// printed and error is returned
+func actionLevel(level string) string {
 	allowedLevels := []string{"debug", "notice", "warning", "error"}
-	if !slices.Contains(allowedLevels, level) {
-		PrintActionMessage(
-			"error",
-			"Unknown GHA log level",
-			fmt.Sprintf("Supplied loglevel %s is not allowed, should be any of %s. Defaulting to 'error' ",
-				level,
-				strings.Join(allowedLevels, ","),
-			))
-		level = "error"
+	if slices.Contains(allowedLevels, level) {
+		return level
 	}
-	fmt.Printf("::%s title=%s::%s", level, gitHubActionsEscape(title), gitHubActionsEscape(message))
+	PrintActionMessage(
+		"error",
+		"Unknown GHA log level",
+		fmt.Sprintf("Supplied loglevel %s is not allowed, should be any of %s. Defaulting to 'error' ",
+			level,
+			strings.Join(allowedLevels, ","),
+		))
+	return "error"
+}
+
+func gitHubActionsEscapeProperty(s string) string {
+	r := strings.NewReplacer(
+		":", "%3A",
+		",", "%2C",
+	)
+	return r.Replace(gitHubActionsEscape(s))
 }
 
 func gitHubActionsEscape(s string) string {
@@ -216,27 +260,87 @@ func WithHTTPClient(c *http.Client) Option {
 // of the release name (not the tag name). It returns the tag and a error. If
 // no release is found the tag will be an empty string.
 func GetLatestReleaseTagWithPrefix(prefix string, opts ...Option) (string, time.Time, error) {
-	o, err := defaultOptions()
+	releases, err := releasesWithPrefix(prefix, 1, opts...)
 	if err != nil {
 		return "", time.Now(), err
 	}
+	if len(releases) == 0 {
+		return "", time.Now(), nil
+	}
+	return releases[0].TagName, releases[0].CreatedAt, nil
+}
+
+// GetReleaseTagsWithPrefix gets the tags of at most limit releases filtred by
+// a prefix of the release name (not the tag name), the most recent release
+// first.
+func GetReleaseTagsWithPrefix(prefix string, limit int, opts ...Option) ([]string, error) {
+	releases, err := releasesWithPrefix(prefix, limit, opts...)
+	if err != nil {
+		return nil, err
+	}
+	tags := []string{}
+	for _, r := range releases {
+		tags = append(tags, r.TagName)
+	}
+	return tags, nil
+}
+
+// releasesWithPrefix returns at most limit published releases with a name
+// starting with prefix, the most recent release first. The pages of releases
+// are requested until limit releases are found.
+func releasesWithPrefix(prefix string, limit int, opts ...Option) ([]ghRelease, error) {
+	o, err := defaultOptions()
+	if err != nil {
+		return nil, err
+	}
 
 	for _, opt := range opts {
 		opt(o)
 	}
 
+	result := []ghRelease{}
 	url := fmt.Sprintf("%s/repos/%s/%s/releases?per_page=100", o.baseURL, o.owner, o.repo)
+	for url != "" && len(result) < limit {
+		var releases []ghRelease
+		releases, url, err = releasesPage(o, url)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range releases {
+			if r.Draft {
+				continue
+			}
+			if r.Prerelease {
+				continue
+			}
+			if strings.HasPrefix(r.Name, prefix) {
+				result = append(result, r)
+			}
+		}
+	}
+	// sort releases, gh does not state ordering of releases
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.After(result[j].CreatedAt)
+	})
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
 
+// releasesPage returns the releases of a page and the URL of the next page,
+// empty on the last page
+func releasesPage(o *options, url string) ([]ghRelease, string, error) {
 	req, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
-		return "", time.Now(), err
+		return nil, "", err
 	}
 
 	req.Header.Set("Authorization", "Bearer "+o.token)
 
 	resp, err := o.httpClient.Do(req)
 	if err != nil {
-		return "", time.Now(), fmt.Errorf("failed to call GitHub API: %w", err)
+		return nil, "", fmt.Errorf("failed to call GitHub API: %w", err)
 	}
 
 	defer func() {
@@ -247,34 +351,30 @@ func GetLatestReleaseTagWithPrefix(prefix string, opts ...Option) (string, time.
 	}()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", time.Now(), fmt.Errorf("got status %d, expected is %d", resp.StatusCode, http.StatusOK)
+		return nil, "", fmt.Errorf("got status %d, expected is %d", resp.StatusCode, http.StatusOK)
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", time.Now(), err
+		return nil, "", err
 	}
 	var releases []ghRelease
 	if err := json.Unmarshal(body, &releases); err != nil {
-		return "", time.Now(), fmt.Errorf("failed to parse: %s\nerr: %w", string(body), err)
+		return nil, "", fmt.Errorf("failed to parse: %s\nerr: %w", string(body), err)
 	}
-	// sort releases, gh does not state ordering of releases
-	sort.Slice(releases, func(i, j int) bool {
-		return releases[i].CreatedAt.After(releases[j].CreatedAt)
-	})
+	return releases, nextPageURL(resp.Header.Get("Link")), nil
+}
 
-	for _, r := range releases {
-		if r.Draft {
-			continue
-		}
-		if r.Prerelease {
-			continue
-		}
-		if strings.HasPrefix(r.Name, prefix) {
-			return r.TagName, r.CreatedAt, nil
+// nextPageURL returns the URL of the next page in a Link header of the GitHub
+// API, like <https://api.github.com/...?page=2>; rel="next", <...>; rel="last"
+func nextPageURL(link string) string {
+	for _, part := range strings.Split(link, ",") {
+		target, rel, ok := strings.Cut(part, ";")
+		if ok && strings.TrimSpace(rel) == `rel="next"` {
+			return strings.Trim(strings.TrimSpace(target), "<>")
 		}
 	}
-	return "", time.Now(), nil
+	return ""
 }
 
 type ghRelease struct {
@@ -1,8 +1,11 @@
 package github_test
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
 
 	"github.com/coopnorge/mage/internal/github"
@@ -127,3 +130,163 @@ func TestGetLatestReleaseTagWithPrefix(t *testing.T) {
 		})
 	}
 }
+
+func TestGetReleaseTagsWithPrefix(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, err := w.Write([]byte(`[
+		       {"name": "Go OCI Release v2025.01.01000000", "tag_name": "v2025.01.01000000", "draft": false, "prerelease": false, "created_at": "2025-01-01T00:00:00Z"},
+		       {"name": "Go OCI Release v2025.03.01000000", "tag_name": "v2025.03.01000000", "draft": false, "prerelease": false, "created_at": "2025-03-01T00:00:00Z"},
+		       {"name": "Go OCI Release v2025.04.01000000", "tag_name": "v2025.04.01000000", "draft": true, "prerelease": false, "created_at": "2025-04-01T00:00:00Z"},
+		       {"name": "v1.0.0", "tag_name": "v1.0.0", "draft": false, "prerelease": false, "created_at": "2025-05-01T00:00:00Z"}
+	        ]`))
+		assert.NoError(t, err)
+	}))
+	t.Cleanup(server.Close)
+
+	t.Setenv("GITHUB_TOKEN", "test")
+	t.Setenv("GITHUB_REPOSITORY", "test/test")
+	t.Setenv("GITHUB_API_URL", server.URL)
+
+	tags, err := github.GetReleaseTagsWithPrefix("Go OCI Release", 10, github.WithHTTPClient(server.Client()))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"v2025.03.01000000", "v2025.01.01000000"}, tags)
+}
+
+func TestGetReleaseTagsWithPrefixPaginated(t *testing.T) {
+	pages := []string{
+		`[{"name": "v1.0.0", "tag_name": "v1.0.0", "created_at": "2025-05-01T00:00:00Z"},
+		  {"name": "Go OCI Release v2025.04.01000000", "tag_name": "v2025.04.01000000", "created_at": "2025-04-01T00:00:00Z"}]`,
+		`[{"name": "Go OCI Release v2025.03.01000000", "tag_name": "v2025.03.01000000", "created_at": "2025-03-01T00:00:00Z"},
+		  {"name": "Go OCI Release v2025.02.01000000", "tag_name": "v2025.02.01000000", "created_at": "2025-02-01T00:00:00Z"}]`,
+		`[{"name": "Go OCI Release v2025.01.01000000", "tag_name": "v2025.01.01000000", "created_at": "2025-01-01T00:00:00Z"}]`,
+	}
+	requested := []string{}
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := r.URL.Query().Get("page")
+		requested = append(requested, page)
+		i := 0
+		if page != "" {
+			i, _ = strconv.Atoi(page)
+		}
+		if i+1 < len(pages) {
+			w.Header().Set("Link", fmt.Sprintf(`<%s%s?per_page=100&page=%d>; rel="next", <%s%s?page=%d>; rel="last"`, server.URL, r.URL.Path, i+1, server.URL, r.URL.Path, len(pages)-1))
+		}
+		_, err := w.Write([]byte(pages[i]))
+		assert.NoError(t, err)
+	}))
+	t.Cleanup(server.Close)
+
+	t.Setenv("GITHUB_TOKEN", "test")
+	t.Setenv("GITHUB_REPOSITORY", "test/test")
+	t.Setenv("GITHUB_API_URL", server.URL)
+
+	tags, err := github.GetReleaseTagsWithPrefix("Go OCI Release", 2, github.WithHTTPClient(server.Client()))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"v2025.04.01000000", "v2025.03.01000000"}, tags)
+	assert.Equal(t, []string{"", "1"}, requested)
+
+	tags, err = github.GetReleaseTagsWithPrefix("Go OCI Release", 10, github.WithHTTPClient(server.Client()))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"v2025.04.01000000", "v2025.03.01000000", "v2025.02.01000000", "v2025.01.01000000"}, tags)
+}
+
+func TestMatrix(t *testing.T) {
+	jobs := func(n int) []github.MatrixJob {
+		jobs := []github.MatrixJob{}
+		for i := range n {
+			key := fmt.Sprintf("dir/%d", i)
+			jobs = append(jobs, github.MatrixJob{Key: key, Name: github.JobName("go", key), Metadata: map[string]any{"wave": 0}})
+		}
+		return jobs
+	}
+
+	tests := []struct {
+		name        string
+		jobs        int
+		chunkSize   string
+		maxParallel string
+		want        github.MatrixInfo
+		wantErr     bool
+	}{
+		{
+			name: "Should fit in one chunk",
+			jobs: 3,
+			want: github.MatrixInfo{Jobs: 3, Chunks: 1, ChunkSize: 256, MaxParallel: 3},
+		},
+		{
+			name: "Should split in chunks of 256 jobs",
+			jobs: 600,
+			want: github.MatrixInfo{Jobs: 600, Chunks: 3, ChunkSize: 256, MaxParallel: 20},
+		},
+		{
+			name:        "Should use the configured chunk size and max-parallel",
+			jobs:        10,
+			chunkSize:   "4",
+			maxParallel: "2",
+			want:        github.MatrixInfo{Jobs: 10, Chunks: 3, ChunkSize: 4, MaxParallel: 2},
+		},
+		{
+			name: "Should have one empty chunk",
+			jobs: 0,
+			want: github.MatrixInfo{Jobs: 0, Chunks: 1, ChunkSize: 256, MaxParallel: 1},
+		},
+		{
+			name:      "Should not allow chunks larger than the job limit",
+			jobs:      10,
+			chunkSize: "300",
+			wantErr:   true,
+		},
+		{
+			name:        "Should ignore invalid max-parallel",
+			jobs:        10,
+			maxParallel: "many",
+			want:        github.MatrixInfo{Jobs: 10, Chunks: 1, ChunkSize: 256, MaxParallel: 10},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MATRIX_CHUNK_SIZE", tt.chunkSize)
+			t.Setenv("MATRIX_MAX_PARALLEL", tt.maxParallel)
+			matrix := github.Matrix{Dimension: "directory", Jobs: jobs(tt.jobs)}
+
+			info, err := matrix.Info()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, info)
+
+			total := 0
+			for i := range info.Chunks {
+				chunk, err := matrix.Chunk(i)
+				assert.NoError(t, err)
+				assert.LessOrEqual(t, len(chunk.Jobs), info.ChunkSize)
+				total += len(chunk.Jobs)
+			}
+			assert.Equal(t, tt.jobs, total)
+			_, err = matrix.Chunk(info.Chunks)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestMatrixJSON(t *testing.T) {
+	matrix := github.Matrix{Dimension: "directory", Jobs: []github.MatrixJob{
+		{Key: "infra/app", Name: github.JobName("terraform", "infra/app"), Metadata: map[string]any{"wave": 1}},
+	}}
+	out, err := json.Marshal(matrix)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"directory":["infra/app"],"include":[{"directory":"infra/app","name":"terraform-infra-app","wave":1}]}`, string(out))
+
+	out, err = json.Marshal(github.Matrix{Dimension: "directory"})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"directory":[]}`, string(out))
+}
+
+func TestJobName(t *testing.T) {
+	assert.Equal(t, "helm-charts-app-production", github.JobName("helm", "./charts/app/", "production"))
+	assert.Equal(t, "go-cmd_v2-api", github.JobName("go", "cmd_v2 api"))
+}
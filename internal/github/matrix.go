@@ -0,0 +1,154 @@
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/coopnorge/mage/internal/core"
+)
+
+const (
+	// MaxMatrixJobs is the maximum number of jobs GitHub Actions generates
+	// from a matrix
+	MaxMatrixJobs = 256
+	// defaultMaxParallel is the max-parallel hint, it matches the number of
+	// concurrent jobs of the GitHub free plan
+	defaultMaxParallel = 20
+)
+
+// MatrixJob is a job in a GitHub Actions job matrix
+type MatrixJob struct {
+	// Key is the value of the matrix dimension, it must be unique
+	Key string
+	// Name is a stable job name derived from the key
+	Name string
+	// Metadata is added to the job with include
+	Metadata map[string]any
+}
+
+// Matrix is a GitHub Actions job matrix with a single dimension. The
+// metadata of the jobs is added with include entries, GitHub merges these
+// into the job with the same dimension value.
+//
+//	{"directory": ["a"], "include": [{"directory": "a", "name": "a", ...}]}
+type Matrix struct {
+	// Dimension is the name of the matrix dimension, e.g. directory
+	Dimension string
+	Jobs      []MatrixJob
+}
+
+// MatrixInfo describes how a matrix is split in chunks
+type MatrixInfo struct {
+	Jobs        int `json:"jobs"`
+	Chunks      int `json:"chunks"`
+	ChunkSize   int `json:"chunk-size"`
+	MaxParallel int `json:"max-parallel"`
+}
+
+// MarshalJSON implements json.Marshaler
+func (m Matrix) MarshalJSON() ([]byte, error) {
+	keys := []string{}
+	include := []map[string]any{}
+	for _, job := range m.Jobs {
+		keys = append(keys, job.Key)
+		entry := map[string]any{}
+		for k, v := range job.Metadata {
+			entry[k] = v
+		}
+		entry[m.Dimension] = job.Key
+		entry["name"] = job.Name
+		include = append(include, entry)
+	}
+	matrix := map[string]any{m.Dimension: keys}
+	if len(include) > 0 {
+		matrix["include"] = include
+	}
+	return json.Marshal(matrix)
+}
+
+// Chunks splits the matrix in chunks of at most size jobs
+func (m Matrix) Chunks(size int) []Matrix {
+	if size <= 0 {
+		size = MaxMatrixJobs
+	}
+	chunks := []Matrix{}
+	for start := 0; start < len(m.Jobs); start += size {
+		end := min(start+size, len(m.Jobs))
+		chunks = append(chunks, Matrix{Dimension: m.Dimension, Jobs: m.Jobs[start:end]})
+	}
+	if len(chunks) == 0 {
+		chunks = append(chunks, Matrix{Dimension: m.Dimension, Jobs: []MatrixJob{}})
+	}
+	return chunks
+}
+
+// Info returns the chunking and max-parallel hint of the matrix. The chunk
+// size and the max-parallel hint are configured in [core.MatrixConfig].
+func (m Matrix) Info() (MatrixInfo, error) {
+	config, err := core.CurrentConfig()
+	if err != nil {
+		return MatrixInfo{}, err
+	}
+	size := config.Matrix.ChunkSize
+	if size == 0 {
+		size = MaxMatrixJobs
+	}
+	if size > MaxMatrixJobs {
+		return MatrixInfo{}, fmt.Errorf("the chunk size is %d (%s), GitHub Actions allows at most %d jobs in a matrix", size, config.Sources["matrix.chunk_size"], MaxMatrixJobs)
+	}
+	maxParallel := config.Matrix.MaxParallel
+	if maxParallel == 0 {
+		maxParallel = defaultMaxParallel
+	}
+	return MatrixInfo{
+		Jobs:        len(m.Jobs),
+		Chunks:      len(m.Chunks(size)),
+		ChunkSize:   size,
+		MaxParallel: max(1, min(maxParallel, len(m.Jobs))),
+	}, nil
+}
+
+// Chunk returns chunk i of the matrix, see [Matrix.Info]
+func (m Matrix) Chunk(i int) (Matrix, error) {
+	info, err := m.Info()
+	if err != nil {
+		return Matrix{}, err
+	}
+	chunks := m.Chunks(info.ChunkSize)
+	if i < 0 || i >= len(chunks) {
+		return Matrix{}, fmt.Errorf("chunk %d does not exist, the matrix has %d chunks", i, len(chunks))
+	}
+	return chunks[i], nil
+}
+
+// PrintMatrix prints the matrix as JSON. A warning is printed to stderr if
+// the matrix exceeds the job limit of GitHub Actions.
+func PrintMatrix(m Matrix) error {
+	if len(m.Jobs) > MaxMatrixJobs {
+		fmt.Fprintf(os.Stderr, "The matrix has %d jobs, GitHub Actions allows at most %d. Use the chunk targets to split the matrix.\n", len(m.Jobs), MaxMatrixJobs)
+	}
+	out, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+	return nil
+}
+
+var jobNameInvalid = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// JobName returns a stable job name from parts, e.g. a path and an
+// environment. Characters not allowed in job names are replaced by a dash.
+func JobName(parts ...string) string {
+	names := []string{}
+	for _, part := range parts {
+		part = strings.Trim(jobNameInvalid.ReplaceAllString(part, "-"), "-.")
+		if part != "" {
+			names = append(names, part)
+		}
+	}
+	return strings.Join(names, "-")
+}
@@ -0,0 +1,299 @@
+package golang
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/coopnorge/mage/internal/core"
+	"github.com/coopnorge/mage/internal/devtool"
+	"github.com/coopnorge/mage/internal/git"
+)
+
+const cmdDir = "cmd"
+
+// Package is a package in the output of go list -json
+type Package struct {
+	ImportPath string
+	Dir        string
+	Name       string
+	Standard   bool
+	// Deps are the import paths of all dependencies of the package
+	Deps []string
+	// EmbedFiles are the files embedded with //go:embed, relative to Dir
+	EmbedFiles []string
+	// The other source files of the package, relative to Dir
+	CFiles       []string
+	CXXFiles     []string
+	MFiles       []string
+	HFiles       []string
+	FFiles       []string
+	SFiles       []string
+	SwigFiles    []string
+	SwigCXXFiles []string
+	SysoFiles    []string
+	// TestEmbedFiles and XTestEmbedFiles are the files embedded by the
+	// tests, relative to Dir
+	TestEmbedFiles  []string
+	XTestEmbedFiles []string
+	Module          *Module
+}
+
+// buildFiles returns the files other than Go files that are compiled into
+// the package, relative to Dir
+func (p Package) buildFiles() []string {
+	return slices.Concat(p.EmbedFiles, p.CFiles, p.CXXFiles, p.MFiles, p.HFiles, p.FFiles, p.SFiles, p.SwigFiles, p.SwigCXXFiles, p.SysoFiles)
+}
+
+// Module is the module of a [Package]
+type Module struct {
+	Path    string
+	Dir     string
+	Replace *Module
+}
+
+// Affected are the Go modules and the binaries in cmd/<binary> of the
+// modules affected by changes
+type Affected struct {
+	Modules []string `json:"modules"`
+	// Binaries are the names of the affected binaries by module
+	Binaries map[string][]string `json:"binaries"`
+}
+
+// ListPackages returns the packages of a Go module and all their
+// dependencies, see go list -deps. Directories are relative to the working
+// directory, or empty for packages outside of it like the module cache.
+func ListPackages(module string) ([]Package, error) {
+	out, err := toolGo.Output(nil, "-C", module, "list", "-deps", "-json=ImportPath,Dir,Name,Standard,Deps,EmbedFiles,CFiles,CXXFiles,MFiles,HFiles,FFiles,SFiles,SwigFiles,SwigCXXFiles,SysoFiles,TestEmbedFiles,XTestEmbedFiles,Module", "./...")
+	if err != nil {
+		return nil, err
+	}
+	root, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	return parsePackages(strings.NewReader(out), root)
+}
+
+// parsePackages decodes the stream of JSON packages and makes directories
+// relative to root
+func parsePackages(r io.Reader, root string) ([]Package, error) {
+	packages := []Package{}
+	decoder := json.NewDecoder(r)
+	for {
+		var pkg Package
+		err := decoder.Decode(&pkg)
+		if errors.Is(err, io.EOF) {
+			return packages, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		pkg.Dir = relativeDir(root, pkg.Dir)
+		for m := pkg.Module; m != nil; m = m.Replace {
+			m.Dir = relativeDir(root, m.Dir)
+		}
+		packages = append(packages, pkg)
+	}
+}
+
+// relativeDir returns dir relative to root, or to the working directory of Go
+// in docker. Directories outside of them are empty.
+func relativeDir(root, dir string) string {
+	for _, base := range []string{root, devtool.GoDockerWorkdir} {
+		rel, err := filepath.Rel(base, dir)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return ""
+}
+
+// AffectedModules returns the modules and binaries affected by the changes
+// compared to the most recent release tag matching pattern, see
+// [git.DiffToTagPattern] and [AffectedByFiles].
+func AffectedModules(modules []string, pattern string) (Affected, error) {
+	changedFiles, err := git.DiffToTagPattern(pattern)
+	if err != nil {
+		return Affected{}, err
+	}
+	return AffectedByFiles(modules, changedFiles)
+}
+
+// AffectedByFiles returns the modules and binaries affected by the changed
+// files, see [AffectedByChanges]. Changes to the workflows and files matching
+// go.additional_globs affect every module and binary.
+func AffectedByFiles(modules, changedFiles []string) (Affected, error) {
+	config, err := core.CurrentConfig()
+	if err != nil {
+		return Affected{}, err
+	}
+	additionalGlobs := append([]string{".github/workflows/*"}, config.Go.AdditionalGlobs...)
+	all, err := core.CompareChangesToPaths(changedFiles, []string{}, additionalGlobs)
+	if err != nil {
+		return Affected{}, err
+	}
+	if all {
+		return allAffected(modules)
+	}
+	return AffectedByChanges(modules, changedFiles, ListPackages)
+}
+
+// allAffected returns every module and binary as affected
+func allAffected(modules []string) (Affected, error) {
+	affected := Affected{Modules: modules, Binaries: map[string][]string{}}
+	for _, module := range modules {
+		binaries, err := Binaries(module)
+		if err != nil {
+			return Affected{}, err
+		}
+		if len(binaries) > 0 {
+			affected.Binaries[module] = binaries
+		}
+	}
+	return affected, nil
+}
+
+// Binaries returns the names of the directories in cmd of a module
+func Binaries(module string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(module, cmdDir))
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	binaries := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			binaries = append(binaries, entry.Name())
+		}
+	}
+	return binaries, nil
+}
+
+// AffectedByChanges returns the modules and binaries affected by the changed
+// files, using the packages returned by list for each module. Only the inputs
+// of the packages count, changes to other files like a README.md are ignored:
+//
+//   - a package is changed when a Go file in its directory, a file it embeds
+//     or another source file of it like a C file changes, or the go.mod or
+//     go.sum of its module
+//   - the tests of a package are changed when a test file in its directory,
+//     a file embedded by the tests or a file in its testdata changes
+//   - a module is affected by changes to its packages and their tests, by
+//     changes to the packages it depends on, including packages in sibling
+//     modules used with a replace directive, and by changes to Go files that
+//     are not in a package, like deleted packages. A nested module owns its
+//     files.
+//   - a binary is affected when its main package or one of its dependencies
+//     is changed, or its cmd/<binary>/Dockerfile changes
+func AffectedByChanges(modules, changedFiles []string, list func(module string) ([]Package, error)) (Affected, error) {
+	changed := map[string]bool{}
+	changedModuleFiles := map[string]bool{}
+	owned := map[string]bool{}
+	for _, file := range changedFiles {
+		if file == "" {
+			continue
+		}
+		file = filepath.ToSlash(filepath.Clean(file))
+		changed[file] = true
+		base := path.Base(file)
+		if base == "go.mod" || base == "go.sum" {
+			changedModuleFiles[path.Dir(file)] = true
+		}
+		if base != "go.mod" && base != "go.sum" && !strings.HasSuffix(base, ".go") {
+			continue
+		}
+		if module, ok := moduleOf(file, modules); ok {
+			owned[module] = true
+		}
+	}
+
+	affected := Affected{Modules: []string{}, Binaries: map[string][]string{}}
+	for _, module := range modules {
+		packages, err := list(module)
+		if err != nil {
+			return Affected{}, err
+		}
+		moduleDirectory := filepath.ToSlash(filepath.Clean(module))
+		changedPackages := map[string]bool{}
+		changedTests := false
+		for _, pkg := range packages {
+			if pkg.Standard || pkg.Dir == "" {
+				continue
+			}
+			if packageChanged(pkg, changed) || changedModuleFiles[moduleDir(pkg.Module)] {
+				changedPackages[pkg.ImportPath] = true
+			}
+			if moduleDir(pkg.Module) == moduleDirectory && testsChanged(pkg, changed) {
+				changedTests = true
+			}
+		}
+
+		binaries := []string{}
+		cmdPath := path.Join(moduleDirectory, cmdDir)
+		for _, pkg := range packages {
+			if pkg.Name != "main" || path.Dir(pkg.Dir) != cmdPath {
+				continue
+			}
+			if changedPackages[pkg.ImportPath] || changed[path.Join(pkg.Dir, "Dockerfile")] ||
+				slices.ContainsFunc(pkg.Deps, func(dep string) bool { return changedPackages[dep] }) {
+				binaries = append(binaries, path.Base(pkg.Dir))
+			}
+		}
+		if len(binaries) > 0 {
+			slices.Sort(binaries)
+			affected.Binaries[module] = binaries
+		}
+		if owned[module] || changedTests || len(changedPackages) > 0 || len(binaries) > 0 {
+			affected.Modules = append(affected.Modules, module)
+		}
+	}
+	return affected, nil
+}
+
+// packageChanged returns true if a Go file in the directory of the package,
+// which includes new and deleted files, or another input of the package
+// changed. Test files are excluded, see [testsChanged].
+func packageChanged(pkg Package, changed map[string]bool) bool {
+	for file := range changed {
+		if path.Dir(file) == pkg.Dir && strings.HasSuffix(file, ".go") && !strings.HasSuffix(file, "_test.go") {
+			return true
+		}
+	}
+	return slices.ContainsFunc(pkg.buildFiles(), func(file string) bool {
+		return changed[path.Join(pkg.Dir, file)]
+	})
+}
+
+// testsChanged returns true if a test file in the directory of the package,
+// a file embedded by the tests or a file in its testdata changed
+func testsChanged(pkg Package, changed map[string]bool) bool {
+	testdata := path.Join(pkg.Dir, "testdata") + "/"
+	for file := range changed {
+		if path.Dir(file) == pkg.Dir && strings.HasSuffix(file, "_test.go") || strings.HasPrefix(file, testdata) {
+			return true
+		}
+	}
+	return slices.ContainsFunc(slices.Concat(pkg.TestEmbedFiles, pkg.XTestEmbedFiles), func(file string) bool {
+		return changed[path.Join(pkg.Dir, file)]
+	})
+}
+
+// moduleDir returns the directory of the module of a package, the
+// replacement if the module is replaced
+func moduleDir(m *Module) string {
+	if m == nil {
+		return ""
+	}
+	if m.Replace != nil && m.Replace.Dir != "" {
+		return m.Replace.Dir
+	}
+	return m.Dir
+}
@@ -8,11 +8,12 @@ import (
 	"path"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
 
 	"github.com/coopnorge/mage/internal/core"
 	"github.com/coopnorge/mage/internal/devtool"
-	"github.com/coopnorge/mage/internal/git"
+	"github.com/coopnorge/mage/internal/github"
 )
 
 const coverageReport = "coverage.out"
@@ -33,30 +34,47 @@ func IsGoModule(p string, d fs.DirEntry) bool {
 	return true
 }
 
-// FindGoModules will search through the base directory to find the all the
-// Go modules.
-func FindGoModules(base string) ([]string, error) {
-	directories := []string{}
+// discoveryExcludes are excluded from the discovery of Go modules and source
+// code in addition to [core.DefaultExcludes]
+var discoveryExcludes = []core.Rule{
+	{Pattern: "vendor/", Reason: "vendor directory"},
+	{Pattern: "testdata/", Reason: "testdata directory"},
+}
 
-	err := filepath.WalkDir(base, func(workDir string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		if core.IsDotDirectory(workDir, d) {
-			return filepath.SkipDir
+// DiscoverGoModules returns a decision for every Go module in the base
+// directory, see [core.Discovery]. Modules in excluded directories are only
+// returned when all is true.
+func DiscoverGoModules(base string, all bool) ([]core.Decision, error) {
+	discovery, err := core.NewDiscovery(base, discoveryExcludes...)
+	if err != nil {
+		return nil, err
+	}
+	decisions := []core.Decision{}
+	err = discovery.Walk(all, func(dir core.Dir, excluded bool, reason string) error {
+		if !dir.Has("go.mod") {
+			return nil
 		}
-		if !IsGoModule(workDir, d) {
+		if excluded {
+			decisions = append(decisions, core.Decision{Path: dir.Path, Reason: reason})
 			return nil
 		}
-
-		directories = append(directories, workDir)
-
+		decisions = append(decisions, core.Decision{Path: dir.Path, Included: true, Reason: "contains go.mod"})
 		return nil
 	})
 	if err != nil {
 		return nil, err
 	}
-	return directories, nil
+	return decisions, nil
+}
+
+// FindGoModules will search through the base directory to find the all the
+// Go modules, see [DiscoverGoModules].
+func FindGoModules(base string) ([]string, error) {
+	decisions, err := DiscoverGoModules(base, false)
+	if err != nil {
+		return nil, err
+	}
+	return core.IncludedPaths(decisions), nil
 }
 
 // ContainsGoSourceCode returns true if a directory contains a .go file.
@@ -71,36 +89,34 @@ func ContainsGoSourceCode(p string, d fs.DirEntry) (bool, error) {
 	}
 
 	for _, entry := range entries {
-		ext := filepath.Ext(entry.Name())
-		if strings.EqualFold(".go", ext) {
+		if isGoFile(entry.Name()) {
 			return true, nil
 		}
 	}
 	return false, nil
 }
 
+// isGoFile returns true if the name has the .go extension
+func isGoFile(name string) bool {
+	return strings.EqualFold(".go", filepath.Ext(name))
+}
+
 // FindGoSourceCodeFolders will return a list of directories that contains
-// golang source code
+// golang source code, excluded directories are skipped like in
+// [DiscoverGoModules]
 func FindGoSourceCodeFolders(base string) ([]string, error) {
 	directories := []string{}
 
-	err := filepath.WalkDir(base, func(workDir string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		if core.IsDotDirectory(workDir, d) {
-			return filepath.SkipDir
-		}
-
-		sourceCodeDir, err := ContainsGoSourceCode(workDir, d)
-		if err != nil {
-			return err
-		}
-		if !sourceCodeDir {
+	discovery, err := core.NewDiscovery(base, discoveryExcludes...)
+	if err != nil {
+		return nil, err
+	}
+	err = discovery.Walk(false, func(dir core.Dir, _ bool, _ string) error {
+		if !slices.ContainsFunc(dir.Files, isGoFile) {
 			return nil
 		}
 
-		directories = append(directories, workDir)
+		directories = append(directories, dir.Path)
 
 		return nil
 	})
@@ -110,18 +126,6 @@ func FindGoSourceCodeFolders(base string) ([]string, error) {
 	return directories, nil
 }
 
-// HasChanges checks if the current branch has any Go changes compared
-// to the main branch
-func HasChanges(goSourceCodeFolders []string, pattern string) (bool, error) {
-	changedFiles, err := git.DiffToTagPattern(pattern)
-	if err != nil {
-		return false, err
-	}
-	// always trigger on go.mod/sum and workflows because of changes in ci.
-	additionalGlobs := append([]string{"**/go.mod", "**/go.sum", ".github/workflows/*"}, strings.Split(os.Getenv("ADDITIONAL_GLOBS_GO"), ",")...)
-	return core.CompareChangesToPaths(changedFiles, goSourceCodeFolders, additionalGlobs)
-}
-
 // Generate runs commands described by directives within existing files with
 // the intent to generate Go code. Those commands can run any process but the
 // intent is to create or update Go source files
@@ -249,3 +253,79 @@ func DockerPlatforms() string {
 	}
 	return strings.Join(platforms, ",")
 }
+
+// MatrixJobs returns a GitHub Actions matrix job per affected Go module. The
+// metadata of a job is the go version and the affected binaries of the
+// module.
+func MatrixJobs(affected Affected) ([]github.MatrixJob, error) {
+	jobs := []github.MatrixJob{}
+	for _, dir := range affected.Modules {
+		binaries := affected.Binaries[dir]
+		if binaries == nil {
+			binaries = []string{}
+		}
+		goVersion, err := goDirective(dir)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, github.MatrixJob{
+			Key:  dir,
+			Name: github.JobName("go", filepath.ToSlash(filepath.Clean(dir))),
+			Metadata: map[string]any{
+				"go_version": goVersion,
+				"binaries":   binaries,
+			},
+		})
+	}
+	return jobs, nil
+}
+
+// goDirective returns the version in the go directive of the go.mod file of
+// a module
+func goDirective(directory string) (string, error) {
+	content, err := os.ReadFile(filepath.Join(directory, "go.mod"))
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "go" {
+			return fields[1], nil
+		}
+	}
+	return "", nil
+}
+
+// FindGoModule returns directory if it is one of the Go modules found in
+// base, otherwise an error listing the Go modules.
+func FindGoModule(base, directory string) (string, error) {
+	modules, err := FindGoModules(base)
+	if err != nil {
+		return "", err
+	}
+	for _, module := range modules {
+		if filepath.Clean(module) == filepath.Clean(directory) {
+			return module, nil
+		}
+	}
+	return "", fmt.Errorf("%q is not a Go module, found: %s", directory, strings.Join(modules, ", "))
+}
+
+// moduleOf returns the innermost module containing file
+func moduleOf(file string, modules []string) (string, bool) {
+	file = filepath.Clean(file)
+	owner, ownerLen := "", -1
+	for _, module := range modules {
+		dir := filepath.Clean(module)
+		if dir == "." {
+			if ownerLen < 0 {
+				owner, ownerLen = module, 0
+			}
+			continue
+		}
+		if strings.HasPrefix(file, dir+string(filepath.Separator)) && len(dir) > ownerLen {
+			owner, ownerLen = module, len(dir)
+		}
+	}
+	return owner, ownerLen >= 0
+}
@@ -0,0 +1,199 @@
+package golang
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/coopnorge/mage/internal/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeGoMod(t *testing.T, dir, goVersion string) {
+	t.Helper()
+	assert.NoError(t, os.MkdirAll(dir, 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/m\n\ngo "+goVersion+"\n"), 0o644))
+}
+
+func writeFile(t *testing.T, file, content string) {
+	t.Helper()
+	assert.NoError(t, os.MkdirAll(filepath.Dir(file), 0o755))
+	assert.NoError(t, os.WriteFile(file, []byte(content), 0o644))
+}
+
+func TestAffectedModules(t *testing.T) {
+	tests := []struct {
+		name     string
+		changes  string
+		globs    string
+		want     []string
+		binaries map[string][]string
+	}{
+		{
+			name:     "Should affect the binaries importing a changed package",
+			changes:  "internal/shared/shared.go",
+			want:     []string{"."},
+			binaries: map[string][]string{".": {"server"}},
+		},
+		{
+			name:     "Should affect the binaries embedding a changed file",
+			changes:  "cmd/worker/static/index.html",
+			want:     []string{"."},
+			binaries: map[string][]string{".": {"worker"}},
+		},
+		{
+			name:     "Should affect the binaries importing a package embedding a changed file",
+			changes:  "internal/shared/migrations/001.sql",
+			want:     []string{"."},
+			binaries: map[string][]string{".": {"server"}},
+		},
+		{
+			name:     "Should affect modules using a changed sibling module with replace",
+			changes:  "lib/lib.go",
+			want:     []string{"app", "lib"},
+			binaries: map[string][]string{"app": {"api"}},
+		},
+		{
+			name:     "Should affect modules using a sibling module with a changed go.mod",
+			changes:  "lib/go.mod",
+			want:     []string{"app", "lib"},
+			binaries: map[string][]string{"app": {"api"}},
+		},
+		{
+			name:     "Should affect every binary of a module with a changed go.mod",
+			changes:  "go.mod",
+			want:     []string{"."},
+			binaries: map[string][]string{".": {"server", "worker"}},
+		},
+		{
+			name:     "Should assign a change to the innermost module",
+			changes:  "tools/lint/main.go",
+			want:     []string{"tools/lint"},
+			binaries: map[string][]string{},
+		},
+		{
+			name:     "Should not match modules by name prefix",
+			changes:  "tools/linter.go,README.md",
+			want:     []string{"."},
+			binaries: map[string][]string{},
+		},
+		{
+			name:     "Should ignore changes to files that are not package inputs",
+			changes:  "README.md,internal/shared/README.md,cmd/server/notes.txt",
+			want:     []string{},
+			binaries: map[string][]string{},
+		},
+		{
+			name:     "Should affect the module but no binaries on test changes",
+			changes:  "internal/shared/shared_test.go,internal/shared/testdata/input.json",
+			want:     []string{"."},
+			binaries: map[string][]string{},
+		},
+		{
+			name:     "Should affect the binary with a changed Dockerfile",
+			changes:  "cmd/worker/Dockerfile",
+			want:     []string{"."},
+			binaries: map[string][]string{".": {"worker"}},
+		},
+		{
+			name:     "Should affect the module of a deleted package",
+			changes:  "internal/removed/removed.go",
+			want:     []string{"."},
+			binaries: map[string][]string{},
+		},
+		{
+			name:     "Should change every module on workflow changes",
+			changes:  ".github/workflows/cicd.yaml",
+			want:     []string{".", "app", "lib", "tools/lint"},
+			binaries: map[string][]string{".": {"server", "worker"}, "app": {"api"}},
+		},
+		{
+			name:     "Should change every module on ADDITIONAL_GLOBS_GO",
+			changes:  "api/v1/service.proto",
+			globs:    "api/**",
+			want:     []string{".", "app", "lib", "tools/lint"},
+			binaries: map[string][]string{".": {"server", "worker"}, "app": {"api"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			writeGoMod(t, ".", "1.25.0")
+			writeFile(t, "internal/shared/shared.go", "package shared\n\nimport \"embed\"\n\nconst Name = \"shared\"\n\n//go:embed migrations/*.sql\nvar Migrations embed.FS\n")
+			writeFile(t, "internal/shared/shared_test.go", "package shared\n")
+			writeFile(t, "internal/shared/README.md", "# shared\n")
+			writeFile(t, "cmd/worker/Dockerfile", "FROM scratch\n")
+			writeFile(t, "internal/shared/migrations/001.sql", "CREATE TABLE shared (name TEXT);\n")
+			writeFile(t, "cmd/server/main.go", "package main\n\nimport \"example.com/m/internal/shared\"\n\nfunc main() { println(shared.Name) }\n")
+			writeFile(t, "cmd/worker/main.go", "package main\n\nimport _ \"embed\"\n\n//go:embed static/index.html\nvar index string\n\nfunc main() { println(index) }\n")
+			writeFile(t, "cmd/worker/static/index.html", "<html></html>\n")
+			writeFile(t, "lib/go.mod", "module example.com/lib\n\ngo 1.25.0\n")
+			writeFile(t, "lib/lib.go", "package lib\n\nconst Name = \"lib\"\n")
+			writeFile(t, "app/go.mod", "module example.com/app\n\ngo 1.25.0\n\nrequire example.com/lib v0.0.0\n\nreplace example.com/lib => ../lib\n")
+			writeFile(t, "app/cmd/api/main.go", "package main\n\nimport \"example.com/lib\"\n\nfunc main() { println(lib.Name) }\n")
+			writeGoMod(t, "tools/lint", "1.25.0")
+			writeFile(t, "tools/lint/main.go", "package main\n\nfunc main() {}\n")
+			t.Setenv("CHANGED_FILES", tt.changes)
+			t.Setenv("ADDITIONAL_GLOBS_GO", tt.globs)
+
+			modules, err := FindGoModules(".")
+			assert.NoError(t, err)
+			got, err := AffectedModules(modules, "v")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got.Modules)
+			assert.Equal(t, tt.binaries, got.Binaries)
+		})
+	}
+}
+
+func TestFindGoModule(t *testing.T) {
+	t.Chdir(t.TempDir())
+	writeGoMod(t, "app", "1.24.0")
+	writeGoMod(t, "lib", "1.24.0")
+
+	got, err := FindGoModule(".", "./app/")
+	assert.NoError(t, err)
+	assert.Equal(t, "app", got)
+
+	_, err = FindGoModule(".", "cmd")
+	assert.EqualError(t, err, `"cmd" is not a Go module, found: app, lib`)
+}
+
+func TestMatrixJobs(t *testing.T) {
+	t.Chdir(t.TempDir())
+	writeGoMod(t, "app", "1.24.0")
+
+	jobs, err := MatrixJobs(Affected{Modules: []string{"app"}, Binaries: map[string][]string{"app": {"server"}}})
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+	assert.Equal(t, "go-app", jobs[0].Name)
+	assert.Equal(t, map[string]any{"go_version": "1.24.0", "binaries": []string{"server"}}, jobs[0].Metadata)
+}
+
+func TestDiscoverGoModules(t *testing.T) {
+	t.Chdir(t.TempDir())
+	writeGoMod(t, ".", "1.25.0")
+	writeGoMod(t, "tools", "1.25.0")
+	writeGoMod(t, "internal/parser/testdata/broken", "1.25.0")
+	writeGoMod(t, "vendor/example.com/dep", "1.25.0")
+	t.Setenv("DISCOVERY_EXCLUDE", "")
+	t.Setenv("DISCOVERY_INCLUDE", "")
+
+	modules, err := FindGoModules(".")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{".", "tools"}, modules)
+
+	decisions, err := DiscoverGoModules(".", true)
+	assert.NoError(t, err)
+	assert.Equal(t, []core.Decision{
+		{Path: ".", Included: true, Reason: "contains go.mod"},
+		{Path: "internal/parser/testdata/broken", Reason: "testdata directory"},
+		{Path: "tools", Included: true, Reason: "contains go.mod"},
+		{Path: "vendor/example.com/dep", Reason: "vendor directory"},
+	}, decisions)
+
+	t.Setenv("DISCOVERY_INCLUDE", "internal/parser/testdata/")
+	modules, err = FindGoModules(".")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{".", "internal/parser/testdata/broken", "tools"}, modules)
+}
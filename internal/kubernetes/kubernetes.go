@@ -4,7 +4,6 @@ package kubernetes
 import (
 	"bytes"
 	"fmt"
-	"io/fs"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -33,13 +32,6 @@ type HelmChart struct {
 	valueFiles []string
 }
 
-func isHelmChart(p string, d fs.DirEntry) bool {
-	if !d.IsDir() {
-		return false
-	}
-	return core.FileExists(filepath.Join(p, "Chart.yaml"))
-}
-
 // RenderTemplates renders the templates of a specific helm chart. It required
 // a destination. If the dest is a folder it will render the files separate. If
 // it is a file, then it will render all in 1 temiplate.
@@ -145,7 +137,11 @@ func DiffTemplates(chart HelmChart) error {
 		return err
 	}
 
-	mainWorktree, worktreeCleanup, err := git.Worktree("main")
+	mainRef, err := git.DefaultBranchRef()
+	if err != nil {
+		return err
+	}
+	mainWorktree, worktreeCleanup, err := git.Worktree(mainRef)
 	if err != nil {
 		return err
 	}
@@ -206,18 +202,7 @@ func DiffTemplates(chart HelmChart) error {
 		}
 
 		searchString := fmt.Sprintf("### Kubernetes templates for %s", title)
-
-		found, id, err := github.FindCommentInPR(searchString)
-		if err != nil {
-			return err
-		}
-		if found {
-			err := github.HideComment(id)
-			if err != nil {
-				return err
-			}
-		}
-		return github.CreateCommentInPR(path)
+		return github.StickyCommentInPR(searchString, path)
 	}
 	return err
 }
@@ -264,40 +249,66 @@ func diffMarkdownTemplate(title, summary, diff string, limit int) (string, error
 	return buf.String(), err
 }
 
+// discoveryExcludes are excluded from the discovery of helm charts in
+// addition to [core.DefaultExcludes]
+var discoveryExcludes = []core.Rule{
+	{Pattern: "testdata/", Reason: "testdata directory"},
+}
+
 // FindHelmCharts will search through the base directory to find the
-// all helm charts
+// all helm charts, see [DiscoverHelmCharts]
 func FindHelmCharts(base string) ([]HelmChart, error) {
+	charts, _, err := discoverHelmCharts(base, false)
+	return charts, err
+}
+
+// DiscoverHelmCharts returns a decision for every helm chart and environment
+// in the base directory, see [core.Discovery]. The environment is part of the
+// reason. Charts in excluded directories are only returned when all is true.
+func DiscoverHelmCharts(base string, all bool) ([]core.Decision, error) {
+	_, decisions, err := discoverHelmCharts(base, all)
+	return decisions, err
+}
+
+func discoverHelmCharts(base string, all bool) ([]HelmChart, []core.Decision, error) {
+	discovery, err := core.NewDiscovery(base, discoveryExcludes...)
+	if err != nil {
+		return nil, nil, err
+	}
 	directories := []string{}
+	decisions := []core.Decision{}
 	charts := []HelmChart{}
 
-	err := filepath.WalkDir(base, func(workDir string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		if core.IsDotDirectory(workDir, d) {
-			return filepath.SkipDir
+	err = discovery.Walk(all, func(dir core.Dir, excluded bool, reason string) error {
+		if !dir.Has("Chart.yaml") {
+			return nil
 		}
-		if !isHelmChart(workDir, d) {
+		if excluded {
+			decisions = append(decisions, core.Decision{Path: dir.Path, Reason: reason})
 			return nil
 		}
-		directories = append(directories, workDir)
+		directories = append(directories, dir.Path)
 		return nil
 	})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	for _, dir := range directories {
 		envs, err := detectHelmEnvironments(dir)
 		if err != nil {
-			return charts, err
+			return nil, nil, err
+		}
+		if len(envs) == 0 {
+			decisions = append(decisions, core.Decision{Path: dir, Reason: "no values-<environment>.yaml files"})
 		}
 		for _, env := range envs {
 			valueFiles, err := findHelmValues(dir, env)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			// skip if we find no env specific values
 			if len(valueFiles) == 0 {
+				decisions = append(decisions, core.Decision{Path: dir, Reason: fmt.Sprintf("no values for %s", env)})
 				continue
 			}
 			slices.Reverse(valueFiles)
@@ -306,9 +317,10 @@ func FindHelmCharts(base string) ([]HelmChart, error) {
 				env:        env,
 				valueFiles: valueFiles,
 			})
+			decisions = append(decisions, core.Decision{Path: dir, Included: true, Reason: fmt.Sprintf("values for %s: %s", env, strings.Join(valueFiles, ", "))})
 		}
 	}
-	return charts, nil
+	return charts, decisions, nil
 }
 
 // ListHelmCharts list the found helm charts in this repository
@@ -462,3 +474,67 @@ func detectHelmEnvironments(dir string) ([]string, error) {
 	}
 	return environments, nil
 }
+
+// MatrixJobs returns a GitHub Actions matrix job per helm chart and
+// environment. The metadata of a job is the directory of the chart, the
+// environment and the value files.
+func MatrixJobs(charts []HelmChart) []github.MatrixJob {
+	jobs := []github.MatrixJob{}
+	for _, chart := range charts {
+		name := github.JobName("helm", filepath.ToSlash(filepath.Clean(chart.path)), chart.env)
+		jobs = append(jobs, github.MatrixJob{
+			Key:  name,
+			Name: name,
+			Metadata: map[string]any{
+				"directory":   chart.path,
+				"environment": chart.env,
+				"value_files": chart.valueFiles,
+			},
+		})
+	}
+	return jobs
+}
+
+// FindHelmChart returns the helm chart in directory for environment env. If
+// there is no such chart in base an error listing the charts is returned.
+func FindHelmChart(base, directory, env string) (HelmChart, error) {
+	charts, err := FindHelmCharts(base)
+	if err != nil {
+		return HelmChart{}, err
+	}
+	found := []string{}
+	for _, chart := range charts {
+		if filepath.Clean(chart.path) == filepath.Clean(directory) && chart.env == env {
+			return chart, nil
+		}
+		found = append(found, fmt.Sprintf("%s %s", chart.path, chart.env))
+	}
+	return HelmChart{}, fmt.Errorf("no helm chart %q with environment %q, found: %s", directory, env, strings.Join(found, ", "))
+}
+
+// ChangedCharts returns the helm charts with changes compared to the main
+// branch. Changes to go.mod, go.sum and the workflows change every chart.
+func ChangedCharts(charts []HelmChart) ([]HelmChart, error) {
+	changedFiles, err := git.DiffToMain()
+	if err != nil {
+		return nil, err
+	}
+	additionalGlobs := []string{"go.mod", "go.sum", ".github/workflows/*"}
+	all, err := core.CompareChangesToPaths(changedFiles, []string{}, additionalGlobs)
+	if err != nil {
+		return nil, err
+	}
+	result := []HelmChart{}
+	for _, chart := range charts {
+		changed := all
+		for _, file := range changedFiles {
+			if strings.HasPrefix(filepath.Clean(file), filepath.Clean(chart.path)+string(filepath.Separator)) {
+				changed = true
+			}
+		}
+		if changed {
+			result = append(result, chart)
+		}
+	}
+	return result, nil
+}
@@ -208,3 +208,83 @@ func TestTemplateRender(t *testing.T) {
 		})
 	}
 }
+
+func TestFindHelmChart(t *testing.T) {
+	tests := []struct {
+		name      string
+		directory string
+		env       string
+		want      string
+		wantErr   string
+	}{
+		{
+			name:      "Should find a chart for an environment",
+			directory: "./infrastructure/kubernetes/helm/charts/charta/",
+			env:       "staging",
+			want:      "infrastructure/kubernetes/helm/charts/charta",
+		},
+		{
+			name:      "Should list the charts for an unknown environment",
+			directory: "infrastructure/kubernetes/helm/charts/chartb",
+			env:       "production",
+			wantErr:   "infrastructure/kubernetes/helm/charts/chartb dev",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir("testdata/repo")
+			got, err := FindHelmChart(".", tt.directory, tt.env)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got.path)
+			assert.Equal(t, tt.env, got.env)
+		})
+	}
+}
+
+func TestChangedCharts(t *testing.T) {
+	tests := []struct {
+		name    string
+		changes string
+		want    []string
+	}{
+		{
+			name:    "Should include the environments of a changed chart",
+			changes: "infrastructure/kubernetes/helm/charts/chartb/templates/deployment.yaml",
+			want:    []string{"helm-infrastructure-kubernetes-helm-charts-chartb-dev"},
+		},
+		{
+			name:    "Should include every chart on workflow changes",
+			changes: ".github/workflows/cicd.yaml",
+			want: []string{
+				"helm-infrastructure-kubernetes-helm-charts-charta-fail",
+				"helm-infrastructure-kubernetes-helm-charts-charta-production",
+				"helm-infrastructure-kubernetes-helm-charts-charta-staging",
+				"helm-infrastructure-kubernetes-helm-charts-chartb-dev",
+			},
+		},
+		{
+			name:    "Should not include charts without changes",
+			changes: "README.md",
+			want:    []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir("testdata/repo")
+			t.Setenv("CHANGED_FILES", tt.changes)
+			charts, err := FindHelmCharts(".")
+			assert.NoError(t, err)
+			changed, err := ChangedCharts(charts)
+			assert.NoError(t, err)
+			names := []string{}
+			for _, job := range MatrixJobs(changed) {
+				names = append(names, job.Name)
+			}
+			assert.ElementsMatch(t, tt.want, names)
+		})
+	}
+}
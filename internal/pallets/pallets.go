@@ -2,7 +2,6 @@
 package pallets
 
 import (
-	"os"
 	"path/filepath"
 
 	"github.com/coopnorge/mage/internal/core"
@@ -56,18 +55,38 @@ func HasChanges() (bool, error) {
 	return core.CompareChangesToPaths(changedFiles, palletFiles, additionalGlobs)
 }
 
-func getPalletFiles() ([]string, error) {
-	palletList := []string{}
-	pallets, err := os.ReadDir(".pallet")
-	if os.IsNotExist(err) {
-		return palletList, nil
-	}
+// palletDir contains the pallet files of the repository
+const palletDir = ".pallet"
+
+// DiscoverPallets returns a decision for every file in the pallet directory,
+// see [core.Discovery]. The pallet directory is included even though it is a
+// dot directory.
+func DiscoverPallets() ([]core.Decision, error) {
+	decisions := []core.Decision{}
+	discovery, err := core.NewDiscovery(".", core.Rule{Pattern: "!/" + palletDir + "/", Reason: "pallet directory"})
 	if err != nil {
-		return palletList, err
+		return nil, err
+	}
+	dir, ok := discovery.Dir(palletDir)
+	if !ok {
+		return decisions, nil
 	}
 
-	for _, p := range pallets {
-		palletList = append(palletList, filepath.Join(".pallet", p.Name()))
+	for _, name := range dir.Files {
+		file := filepath.Join(palletDir, name)
+		if excluded, reason := discovery.Excluded(file, false); excluded {
+			decisions = append(decisions, core.Decision{Path: file, Reason: reason})
+			continue
+		}
+		decisions = append(decisions, core.Decision{Path: file, Included: true, Reason: "pallet file"})
+	}
+	return decisions, nil
+}
+
+func getPalletFiles() ([]string, error) {
+	decisions, err := DiscoverPallets()
+	if err != nil {
+		return nil, err
 	}
-	return palletList, nil
+	return core.IncludedPaths(decisions), nil
 }
@@ -20,7 +20,10 @@ func Validate() error {
 	}
 
 	// Check for config file
-	configPath := getConfigPath()
+	configPath, err := getConfigPath()
+	if err != nil {
+		return err
+	}
 	if _, err := os.Stat(filepath.Join(cwd, configPath)); err != nil {
 		if os.IsNotExist(err) {
 			// No config file → do nothing
@@ -41,14 +44,18 @@ func HasChanges() (bool, error) {
 	}
 	// always trigger on go.mod/sum and workflows because of changes in ci.
 	additionalGlobs := []string{"go.mod", "go.sum", ".github/workflows/*"}
-	return core.CompareChangesToPaths(changedFiles, []string{getConfigPath()}, additionalGlobs)
+	configPath, err := getConfigPath()
+	if err != nil {
+		return false, err
+	}
+	return core.CompareChangesToPaths(changedFiles, []string{configPath}, additionalGlobs)
 }
 
-func getConfigPath() string {
-	configPath := os.Getenv("POLICY_CONFIG_FILE_PATH")
-	if configPath == "" {
-		configPath = ".policy.yml"
+func getConfigPath() (string, error) {
+	config, err := core.CurrentConfig()
+	if err != nil {
+		return "", err
 	}
-	log.Printf("Using config: %s\n", configPath)
-	return configPath
+	log.Printf("Using config: %s\n", config.PolicyBot.ConfigFilePath)
+	return config.PolicyBot.ConfigFilePath, nil
 }
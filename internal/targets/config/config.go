@@ -0,0 +1,34 @@
+// Package config contains targets related to the configuration of the targets
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/coopnorge/mage/internal/core"
+)
+
+// Show prints the effective configuration, every setting with its value,
+// where the value came from and the environment variable overriding it
+func Show(_ context.Context) error {
+	config, err := core.CurrentConfig()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SETTING\tVALUE\tSOURCE\tENV")
+	for _, setting := range core.Settings {
+		value, err := config.Value(setting.Key)
+		if err != nil {
+			return err
+		}
+		if list, ok := value.([]string); ok {
+			value = strings.Join(list, ",")
+		}
+		fmt.Fprintf(w, "%s\t%v\t%s\t%s\n", setting.Key, value, config.Sources[setting.Key], setting.Env)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,47 @@
+// Package discover contains targets related to the discovery of Go modules,
+// Terraform projects, Helm charts and pallets
+package discover
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/coopnorge/mage/internal/core"
+	"github.com/coopnorge/mage/internal/golang"
+	"github.com/coopnorge/mage/internal/kubernetes"
+	"github.com/coopnorge/mage/internal/pallets"
+	"github.com/coopnorge/mage/internal/terraform"
+)
+
+// Discover prints every Go module, Terraform project, Helm chart environment
+// and pallet file in the repository, whether it is included or skipped and
+// why. Candidates in excluded directories are listed as skipped.
+func Discover(_ context.Context) error {
+	kinds := []struct {
+		name     string
+		discover func() ([]core.Decision, error)
+	}{
+		{"go", func() ([]core.Decision, error) { return golang.DiscoverGoModules(".", true) }},
+		{"terraform", func() ([]core.Decision, error) { return terraform.DiscoverTerraformProjects(".", true) }},
+		{"helm", func() ([]core.Decision, error) { return kubernetes.DiscoverHelmCharts(".", true) }},
+		{"pallet", pallets.DiscoverPallets},
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tPATH\tSTATUS\tREASON")
+	for _, kind := range kinds {
+		decisions, err := kind.discover()
+		if err != nil {
+			return err
+		}
+		for _, decision := range decisions {
+			status := "skipped"
+			if decision.Included {
+				status = "included"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", kind.name, decision.Path, status, decision.Reason)
+		}
+	}
+	return w.Flush()
+}
@@ -7,7 +7,8 @@ import (
 	"github.com/coopnorge/mage/internal/git"
 )
 
-// ListChanges list all changes compared to origin/main
+// ListChanges list all changes compared to the merge-base with the default
+// branch
 func ListChanges(_ context.Context) error {
 	changes, err := git.DiffToMain()
 	if err != nil {
@@ -3,10 +3,12 @@ package golang
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 
 	"github.com/coopnorge/mage/internal/devtool"
 	golangcilint "github.com/coopnorge/mage/internal/devtool/golangci-lint"
+	"github.com/coopnorge/mage/internal/github"
 	"github.com/coopnorge/mage/internal/golang"
 	"github.com/magefile/mage/mg"
 )
@@ -54,6 +56,16 @@ func test(_ context.Context, workingDirectory string) error {
 	return golang.Test(workingDirectory)
 }
 
+// TestDir runs the tests of a single Go module
+func TestDir(ctx context.Context, directory string) error {
+	module, err := golang.FindGoModule(".", directory)
+	if err != nil {
+		return err
+	}
+	mg.SerialCtxDeps(ctx, mg.F(test, module))
+	return nil
+}
+
 // Lint runs the linters
 func Lint(ctx context.Context) error {
 	directories, err := golang.FindGoModules(".")
@@ -74,6 +86,16 @@ func lint(_ context.Context, workingDirectory string) error {
 	return golang.Lint(workingDirectory, golangcilint.Cfg())
 }
 
+// LintDir runs the linters for a single Go module
+func LintDir(ctx context.Context, directory string) error {
+	module, err := golang.FindGoModule(".", directory)
+	if err != nil {
+		return err
+	}
+	mg.SerialCtxDeps(ctx, mg.F(lint, module))
+	return nil
+}
+
 // LintFix fixes found issues (if it's supported by the linters)
 func LintFix(ctx context.Context) error {
 	directories, err := golang.FindGoModules(".")
@@ -115,19 +137,20 @@ func downloadModules(_ context.Context, directory string) error {
 }
 
 // Changes implements a target that check if the current branch has changes
-// related to main branch
+// affecting a Go module compared to the most recent release tag matching
+// pattern, see [golang.AffectedModules]
 func Changes(_ context.Context, pattern string) error {
-	directories, err := golang.FindGoSourceCodeFolders(".")
+	directories, err := golang.FindGoModules(".")
 	if err != nil {
 		return err
 	}
 
-	changes, err := golang.HasChanges(directories, pattern)
+	affected, err := golang.AffectedModules(directories, pattern)
 	if err != nil {
 		return err
 	}
 
-	if changes {
+	if len(affected.Modules) > 0 {
 		fmt.Println("true")
 		return nil
 	}
@@ -135,6 +158,57 @@ func Changes(_ context.Context, pattern string) error {
 	return nil
 }
 
+// Affected prints the Go modules and the binaries in cmd/<binary> affected by
+// the changes compared to the most recent release tag matching pattern as
+// JSON, see [golang.AffectedModules]
+func Affected(_ context.Context, pattern string) error {
+	directories, err := golang.FindGoModules(".")
+	if err != nil {
+		return err
+	}
+	affected, err := golang.AffectedModules(directories, pattern)
+	if err != nil {
+		return err
+	}
+	out, err := json.Marshal(affected)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+	return nil
+}
+
+// GitHubActionsJobMatrix returns a matrix which is used in Github Actions to
+// generate a job per Go module affected by changes compared to the most
+// recent release tag matching pattern. Every job has a stable name and the
+// metadata described in [golang.MatrixJobs].
+func GitHubActionsJobMatrix(_ context.Context, pattern string) error {
+	directories, err := golang.FindGoModules(".")
+	if err != nil {
+		return err
+	}
+	affected, err := golang.AffectedModules(directories, pattern)
+	if err != nil {
+		return err
+	}
+	jobs, err := golang.MatrixJobs(affected)
+	if err != nil {
+		return err
+	}
+	return github.PrintMatrix(github.Matrix{Dimension: "directory", Jobs: jobs})
+}
+
+// ValidateModule downloads the modules, runs the tests and the linters of a
+// single Go module
+func ValidateModule(ctx context.Context, directory string) error {
+	module, err := golang.FindGoModule(".", directory)
+	if err != nil {
+		return err
+	}
+	mg.SerialCtxDeps(ctx, mg.F(downloadModules, module), mg.F(test, module), mg.F(lint, module))
+	return nil
+}
+
 // FetchGolangCIConfig fetches and writes the golangci-lint configuration file
 // to the specified directory relative to the repository root.
 // The config file will be named .golangci-lint.yaml.
@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/coopnorge/mage/internal/core"
+	"github.com/coopnorge/mage/internal/github"
 	"github.com/coopnorge/mage/internal/kubernetes"
 )
 
@@ -34,6 +35,24 @@ func Validate(ctx context.Context) error {
 	return nil
 }
 
+// ValidateChart runs kubeconform, kube-score and render templates for a
+// single helm chart and environment
+func ValidateChart(ctx context.Context, directory, env string) error {
+	chart, err := kubernetes.FindHelmChart(".", directory, env)
+	if err != nil {
+		return err
+	}
+	err = render(ctx, chart)
+	if err != nil {
+		return err
+	}
+	err = kubeconform(ctx, chart)
+	if err != nil {
+		return err
+	}
+	return kubescore(ctx, chart)
+}
+
 func render(_ context.Context, chart kubernetes.HelmChart) error {
 	dest, cleanup, err := core.MkdirTemp()
 	defer cleanup()
@@ -91,3 +110,18 @@ func Changes(_ context.Context) error {
 	fmt.Println("false")
 	return nil
 }
+
+// GitHubActionsJobMatrix returns a matrix which is used in Github Actions to
+// generate a job per changed helm chart and environment. Every job has a
+// stable name and the metadata described in [kubernetes.MatrixJobs].
+func GitHubActionsJobMatrix(_ context.Context) error {
+	charts, err := kubernetes.FindHelmCharts(".")
+	if err != nil {
+		return err
+	}
+	changed, err := kubernetes.ChangedCharts(charts)
+	if err != nil {
+		return err
+	}
+	return github.PrintMatrix(github.Matrix{Dimension: "name", Jobs: kubernetes.MatrixJobs(changed)})
+}
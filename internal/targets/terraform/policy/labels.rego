@@ -0,0 +1,17 @@
+# Resources supporting labels should be labelled, labels set through the
+# default_labels of the provider are included in terraform_labels.
+package terraform.labels
+
+warn contains {"msg": msg, "resource": rc.address} if {
+	some rc in input.resource_changes
+	rc.mode == "managed"
+	some action in rc.change.actions
+	action in {"create", "update"}
+	object.get(rc.change.after, "labels", "unsupported") != "unsupported"
+	not has_labels(rc.change.after)
+	msg := sprintf("%s has no labels", [rc.address])
+}
+
+has_labels(after) if count(after.labels) > 0
+
+has_labels(after) if count(after.terraform_labels) > 0
@@ -0,0 +1,35 @@
+# Storage buckets must not be readable by everyone on the internet.
+package terraform.public_buckets
+
+public_members := {"allUsers", "allAuthenticatedUsers"}
+
+public_acls := {"public-read", "public-read-write", "authenticated-read"}
+
+changed contains rc if {
+	some rc in input.resource_changes
+	rc.mode == "managed"
+	some action in rc.change.actions
+	action in {"create", "update"}
+}
+
+deny contains {"msg": msg, "resource": rc.address} if {
+	some rc in changed
+	rc.type == "google_storage_bucket_iam_member"
+	rc.change.after.member in public_members
+	msg := sprintf("%s grants %s access to a storage bucket", [rc.address, rc.change.after.member])
+}
+
+deny contains {"msg": msg, "resource": rc.address} if {
+	some rc in changed
+	rc.type == "google_storage_bucket_iam_binding"
+	some member in rc.change.after.members
+	member in public_members
+	msg := sprintf("%s grants %s access to a storage bucket", [rc.address, member])
+}
+
+deny contains {"msg": msg, "resource": rc.address} if {
+	some rc in changed
+	rc.type == "aws_s3_bucket_acl"
+	rc.change.after.acl in public_acls
+	msg := sprintf("%s makes a S3 bucket public with the %s ACL", [rc.address, rc.change.after.acl])
+}
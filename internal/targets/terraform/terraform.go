@@ -2,12 +2,16 @@ package terraform
 
 import (
 	"context"
-	_ "embed"
+	"embed"
 	"encoding/json"
 	"fmt"
+	"io/fs"
 	"os"
-	"strconv"
+	"path/filepath"
+	"slices"
 
+	"github.com/coopnorge/mage/internal/core"
+	"github.com/coopnorge/mage/internal/github"
 	"github.com/coopnorge/mage/internal/terraform"
 	"github.com/magefile/mage/mg"
 )
@@ -17,6 +21,12 @@ import (
 //go:embed .tflint.hcl
 var TFlintCfg string
 
+// Policies are the Rego policies evaluated against the plans of terraform
+// projects
+//
+//go:embed policy/*.rego
+var Policies embed.FS
+
 // Test runs terraform validate
 func Test(ctx context.Context) error {
 	directories, err := terraform.FindTerraformProjects(".")
@@ -27,10 +37,7 @@ func Test(ctx context.Context) error {
 
 	var testDirs []any
 	var checkLocks []any
-	for _, workDir := range directories {
-		if skipIfNoChanges(workDir) {
-			continue
-		}
+	for _, workDir := range skipUnchanged(directories) {
 		testDirs = append(testDirs, mg.F(test, workDir))
 		checkLocks = append(checkLocks, mg.F(checkLock, workDir))
 	}
@@ -48,6 +55,16 @@ func checkLock(_ context.Context, workingDirectory string) error {
 	return terraform.CheckLock(workingDirectory)
 }
 
+// TestDir runs terraform validate for a single terraform project
+func TestDir(ctx context.Context, directory string) error {
+	project, err := terraform.FindTerraformProject(".", directory)
+	if err != nil {
+		return err
+	}
+	mg.SerialCtxDeps(ctx, mg.F(checkLock, project), mg.F(test, project))
+	return nil
+}
+
 // Lint runs the linters
 func Lint(ctx context.Context) error {
 	directories, err := terraform.FindTerraformProjects(".")
@@ -56,10 +73,7 @@ func Lint(ctx context.Context) error {
 	}
 
 	lintDirs := []any{}
-	for _, workDir := range directories {
-		if skipIfNoChanges(workDir) {
-			continue
-		}
+	for _, workDir := range skipUnchanged(directories) {
 		lintDirs = append(lintDirs, mg.F(lint, workDir))
 	}
 
@@ -71,6 +85,32 @@ func lint(_ context.Context, workingDirectory string) error {
 	return terraform.Lint(workingDirectory, TFlintCfg)
 }
 
+// LintDir runs the linters for a single terraform project
+func LintDir(ctx context.Context, directory string) error {
+	project, err := terraform.FindTerraformProject(".", directory)
+	if err != nil {
+		return err
+	}
+	mg.SerialCtxDeps(ctx, mg.F(lint, project))
+	return nil
+}
+
+// ValidateDir initializes, tests, lints and scans a single terraform project
+func ValidateDir(ctx context.Context, directory string) error {
+	project, err := terraform.FindTerraformProject(".", directory)
+	if err != nil {
+		return err
+	}
+	mg.SerialCtxDeps(ctx,
+		mg.F(initTerraform, project),
+		mg.F(checkLock, project),
+		mg.F(test, project),
+		mg.F(lint, project),
+		mg.F(security, project),
+	)
+	return nil
+}
+
 // LintFix fixes found issues (if it's supported by the linters)
 func LintFix(ctx context.Context) error {
 	directories, err := terraform.FindTerraformProjects(".")
@@ -79,10 +119,7 @@ func LintFix(ctx context.Context) error {
 	}
 
 	lintDirs := []any{}
-	for _, workDir := range directories {
-		if skipIfNoChanges(workDir) {
-			continue
-		}
+	for _, workDir := range skipUnchanged(directories) {
 		lintDirs = append(lintDirs, mg.F(lintFix, workDir))
 	}
 
@@ -103,10 +140,7 @@ func Init(ctx context.Context) error {
 		return err
 	}
 	modules := []any{}
-	for _, workDir := range directories {
-		if skipIfNoChanges(workDir) {
-			continue
-		}
+	for _, workDir := range skipUnchanged(directories) {
 		fmt.Println("adding dep initTerraform", workDir)
 		modules = append(modules, mg.F(initTerraform, workDir))
 	}
@@ -128,10 +162,7 @@ func InitUpgrade(ctx context.Context) error {
 		return err
 	}
 	modules := []any{}
-	for _, workDir := range directories {
-		if skipIfNoChanges(workDir) {
-			continue
-		}
+	for _, workDir := range skipUnchanged(directories) {
 		modules = append(modules, mg.F(initUpgrade, workDir))
 	}
 
@@ -150,10 +181,7 @@ func LockProviders(ctx context.Context) error {
 		return err
 	}
 	modules := []any{}
-	for _, workDir := range directories {
-		if skipIfNoChanges(workDir) {
-			continue
-		}
+	for _, workDir := range skipUnchanged(directories) {
 		modules = append(modules, mg.F(lockProviders, workDir))
 	}
 
@@ -192,10 +220,7 @@ func Security(ctx context.Context) error {
 		return err
 	}
 	modules := []any{}
-	for _, workDir := range directories {
-		if skipIfNoChanges(workDir) {
-			continue
-		}
+	for _, workDir := range skipUnchanged(directories) {
 		modules = append(modules, mg.F(security, workDir))
 	}
 
@@ -207,6 +232,93 @@ func security(_ context.Context, directory string) error {
 	return terraform.Security(directory)
 }
 
+// Cost estimates the monthly cost delta of the changed terraform projects
+// from their plan JSON. Projects without a current plan JSON in
+// var/terraform/<project>/plan.json are initialized and planned.
+func Cost(ctx context.Context) error {
+	source, err := terraform.NewPricingSource()
+	if err != nil {
+		return err
+	}
+	if source == nil {
+		fmt.Println("Skipping cost estimation, no pricing source configured")
+		return nil
+	}
+
+	directories, err := planProjects(ctx)
+	if err != nil {
+		return err
+	}
+
+	estimates := []terraform.CostEstimate{}
+	for _, workDir := range directories {
+		estimate, err := terraform.EstimateCost(workDir, terraform.PlanJSONPath(workDir), source)
+		if err != nil {
+			return err
+		}
+		estimates = append(estimates, estimate)
+	}
+	return terraform.ReportCost(estimates)
+}
+
+// Policy evaluates the embedded Rego policies and the policies in the policy
+// directories of the repository against the plan JSON of the changed
+// terraform projects. Projects without a current plan JSON in
+// var/terraform/<project>/plan.json are initialized and planned.
+func Policy(ctx context.Context) error {
+	directories, err := planProjects(ctx)
+	if err != nil {
+		return err
+	}
+
+	modules := []any{}
+	for _, workDir := range directories {
+		modules = append(modules, mg.F(policy, workDir))
+	}
+	mg.SerialCtxDeps(ctx, modules...)
+	return nil
+}
+
+func policy(_ context.Context, directory string) error {
+	policies, err := fs.Sub(Policies, "policy")
+	if err != nil {
+		return err
+	}
+	return terraform.Policy(directory, policies)
+}
+
+// planProjects returns the changed terraform projects that are deployed, it
+// initializes and plans projects without a current plan JSON, see
+// [terraform.HasCurrentPlanJSON]. Modules are skipped since they are not
+// deployed on their own.
+func planProjects(ctx context.Context) ([]string, error) {
+	directories, err := terraform.FindTerraformProjects(".")
+	if err != nil {
+		return nil, err
+	}
+	plans := []any{}
+	projects := []string{}
+	for _, workDir := range skipUnchanged(directories) {
+		if terraform.HasTerraformDocsConfig(workDir) || terraform.IsTerraformSubmodule(workDir) {
+			continue
+		}
+		projects = append(projects, workDir)
+		current, err := terraform.HasCurrentPlanJSON(workDir)
+		if err != nil {
+			return nil, err
+		}
+		if !current {
+			plans = append(plans, mg.F(initTerraform, workDir), mg.F(plan, workDir))
+		}
+	}
+	mg.SerialCtxDeps(ctx, plans...)
+	return projects, nil
+}
+
+func plan(_ context.Context, directory string) error {
+	return terraform.Plan(directory)
+}
+
 // DocsValidate implements validation of terraform module documentation
 func DocsValidate(ctx context.Context) error {
 	if err := checkTerraformDocsConfig("."); err != nil {
@@ -218,10 +330,7 @@ func DocsValidate(ctx context.Context) error {
 		return err
 	}
 	modules := []any{}
-	for _, workDir := range directories {
-		if skipIfNoChanges(workDir) {
-			continue
-		}
+	for _, workDir := range skipUnchanged(directories) {
 		modules = append(modules, mg.F(terraformDocs, workDir))
 	}
 
@@ -244,10 +353,7 @@ func DocsValidateFix(ctx context.Context) error {
 		return err
 	}
 	modules := []any{}
-	for _, workDir := range directories {
-		if skipIfNoChanges(workDir) {
-			continue
-		}
+	for _, workDir := range skipUnchanged(directories) {
 		modules = append(modules, mg.F(terraformDocsFix, workDir))
 	}
 
@@ -286,47 +392,93 @@ func Changes(_ context.Context) error {
 	return nil
 }
 
-// skipIfNoChanges will check if the supplied directory has changes compared to
-// the git diff. Will retuyrn true if it can be skipped.
-func skipIfNoChanges(directory string) bool {
-	// try to fetch from env far
-	terraformSkipEnv := os.Getenv("TERRAFORM_SKIP_IF_NO_CHANGES_IN_DIR")
-	onlyOnChangesInDir, err := strconv.ParseBool(terraformSkipEnv)
-	// if set to false or err != nil (env var not set, or invalid value)
-	if !onlyOnChangesInDir || err != nil {
-		return false
+// skipUnchanged returns the directories with changes compared to the main
+// branch when terraform.skip_if_no_changes_in_dir is set, see
+// [terraform.ChangedProjects]. The changes are detected once for all
+// directories, every directory is kept when they can not be detected.
+func skipUnchanged(directories []string) []string {
+	config, err := core.CurrentConfig()
+	if err != nil {
+		fmt.Printf("Not skipping unchanged directories, failed to load the configuration: %s\n", err)
+		return directories
+	}
+	if !config.Terraform.SkipIfNoChangesInDir {
+		return directories
 	}
-	changes, err := terraform.HasChanges([]string{directory})
+	changed, err := terraform.ChangedProjects(directories)
 	if err != nil {
-		return false
+		fmt.Printf("Not skipping unchanged directories, failed to detect the changes: %s\n", err)
+		return directories
 	}
-	if !changes {
-		fmt.Printf("Skipping because TERRAFORM_SKIP_IF_NO_CHANGES_IN_DIR=%s and non changes in dir %s\n", terraformSkipEnv, directory)
+	kept := []string{}
+	for _, directory := range directories {
+		if !slices.Contains(changed, directory) {
+			fmt.Printf("Skipping because terraform.skip_if_no_changes_in_dir is set (%s) and non changes in dir %s\n", config.Sources["terraform.skip_if_no_changes_in_dir"], directory)
+			continue
+		}
+		kept = append(kept, directory)
 	}
-	return !changes
+	return kept
 }
 
 // GitHubActionsJobMatrix returns a matrix which is used in Github Actions to
-// generate a matrix for parallel jobs
+// generate a matrix for parallel jobs. Projects using a changed local module
+// are included. Every job has a stable name and the metadata described in
+// [terraform.MatrixJobs], the wave of a project orders plan and apply.
 func GitHubActionsJobMatrix() error {
-	changedDirs := []string{}
-	directories, err := terraform.FindTerraformProjects(".")
+	matrix, err := jobMatrix()
 	if err != nil {
 		return err
 	}
-	for _, dir := range directories {
-		changes, err := terraform.HasChanges([]string{dir})
-		if err != nil {
-			return err
-		}
-		if changes {
-			changedDirs = append(changedDirs, dir)
-		}
+	return github.PrintMatrix(matrix)
+}
+
+// GitHubActionsJobMatrixInfo returns the number of jobs, the chunks and the
+// max-parallel hint of the matrix, see [GitHubActionsJobMatrixChunk]
+func GitHubActionsJobMatrixInfo() error {
+	matrix, err := jobMatrix()
+	if err != nil {
+		return err
 	}
-	payload := matrixConfig{
-		Directory: changedDirs,
+	return printMatrixInfo(matrix)
+}
+
+// GitHubActionsJobMatrixChunk returns a chunk of the matrix for repositories
+// with more projects than GitHub Actions allows jobs in a matrix
+func GitHubActionsJobMatrixChunk(_ context.Context, chunk int) error {
+	matrix, err := jobMatrix()
+	if err != nil {
+		return err
+	}
+	return printMatrixChunk(matrix, chunk)
+}
+
+func jobMatrix() (github.Matrix, error) {
+	directories, err := terraform.FindTerraformProjects(".")
+	if err != nil {
+		return github.Matrix{}, err
+	}
+	changedDirs, err := terraform.ChangedProjects(directories)
+	if err != nil {
+		return github.Matrix{}, err
+	}
+	graph, err := terraform.BuildGraph(directories)
+	if err != nil {
+		return github.Matrix{}, err
+	}
+	jobs, err := terraform.MatrixJobs(graph, changedDirs)
+	if err != nil {
+		return github.Matrix{}, err
+	}
+	return github.Matrix{Dimension: "directory", Jobs: jobs}, nil
+}
+
+func printMatrixInfo(matrix github.Matrix) error {
+	info, err := matrix.Info()
+	if err != nil {
+		return err
 	}
-	jsonData, err := json.Marshal(payload)
+	jsonData, err := json.Marshal(info)
 	if err != nil {
 		return err
 	}
@@ -334,6 +486,40 @@ func GitHubActionsJobMatrix() error {
 	return nil
 }
 
-type matrixConfig struct {
-	Directory []string `json:"directory"`
+func printMatrixChunk(matrix github.Matrix, chunk int) error {
+	m, err := matrix.Chunk(chunk)
+	if err != nil {
+		return err
+	}
+	return github.PrintMatrix(m)
+}
+
+// Graph renders the dependency graph of the terraform projects in the format
+// dot or mermaid. The graph is written to var/terraform/graph.<format>.
+func Graph(_ context.Context, format string) error {
+	directories, err := terraform.FindTerraformProjects(".")
+	if err != nil {
+		return err
+	}
+	graph, err := terraform.BuildGraph(directories)
+	if err != nil {
+		return err
+	}
+	var out string
+	switch format {
+	case "dot":
+		out = graph.DOT()
+	case "mermaid":
+		out = graph.Mermaid()
+	default:
+		return fmt.Errorf("unknown graph format %q, must be dot or mermaid", format)
+	}
+	fmt.Print(out)
+
+	file := filepath.Join(core.OutputDir, "terraform", fmt.Sprintf("graph.%s", format))
+	err = os.MkdirAll(filepath.Dir(file), 0o755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, []byte(out), 0o644)
 }
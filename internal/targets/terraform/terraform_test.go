@@ -1,11 +1,13 @@
 package terraform
 
 import (
+	"bytes"
 	"io"
 	"os"
 	"testing"
 
 	"github.com/coopnorge/mage/internal/core"
+	"github.com/coopnorge/mage/internal/devtool"
 	"github.com/coopnorge/mage/internal/targets/testhelpers"
 	"github.com/magefile/mage/sh"
 	"github.com/stretchr/testify/assert"
@@ -18,6 +20,8 @@ func TestTargets(t *testing.T) {
 		testProject string
 		targets     []string
 		wantErr     bool
+		// errMsg is expected in the output of a failing target
+		errMsg string
 	}{
 		{
 			name:        "Terraform Init target should succeed",
@@ -127,6 +131,25 @@ func TestTargets(t *testing.T) {
 			targets:     []string{"terraformmodule:terraform:docsvalidatefix", "terraformmodule:terraform:docsvalidate"},
 			wantErr:     false,
 		},
+		{
+			name:        "Terraform Test target should run the terraform test framework",
+			testProject: "testdata/module-with-tests",
+			targets:     []string{"terraformmodule:terraform:init", "terraformmodule:terraform:test"},
+			wantErr:     false,
+		},
+		{
+			name:        "Terraform Test target should fail on failing terraform tests",
+			testProject: "testdata/fail-module-tests",
+			targets:     []string{"terraformmodule:terraform:init", "terraformmodule:terraform:test"},
+			wantErr:     true,
+		},
+		{
+			name:        "Terraform Test target should fail on invalid example",
+			testProject: "testdata/fail-module-example",
+			targets:     []string{"terraformmodule:terraform:init", "terraformmodule:terraform:test"},
+			wantErr:     true,
+			errMsg:      "Terraform validate example - examples/basic - failed",
+		},
 		{
 			name:        "Terraform validate should succeed when lock file exists",
 			testProject: "testdata/project-success",
@@ -183,9 +206,11 @@ func TestTargets(t *testing.T) {
 
 			args := []string{"tool", "mage", "-v"}
 			args = append(args, tt.targets...)
-			gotErr := sh.RunV("go", args...)
+			var output bytes.Buffer
+			_, gotErr := sh.Exec(nil, io.MultiWriter(os.Stdout, &output), io.MultiWriter(os.Stderr, &output), "go", args...)
 			if tt.wantErr {
 				assert.Error(t, gotErr)
+				assert.Contains(t, output.String(), tt.errMsg)
 			} else {
 				assert.NoError(t, gotErr)
 			}
@@ -194,6 +219,8 @@ func TestTargets(t *testing.T) {
 }
 
 func TestGHAMatrix(t *testing.T) {
+	version, err := devtool.PinnedVersion("terraform")
+	require.NoError(t, err)
 	tests := []struct {
 		name string // description of this test case
 		// Named input parameters for target function.
@@ -207,13 +234,13 @@ func TestGHAMatrix(t *testing.T) {
 			name:            "Should show changes on all folders",
 			workdir:         "testdata/multi-terraform",
 			changedFilesEnv: "terraform-1/main.tf,terraform-2/main.tf",
-			want:            "{\"directory\":[\"terraform-1\",\"terraform-2\"]}\n",
+			want:            "{\"directory\":[\"terraform-1\",\"terraform-2\"],\"include\":[{\"backend\":\"local\",\"directory\":\"terraform-1\",\"environments\":[],\"flavour\":\"terraform\",\"module\":false,\"name\":\"terraform-terraform-1\",\"required_version\":\"\",\"version\":\"" + version + "\",\"wave\":0},{\"backend\":\"local\",\"directory\":\"terraform-2\",\"environments\":[],\"flavour\":\"terraform\",\"module\":false,\"name\":\"terraform-terraform-2\",\"required_version\":\"\",\"version\":\"" + version + "\",\"wave\":0}]}\n",
 		},
 		{
 			name:            "Should show changes on a selected folder",
 			workdir:         "testdata/multi-terraform",
 			changedFilesEnv: "terraform-2/main.tf",
-			want:            "{\"directory\":[\"terraform-2\"]}\n",
+			want:            "{\"directory\":[\"terraform-2\"],\"include\":[{\"backend\":\"local\",\"directory\":\"terraform-2\",\"environments\":[],\"flavour\":\"terraform\",\"module\":false,\"name\":\"terraform-terraform-2\",\"required_version\":\"\",\"version\":\"" + version + "\",\"wave\":0}]}\n",
 		},
 		{
 			name:                        "Should show empty directory array",
@@ -227,7 +254,19 @@ func TestGHAMatrix(t *testing.T) {
 			workdir:                     "testdata/multi-terraform",
 			changedFilesEnv:             "src/checksums.txt",
 			AdditionalGlobsTerraformEnv: "src/checksums.txt",
-			want:                        "{\"directory\":[\"terraform-1\",\"terraform-2\"]}\n",
+			want:                        "{\"directory\":[\"terraform-1\",\"terraform-2\"],\"include\":[{\"backend\":\"local\",\"directory\":\"terraform-1\",\"environments\":[],\"flavour\":\"terraform\",\"module\":false,\"name\":\"terraform-terraform-1\",\"required_version\":\"\",\"version\":\"" + version + "\",\"wave\":0},{\"backend\":\"local\",\"directory\":\"terraform-2\",\"environments\":[],\"flavour\":\"terraform\",\"module\":false,\"name\":\"terraform-terraform-2\",\"required_version\":\"\",\"version\":\"" + version + "\",\"wave\":0}]}\n",
+		},
+		{
+			name:            "Should include consumers of a changed local module",
+			workdir:         "testdata/terraform-graph",
+			changedFilesEnv: "modules/shared/main.tf",
+			want:            "{\"directory\":[\"app\",\"modules/shared\"],\"include\":[{\"backend\":\"gcs\",\"directory\":\"app\",\"environments\":[],\"flavour\":\"terraform\",\"module\":false,\"name\":\"terraform-app\",\"required_version\":\"\",\"version\":\"" + version + "\",\"wave\":1},{\"backend\":\"local\",\"directory\":\"modules/shared\",\"environments\":[],\"flavour\":\"terraform\",\"module\":false,\"name\":\"terraform-modules-shared\",\"required_version\":\"\",\"version\":\"" + version + "\",\"wave\":0}]}\n",
+		},
+		{
+			name:            "Should order projects in waves",
+			workdir:         "testdata/terraform-graph",
+			changedFilesEnv: "app/main.tf,network/main.tf,standalone/main.tf",
+			want:            "{\"directory\":[\"app\",\"network\",\"standalone\"],\"include\":[{\"backend\":\"gcs\",\"directory\":\"app\",\"environments\":[],\"flavour\":\"terraform\",\"module\":false,\"name\":\"terraform-app\",\"required_version\":\"\",\"version\":\"" + version + "\",\"wave\":1},{\"backend\":\"gcs\",\"directory\":\"network\",\"environments\":[],\"flavour\":\"terraform\",\"module\":false,\"name\":\"terraform-network\",\"required_version\":\"\",\"version\":\"" + version + "\",\"wave\":0},{\"backend\":\"local\",\"directory\":\"standalone\",\"environments\":[],\"flavour\":\"terraform\",\"module\":false,\"name\":\"terraform-standalone\",\"required_version\":\"\",\"version\":\"" + version + "\",\"wave\":0}]}\n",
 		},
 	}
 	for _, tt := range tests {
@@ -0,0 +1,3 @@
+module "greeting" {
+  source = "../../"
+}
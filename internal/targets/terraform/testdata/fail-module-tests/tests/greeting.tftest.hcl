@@ -0,0 +1,12 @@
+variables {
+  name = "world"
+}
+
+run "greeting" {
+  command = plan
+
+  assert {
+    condition     = output.greeting == "hello mars"
+    error_message = "unexpected greeting"
+  }
+}
@@ -0,0 +1,13 @@
+terraform {
+  required_version = ">= 1.6.0"
+}
+
+variable "name" {
+  type        = string
+  description = "Name to greet"
+}
+
+output "greeting" {
+  value       = "hello ${var.name}"
+  description = "The greeting"
+}
@@ -0,0 +1,376 @@
+package terraform
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/coopnorge/mage/internal/core"
+	"github.com/coopnorge/mage/internal/github"
+)
+
+const (
+	defaultPricingFile = "terraform-pricing.json"
+	costReport         = "cost.md"
+	costCommentTitle   = "### Terraform cost estimate"
+	hoursPerMonth      = 730
+)
+
+// PricingSource estimates the monthly cost of a resource
+type PricingSource interface {
+	// MonthlyCost returns the monthly cost of a resource of resourceType
+	// with the attributes from the plan. found is false if the source has
+	// no price for the resource.
+	MonthlyCost(resourceType string, attributes map[string]any) (cost float64, found bool, err error)
+	// Currency returns the currency of the prices
+	Currency() string
+}
+
+// NewPricingSource returns the configured pricing source. The pricing API
+// configured in terraform.cost_pricing_url is used when set, otherwise the
+// pricing file in terraform.cost_pricing_file or terraform-pricing.json in
+// the root of the repository, see [core.TerraformConfig]. Returns nil if no pricing source is configured.
+func NewPricingSource() (PricingSource, error) {
+	config, err := core.CurrentConfig()
+	if err != nil {
+		return nil, err
+	}
+	if url := config.Terraform.CostPricingURL; url != "" {
+		return &PricingAPI{URL: url}, nil
+	}
+	file := config.Terraform.CostPricingFile
+	if file == "" {
+		if !core.FileExists(defaultPricingFile) {
+			return nil, nil
+		}
+		file = defaultPricingFile
+	}
+	return LoadPricingFile(file)
+}
+
+// PricingFile is a local pricing source, it allows estimating costs offline.
+//
+//	{
+//	  "currency": "USD",
+//	  "resources": {
+//	    "google_compute_instance": {
+//	      "attribute": "machine_type",
+//	      "prices": {"e2-small": 12.23, "e2-medium": 24.46}
+//	    },
+//	    "google_compute_address": {"hourly": 0.005}
+//	  }
+//	}
+type PricingFile struct {
+	// CurrencyCode is the currency of all prices in the file
+	CurrencyCode string `json:"currency"`
+	// Resources are the prices per resource type
+	Resources map[string]ResourcePrice `json:"resources"`
+}
+
+// ResourcePrice is the price of a resource type. When Attribute is set the
+// monthly price is looked up in Prices by the value of the attribute, the flat
+// Monthly and Hourly prices are used when the value is not found.
+type ResourcePrice struct {
+	Monthly   float64            `json:"monthly"`
+	Hourly    float64            `json:"hourly"`
+	Attribute string             `json:"attribute"`
+	Prices    map[string]float64 `json:"prices"`
+}
+
+// LoadPricingFile reads a pricing file
+func LoadPricingFile(file string) (*PricingFile, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pricing := &PricingFile{}
+	err = json.Unmarshal(content, pricing)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse pricing file %s: %w", file, err)
+	}
+	if pricing.CurrencyCode == "" {
+		pricing.CurrencyCode = "USD"
+	}
+	return pricing, nil
+}
+
+// MonthlyCost implements [PricingSource]
+func (p *PricingFile) MonthlyCost(resourceType string, attributes map[string]any) (float64, bool, error) {
+	price, ok := p.Resources[resourceType]
+	if !ok {
+		return 0, false, nil
+	}
+	if price.Attribute != "" {
+		if value, ok := attributes[price.Attribute]; ok && value != nil {
+			if cost, ok := price.Prices[fmt.Sprint(value)]; ok {
+				return cost, true, nil
+			}
+		}
+	}
+	if price.Monthly == 0 && price.Hourly == 0 {
+		return 0, false, nil
+	}
+	return price.Monthly + price.Hourly*hoursPerMonth, true, nil
+}
+
+// Currency implements [PricingSource]
+func (p *PricingFile) Currency() string {
+	return p.CurrencyCode
+}
+
+// PricingAPI is a pricing source backed by a HTTP API. For every resource a
+// request is posted to URL
+//
+//	{"resource_type": "google_compute_instance", "attributes": {...}}
+//
+// and the API responds with
+//
+//	{"found": true, "monthly_cost": 24.46, "currency": "USD"}
+type PricingAPI struct {
+	URL    string
+	Client *http.Client
+
+	currency string
+}
+
+type pricingRequest struct {
+	ResourceType string         `json:"resource_type"`
+	Attributes   map[string]any `json:"attributes"`
+}
+
+type pricingResponse struct {
+	Found       bool    `json:"found"`
+	MonthlyCost float64 `json:"monthly_cost"`
+	Currency    string  `json:"currency"`
+}
+
+// MonthlyCost implements [PricingSource]
+func (p *PricingAPI) MonthlyCost(resourceType string, attributes map[string]any) (float64, bool, error) {
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	body, err := json.Marshal(pricingRequest{ResourceType: resourceType, Attributes: attributes})
+	if err != nil {
+		return 0, false, err
+	}
+	resp, err := client.Post(p.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to call pricing API: %w", err)
+	}
+	defer func() {
+		err := resp.Body.Close()
+		if err != nil {
+			fmt.Printf("Failed to close body, ignoring: %s\n", err)
+		}
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return 0, false, fmt.Errorf("pricing API returned status %d for %s, expected is %d", resp.StatusCode, resourceType, http.StatusOK)
+	}
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, false, err
+	}
+	var price pricingResponse
+	err = json.Unmarshal(content, &price)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to parse: %s\nerr: %w", string(content), err)
+	}
+	if price.Currency != "" {
+		p.currency = price.Currency
+	}
+	return price.MonthlyCost, price.Found, nil
+}
+
+// Currency implements [PricingSource]
+func (p *PricingAPI) Currency() string {
+	if p.currency == "" {
+		return "USD"
+	}
+	return p.currency
+}
+
+// CostEstimate is the estimated monthly cost of a terraform project before
+// and after the plan is applied
+type CostEstimate struct {
+	Directory string
+	Currency  string
+	Before    float64
+	After     float64
+	// Resources are the changed resources
+	Resources []ResourceCost
+	// Unpriced are the addresses of changed resources without a price
+	Unpriced []string
+}
+
+// Delta returns the change of the monthly cost
+func (e CostEstimate) Delta() float64 {
+	return e.After - e.Before
+}
+
+// ResourceCost is the estimated monthly cost of a changed resource
+type ResourceCost struct {
+	Address string
+	Action  string
+	Before  float64
+	After   float64
+}
+
+// Delta returns the change of the monthly cost
+func (r ResourceCost) Delta() float64 {
+	return r.After - r.Before
+}
+
+type terraformPlan struct {
+	ResourceChanges []resourceChange `json:"resource_changes"`
+}
+
+type resourceChange struct {
+	Address string `json:"address"`
+	Mode    string `json:"mode"`
+	Type    string `json:"type"`
+	Change  struct {
+		Actions []string       `json:"actions"`
+		Before  map[string]any `json:"before"`
+		After   map[string]any `json:"after"`
+	} `json:"change"`
+}
+
+// EstimateCost estimates the monthly cost of a terraform project from the
+// plan JSON in planFile, see [Plan].
+func EstimateCost(directory, planFile string, source PricingSource) (CostEstimate, error) {
+	estimate := CostEstimate{Directory: directory, Currency: source.Currency()}
+	content, err := os.ReadFile(planFile)
+	if err != nil {
+		return estimate, err
+	}
+	var plan terraformPlan
+	err = json.Unmarshal(content, &plan)
+	if err != nil {
+		return estimate, fmt.Errorf("failed to parse plan %s: %w", planFile, err)
+	}
+
+	for _, rc := range plan.ResourceChanges {
+		if rc.Mode == "data" {
+			continue
+		}
+		cost := ResourceCost{Address: rc.Address, Action: planAction(rc.Change.Actions)}
+		found := false
+		if rc.Change.Before != nil {
+			price, ok, err := source.MonthlyCost(rc.Type, rc.Change.Before)
+			if err != nil {
+				return estimate, err
+			}
+			cost.Before = price
+			found = found || ok
+		}
+		if rc.Change.After != nil {
+			price, ok, err := source.MonthlyCost(rc.Type, rc.Change.After)
+			if err != nil {
+				return estimate, err
+			}
+			cost.After = price
+			found = found || ok
+		}
+		estimate.Before += cost.Before
+		estimate.After += cost.After
+		if cost.Action == "no-op" {
+			continue
+		}
+		if !found {
+			estimate.Unpriced = append(estimate.Unpriced, rc.Address)
+			continue
+		}
+		estimate.Resources = append(estimate.Resources, cost)
+	}
+	// update estimate currency, an API reports the currency in the responses
+	estimate.Currency = source.Currency()
+	return estimate, nil
+}
+
+func planAction(actions []string) string {
+	switch {
+	case slices.Equal(actions, []string{"delete", "create"}), slices.Equal(actions, []string{"create", "delete"}):
+		return "replace"
+	case len(actions) == 0:
+		return "no-op"
+	default:
+		return strings.Join(actions, ", ")
+	}
+}
+
+// ReportCost writes the cost estimates as a markdown table to
+// var/terraform/cost.md. When running in CI the table is posted as a sticky
+// comment to the PR.
+func ReportCost(estimates []CostEstimate) error {
+	md, err := costMarkdownTemplate(estimates)
+	if err != nil {
+		return err
+	}
+	fmt.Println(md)
+
+	reportPath := path.Join(core.OutputDir, reportsDir, costReport)
+	err = os.MkdirAll(filepath.Dir(reportPath), 0o755)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(reportPath, []byte(md), 0o644)
+	if err != nil {
+		return err
+	}
+
+	if github.InCI() {
+		return github.StickyCommentInPR(costCommentTitle, reportPath)
+	}
+	return nil
+}
+
+func costMarkdownTemplate(estimates []CostEstimate) (string, error) {
+	funcMap := template.FuncMap{
+		"money": func(v float64) string { return fmt.Sprintf("%.2f", v) },
+		"delta": func(v float64) string { return fmt.Sprintf("%+.2f", v) },
+	}
+
+	const mdTemplate = `### Terraform cost estimate
+
+Estimated monthly cost{{ with index . 0 }} in {{ .Currency }}{{ end }} based on the plan of each project.
+
+| Project | Before | After | Delta |
+| --- | ---: | ---: | ---: |
+{{- range . }}
+| {{ .Directory }} | {{ money .Before }} | {{ money .After }} | {{ delta .Delta }} |
+{{- end }}
+{{ range . }}{{ if or .Resources .Unpriced }}
+<details><summary>{{ .Directory }}</summary>
+{{ if .Resources }}
+| Resource | Action | Before | After | Delta |
+| --- | --- | ---: | ---: | ---: |
+{{- range .Resources }}
+| {{ .Address }} | {{ .Action }} | {{ money .Before }} | {{ money .After }} | {{ delta .Delta }} |
+{{- end }}
+{{ end }}{{ if .Unpriced }}
+Changed resources without a price: {{ range $i, $a := .Unpriced }}{{ if $i }}, {{ end }}{{ $a }}{{ end }}
+{{ end }}
+</details>
+{{ end }}{{ end }}`
+	if len(estimates) == 0 {
+		return fmt.Sprintf("%s\n\nNo changes to estimate.\n", costCommentTitle), nil
+	}
+	tmpl, err := template.New("md").Funcs(funcMap).Parse(mdTemplate)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, estimates)
+	return buf.String(), err
+}
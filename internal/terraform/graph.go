@@ -0,0 +1,376 @@
+package terraform
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// DependencyKind is the kind of dependency between two projects
+type DependencyKind string
+
+const (
+	// DependencyModule is a local module used by a project
+	DependencyModule DependencyKind = "module"
+	// DependencyRemoteState is a project whose state is read with a
+	// terraform_remote_state data source
+	DependencyRemoteState DependencyKind = "remote_state"
+)
+
+// Dependency is an edge in the dependency graph, From depends on To
+type Dependency struct {
+	From string
+	To   string
+	Kind DependencyKind
+}
+
+// Graph is the dependency graph between terraform projects and local modules
+type Graph struct {
+	// Nodes are the projects and local modules sorted by path
+	Nodes []string
+	// Dependencies are the edges of the graph sorted by From and To
+	Dependencies []Dependency
+}
+
+// backendConfig is the backend of a project or the backend of a
+// terraform_remote_state data source. Only literal values are included.
+type backendConfig struct {
+	Type   string
+	Config map[string]string
+}
+
+// BuildGraph builds the dependency graph of the terraform projects from the
+// local module sources and the terraform_remote_state data sources. Remote
+// states are matched to a project by the backend configuration, for the local
+// backend by the path of the state.
+func BuildGraph(directories []string) (*Graph, error) {
+	graph := &Graph{}
+	nodes := map[string]bool{}
+	backends := map[string]backendConfig{}
+	remoteStates := map[string][]backendConfig{}
+
+	queue := slices.Clone(directories)
+	for len(queue) > 0 {
+		directory := filepath.Clean(queue[0])
+		queue = queue[1:]
+		if nodes[directory] {
+			continue
+		}
+		nodes[directory] = true
+
+		bodies, err := parseConfig(directory)
+		if err != nil {
+			return nil, err
+		}
+		modules := localModuleSources(directory, bodies)
+		for _, module := range modules {
+			graph.Dependencies = append(graph.Dependencies, Dependency{From: directory, To: module, Kind: DependencyModule})
+		}
+		queue = append(queue, modules...)
+		if backend, ok := projectBackend(directory, bodies); ok {
+			backends[directory] = backend
+		}
+		remoteStates[directory] = remoteStateBackends(directory, bodies)
+	}
+
+	for directory, states := range remoteStates {
+		for _, state := range states {
+			for project, backend := range backends {
+				if project != directory && backendMatches(backend, state) {
+					graph.Dependencies = append(graph.Dependencies, Dependency{From: directory, To: project, Kind: DependencyRemoteState})
+				}
+			}
+		}
+	}
+
+	for node := range nodes {
+		graph.Nodes = append(graph.Nodes, node)
+	}
+	sort.Strings(graph.Nodes)
+	sort.Slice(graph.Dependencies, func(i, j int) bool {
+		a, b := graph.Dependencies[i], graph.Dependencies[j]
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		if a.To != b.To {
+			return a.To < b.To
+		}
+		return a.Kind < b.Kind
+	})
+	graph.Dependencies = slices.Compact(graph.Dependencies)
+	return graph, nil
+}
+
+// Consumers returns the nodes using directory as a local module, directly or
+// through other local modules
+func (g *Graph) Consumers(directory string) []string {
+	directory = filepath.Clean(directory)
+	seen := map[string]bool{directory: true}
+	queue := []string{directory}
+	consumers := []string{}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, dep := range g.Dependencies {
+			if dep.Kind != DependencyModule || dep.To != current || seen[dep.From] {
+				continue
+			}
+			seen[dep.From] = true
+			consumers = append(consumers, dep.From)
+			queue = append(queue, dep.From)
+		}
+	}
+	sort.Strings(consumers)
+	return consumers
+}
+
+// Affected returns the projects in directories that are changed or consume a
+// changed local module
+func (g *Graph) Affected(directories, changed []string) []string {
+	affected := map[string]bool{}
+	for _, dir := range changed {
+		affected[filepath.Clean(dir)] = true
+		for _, consumer := range g.Consumers(dir) {
+			affected[consumer] = true
+		}
+	}
+	result := []string{}
+	for _, dir := range directories {
+		if affected[filepath.Clean(dir)] {
+			result = append(result, dir)
+		}
+	}
+	return result
+}
+
+// Waves orders the projects in directories for plan and apply. A project is
+// in a later wave than every project it depends on, directly or through
+// nodes not in directories. Returns an error if the graph has a cycle.
+func (g *Graph) Waves(directories []string) ([][]string, error) {
+	levels := map[string]int{}
+	visiting := map[string]bool{}
+	var level func(node string) (int, error)
+	level = func(node string) (int, error) {
+		if l, ok := levels[node]; ok {
+			return l, nil
+		}
+		if visiting[node] {
+			return 0, fmt.Errorf("dependency cycle detected at %s", node)
+		}
+		visiting[node] = true
+		l := 0
+		for _, dep := range g.Dependencies {
+			if dep.From != node {
+				continue
+			}
+			depLevel, err := level(dep.To)
+			if err != nil {
+				return 0, err
+			}
+			l = max(l, depLevel+1)
+		}
+		visiting[node] = false
+		levels[node] = l
+		return l, nil
+	}
+
+	byLevel := map[int][]string{}
+	for _, dir := range directories {
+		l, err := level(filepath.Clean(dir))
+		if err != nil {
+			return nil, err
+		}
+		byLevel[l] = append(byLevel[l], dir)
+	}
+	keys := make([]int, 0, len(byLevel))
+	for l := range byLevel {
+		keys = append(keys, l)
+	}
+	sort.Ints(keys)
+	waves := [][]string{}
+	for _, l := range keys {
+		sort.Strings(byLevel[l])
+		waves = append(waves, byLevel[l])
+	}
+	return waves, nil
+}
+
+// DOT renders the graph in the Graphviz DOT language. Edges point from a
+// dependency to the project using it, remote state edges are dashed.
+func (g *Graph) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph terraform {\n")
+	b.WriteString("  rankdir=LR;\n")
+	for _, node := range g.Nodes {
+		fmt.Fprintf(&b, "  %q;\n", node)
+	}
+	for _, dep := range g.Dependencies {
+		style := "solid"
+		if dep.Kind == DependencyRemoteState {
+			style = "dashed"
+		}
+		fmt.Fprintf(&b, "  %q -> %q [label=%q, style=%s];\n", dep.To, dep.From, dep.Kind, style)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// Mermaid renders the graph as a Mermaid flowchart. Edges point from a
+// dependency to the project using it, remote state edges are dotted.
+func (g *Graph) Mermaid() string {
+	ids := map[string]string{}
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	for i, node := range g.Nodes {
+		ids[node] = fmt.Sprintf("n%d", i)
+		fmt.Fprintf(&b, "  %s[\"%s\"]\n", ids[node], node)
+	}
+	for _, dep := range g.Dependencies {
+		arrow := "-->"
+		if dep.Kind == DependencyRemoteState {
+			arrow = "-.->"
+		}
+		fmt.Fprintf(&b, "  %s %s|%s| %s\n", ids[dep.To], arrow, dep.Kind, ids[dep.From])
+	}
+	return b.String()
+}
+
+// localModuleSources returns the directories of the module blocks with a
+// local source
+func localModuleSources(directory string, bodies []*hclsyntax.Body) []string {
+	modules := []string{}
+	for _, body := range bodies {
+		for _, block := range body.Blocks {
+			if block.Type != "module" {
+				continue
+			}
+			source, ok := literalString(block.Body, "source")
+			if !ok || !(strings.HasPrefix(source, "./") || strings.HasPrefix(source, "../")) {
+				continue
+			}
+			modules = append(modules, filepath.Join(directory, source))
+		}
+	}
+	return modules
+}
+
+// projectBackend returns the backend configured in the terraform block
+func projectBackend(directory string, bodies []*hclsyntax.Body) (backendConfig, bool) {
+	for _, body := range bodies {
+		for _, block := range body.Blocks {
+			if block.Type != "terraform" {
+				continue
+			}
+			for _, backend := range block.Body.Blocks {
+				if backend.Type != "backend" || len(backend.Labels) != 1 {
+					continue
+				}
+				config := map[string]string{}
+				for name := range backend.Body.Attributes {
+					if value, ok := literalString(backend.Body, name); ok {
+						config[name] = value
+					}
+				}
+				return normalizeBackend(directory, backendConfig{Type: backend.Labels[0], Config: config}), true
+			}
+		}
+	}
+	// projects without a backend use the local backend
+	return normalizeBackend(directory, backendConfig{Type: "local", Config: map[string]string{}}), true
+}
+
+// remoteStateBackends returns the backends read by terraform_remote_state
+// data sources
+func remoteStateBackends(directory string, bodies []*hclsyntax.Body) []backendConfig {
+	backends := []backendConfig{}
+	for _, body := range bodies {
+		for _, block := range body.Blocks {
+			if block.Type != "data" || len(block.Labels) != 2 || block.Labels[0] != "terraform_remote_state" {
+				continue
+			}
+			backendType, ok := literalString(block.Body, "backend")
+			if !ok {
+				continue
+			}
+			config := map[string]string{}
+			if attr, ok := block.Body.Attributes["config"]; ok {
+				value, diags := attr.Expr.Value(nil)
+				if !diags.HasErrors() && (value.Type().IsObjectType() || value.Type().IsMapType()) {
+					for name, v := range value.AsValueMap() {
+						if v.IsKnown() && !v.IsNull() && v.Type() == cty.String {
+							config[name] = v.AsString()
+						}
+					}
+				}
+			}
+			backends = append(backends, normalizeBackend(directory, backendConfig{Type: backendType, Config: config}))
+		}
+	}
+	return backends
+}
+
+// normalizeBackend resolves the state path of the local backend relative to
+// the repository root
+func normalizeBackend(directory string, backend backendConfig) backendConfig {
+	if backend.Type != "local" {
+		return backend
+	}
+	statePath := backend.Config["path"]
+	if statePath == "" {
+		statePath = "terraform.tfstate"
+	}
+	backend.Config = map[string]string{"path": filepath.Join(directory, statePath)}
+	return backend
+}
+
+// backendMatches returns true if the remote state reads the state of the
+// project backend. Every literal value of the project backend has to match.
+func backendMatches(project, remoteState backendConfig) bool {
+	if project.Type != remoteState.Type || len(project.Config) == 0 {
+		return false
+	}
+	for name, value := range project.Config {
+		if remoteState.Config[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+func literalString(body *hclsyntax.Body, name string) (string, bool) {
+	attr, ok := body.Attributes[name]
+	if !ok {
+		return "", false
+	}
+	value, diags := attr.Expr.Value(nil)
+	if diags.HasErrors() || !value.IsKnown() || value.IsNull() || value.Type() != cty.String {
+		return "", false
+	}
+	return value.AsString(), true
+}
+
+// ChangedProjects returns the projects in directories with changes compared
+// to the main branch, including projects using a changed local module. See
+// [HasChanges].
+func ChangedProjects(directories []string) ([]string, error) {
+	graph, err := BuildGraph(directories)
+	if err != nil {
+		return nil, err
+	}
+	changed := []string{}
+	for _, node := range graph.Nodes {
+		changes, err := HasChanges([]string{node})
+		if err != nil {
+			return nil, err
+		}
+		if changes {
+			changed = append(changed, node)
+		}
+	}
+	return graph.Affected(directories, changed), nil
+}
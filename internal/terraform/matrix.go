@@ -0,0 +1,63 @@
+package terraform
+
+import (
+	"path/filepath"
+
+	"github.com/coopnorge/mage/internal/github"
+)
+
+// MatrixJobs returns a GitHub Actions matrix job per project in directories.
+// The metadata of a job is:
+//
+//   - flavour, version and required_version, see [DetectIaC]
+//   - module, true if the project is a module
+//   - backend, the backend type of the project
+//   - environments, see [FindEnvironments]
+//   - wave, see [Graph.Waves]
+func MatrixJobs(graph *Graph, directories []string) ([]github.MatrixJob, error) {
+	waves, err := graph.Waves(directories)
+	if err != nil {
+		return nil, err
+	}
+	waveOf := map[string]int{}
+	for wave, dirs := range waves {
+		for _, dir := range dirs {
+			waveOf[dir] = wave
+		}
+	}
+
+	jobs := []github.MatrixJob{}
+	for _, dir := range directories {
+		iac, err := DetectIaC(dir)
+		if err != nil {
+			return nil, err
+		}
+		bodies, err := parseConfig(dir)
+		if err != nil {
+			return nil, err
+		}
+		backend, _ := projectBackend(dir, bodies)
+		environments, err := FindEnvironments(dir)
+		if err != nil {
+			return nil, err
+		}
+		envNames := []string{}
+		for _, env := range environments {
+			envNames = append(envNames, env.Name)
+		}
+		jobs = append(jobs, github.MatrixJob{
+			Key:  dir,
+			Name: github.JobName("terraform", filepath.ToSlash(filepath.Clean(dir))),
+			Metadata: map[string]any{
+				"flavour":          iac.Flavour,
+				"version":          iac.Version,
+				"required_version": iac.Constraint,
+				"module":           HasTerraformDocsConfig(dir) || IsTerraformSubmodule(dir),
+				"backend":          backend.Type,
+				"environments":     envNames,
+				"wave":             waveOf[dir],
+			},
+		})
+	}
+	return jobs, nil
+}
@@ -0,0 +1,361 @@
+package terraform
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/coopnorge/mage/internal/core"
+	"github.com/coopnorge/mage/internal/devtool"
+	"github.com/coopnorge/mage/internal/github"
+)
+
+const (
+	// policyDir is the name of repo local policy directories, both in the
+	// root of the repository and in a terraform project
+	policyDir    = "policy"
+	policyQuery  = "data.terraform"
+	policyReport = "policy.sarif"
+)
+
+var devtoolOpa devtool.Opa
+
+// PolicyFinding is a policy violation found in the plan of a project
+type PolicyFinding struct {
+	// Policy is the Rego package of the policy, e.g. terraform.labels
+	Policy string
+	// Level is error for deny rules and warning for warn rules
+	Level string
+	// Message describes the violation
+	Message string
+	// Address is the resource address, empty if not reported by the policy
+	Address string
+	// File and Line is the location of the resource in the project, Line is
+	// 0 if the resource can not be located
+	File string
+	Line int
+}
+
+// Policy evaluates the Rego policies against the plan JSON of a project, see
+// [Plan]. Policies are read from policies, the policy directory in the root
+// of the repository and the policy directory in the project. Policies must be
+// in the terraform package or a subpackage and report violations with deny
+// and warn rules. Findings are annotated and written as SARIF to
+// var/terraform/<directory>/policy.sarif. Returns an error if any deny rule
+// is violated.
+func Policy(directory string, policies fs.FS) error {
+	embedded := path.Join(core.OutputDir, reportsDir, policyDir)
+	err := writePolicies(policies, embedded)
+	if err != nil {
+		return err
+	}
+	policyDirs := []string{embedded}
+	for _, dir := range []string{policyDir, filepath.Join(directory, policyDir)} {
+		if core.DirExists(dir) {
+			policyDirs = append(policyDirs, dir)
+		}
+	}
+
+	findings, err := EvaluatePolicies(directory, PlanJSONPath(directory), policyDirs)
+	if err != nil {
+		return err
+	}
+	err = WriteSARIF(path.Join(core.OutputDir, reportsDir, directory, policyReport), findings)
+	if err != nil {
+		return err
+	}
+
+	violations := 0
+	for _, finding := range findings {
+		fmt.Printf("%s: %s (%s)\n", strings.ToUpper(finding.Level), finding.Message, finding.Policy)
+		if github.InCI() {
+			github.PrintFileActionMessage(finding.Level, fmt.Sprintf("Policy %s", finding.Policy), finding.File, finding.Line, finding.Message)
+		}
+		if finding.Level == "error" {
+			violations++
+		}
+	}
+	if violations > 0 {
+		return fmt.Errorf("%d policy violations found in %s", violations, directory)
+	}
+	return nil
+}
+
+// EvaluatePolicies evaluates the Rego policies in policyDirs against the
+// plan JSON in planFile and returns the findings sorted by location.
+func EvaluatePolicies(directory, planFile string, policyDirs []string) ([]PolicyFinding, error) {
+	args := []string{"eval", "--format", "json", "--input", planFile}
+	for _, dir := range policyDirs {
+		args = append(args, "--data", dir)
+	}
+	args = append(args, policyQuery)
+
+	stdout, stderr, err := devtoolOpa.Run(nil, ".", args...)
+	if err != nil {
+		return nil, fmt.Errorf("opa eval failed for %s: %s, %w", directory, stderr, err)
+	}
+	findings, err := parsePolicyResult([]byte(stdout))
+	if err != nil {
+		return nil, err
+	}
+
+	locations, err := resourceLocations(directory)
+	if err != nil {
+		return nil, err
+	}
+	for i, finding := range findings {
+		findings[i].File = directory
+		if location, ok := locations[resourceKey(finding.Address)]; ok {
+			findings[i].File = location.File
+			findings[i].Line = location.Line
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].File != findings[j].File {
+			return findings[i].File < findings[j].File
+		}
+		return findings[i].Line < findings[j].Line
+	})
+	return findings, nil
+}
+
+type opaEvalOutput struct {
+	Result []struct {
+		Expressions []struct {
+			Value any `json:"value"`
+		} `json:"expressions"`
+	} `json:"result"`
+}
+
+// parsePolicyResult parses the output of opa eval. Rules are either a set
+// of messages or a set of objects with msg and resource.
+func parsePolicyResult(output []byte) ([]PolicyFinding, error) {
+	var out opaEvalOutput
+	err := json.Unmarshal(output, &out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse opa output: %w", err)
+	}
+	findings := []PolicyFinding{}
+	for _, result := range out.Result {
+		for _, expression := range result.Expressions {
+			collectFindings("terraform", expression.Value, &findings)
+		}
+	}
+	return findings, nil
+}
+
+func collectFindings(pkg string, value any, findings *[]PolicyFinding) {
+	document, ok := value.(map[string]any)
+	if !ok {
+		return
+	}
+	keys := make([]string, 0, len(document))
+	for key := range document {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		level := ""
+		switch key {
+		case "deny":
+			level = "error"
+		case "warn":
+			level = "warning"
+		default:
+			collectFindings(fmt.Sprintf("%s.%s", pkg, key), document[key], findings)
+			continue
+		}
+		entries, ok := document[key].([]any)
+		if !ok {
+			continue
+		}
+		for _, entry := range entries {
+			finding := PolicyFinding{Policy: pkg, Level: level}
+			switch e := entry.(type) {
+			case string:
+				finding.Message = e
+			case map[string]any:
+				finding.Message = fmt.Sprint(e["msg"])
+				if resource, ok := e["resource"].(string); ok {
+					finding.Address = resource
+				}
+			default:
+				finding.Message = fmt.Sprint(e)
+			}
+			*findings = append(*findings, finding)
+		}
+	}
+}
+
+type resourceLocation struct {
+	File string
+	Line int
+}
+
+// resourceLocations returns the location of resource and module blocks in a
+// project keyed by type.name and module.name.
+func resourceLocations(directory string) (map[string]resourceLocation, error) {
+	bodies, err := parseConfig(directory)
+	if err != nil {
+		return nil, err
+	}
+	locations := map[string]resourceLocation{}
+	for _, body := range bodies {
+		for _, block := range body.Blocks {
+			key := ""
+			switch {
+			case block.Type == "resource" && len(block.Labels) == 2:
+				key = fmt.Sprintf("%s.%s", block.Labels[0], block.Labels[1])
+			case block.Type == "module" && len(block.Labels) == 1:
+				key = fmt.Sprintf("module.%s", block.Labels[0])
+			default:
+				continue
+			}
+			locations[key] = resourceLocation{
+				File: filepath.ToSlash(block.TypeRange.Filename),
+				Line: block.TypeRange.Start.Line,
+			}
+		}
+	}
+	return locations, nil
+}
+
+// resourceKey returns the key of the block defining the resource address in
+// the root module. The instance key is removed and resources in modules are
+// located by the module block.
+func resourceKey(address string) string {
+	parts := strings.Split(address, ".")
+	if len(parts) >= 2 && parts[0] == "module" {
+		name, _, _ := strings.Cut(parts[1], "[")
+		return fmt.Sprintf("module.%s", name)
+	}
+	key, _, _ := strings.Cut(address, "[")
+	return key
+}
+
+func writePolicies(policies fs.FS, destination string) error {
+	err := os.MkdirAll(destination, 0o755)
+	if err != nil {
+		return err
+	}
+	return fs.WalkDir(policies, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return os.MkdirAll(filepath.Join(destination, p), 0o755)
+		}
+		content, err := fs.ReadFile(policies, p)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(destination, p), content, 0o644)
+	})
+}
+
+type sarifReport struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+// WriteSARIF writes the policy findings as a SARIF report to file
+func WriteSARIF(file string, findings []PolicyFinding) error {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "opa",
+			InformationURI: "https://www.openpolicyagent.org/",
+			Rules:          []sarifRule{},
+		}},
+		Results: []sarifResult{},
+	}
+	rules := map[string]bool{}
+	for _, finding := range findings {
+		if !rules[finding.Policy] {
+			rules[finding.Policy] = true
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+				ID:               finding.Policy,
+				ShortDescription: sarifMessage{Text: fmt.Sprintf("Policy %s", finding.Policy)},
+			})
+		}
+		location := sarifLocation{PhysicalLocation: sarifPhysicalLocation{
+			ArtifactLocation: sarifArtifactLocation{URI: finding.File},
+		}}
+		if finding.Line > 0 {
+			location.PhysicalLocation.Region = &sarifRegion{StartLine: finding.Line}
+		}
+		run.Results = append(run.Results, sarifResult{
+			RuleID:    finding.Policy,
+			Level:     finding.Level,
+			Message:   sarifMessage{Text: finding.Message},
+			Locations: []sarifLocation{location},
+		})
+	}
+	report := sarifReport{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	}
+	content, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(file), 0o755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, content, 0o644)
+}
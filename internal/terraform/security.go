@@ -0,0 +1,344 @@
+package terraform
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coopnorge/mage/internal/core"
+	"github.com/coopnorge/mage/internal/github"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// severitySetting is the repository wide severity threshold for trivy
+	severitySetting   = "terraform.security_severity"
+	trivyConfigFile   = "trivy.yaml"
+	trivyIgnoreFile   = ".trivyignore"
+	trivyIgnoreYAML   = ".trivyignore.yaml"
+	acceptedRisksFile = "accepted-risks.md"
+	expiryDateLayout  = "2006-01-02"
+	// expiryWarning is how long before expiry accepted risks are warned of
+	expiryWarning = 30 * 24 * time.Hour
+)
+
+// severities are the trivy severities from lowest to highest
+var severities = []string{"UNKNOWN", "LOW", "MEDIUM", "HIGH", "CRITICAL"}
+
+// inlineIgnore matches inline ignore comments like
+// #trivy:ignore:AVD-GCP-0001:exp:2025-01-31 and the legacy tfsec syntax.
+var inlineIgnore = regexp.MustCompile(`(?:#|//)\s*(?:trivy|tfsec):ignore:([A-Za-z0-9_\-]+)(?:\[[^\]]*\])?(?::exp:(\d{4}-\d{2}-\d{2}))?`)
+
+// AcceptedRisk is a security finding ignored in a project
+type AcceptedRisk struct {
+	// ID is the trivy check ID, e.g. AVD-GCP-0001
+	ID string
+	// Source is the file and line the risk is accepted in
+	Source string
+	// Statement is the reason the risk is accepted, if documented
+	Statement string
+	// Expires is when the risk is no longer accepted, zero if it never
+	// expires
+	Expires time.Time
+}
+
+// Expired returns true if the accepted risk has expired at now
+func (r AcceptedRisk) Expired(now time.Time) bool {
+	return !r.Expires.IsZero() && now.After(r.Expires)
+}
+
+// trivyArgs returns the arguments for trivy config for a project
+func trivyArgs(directory string) ([]string, error) {
+	args := []string{"config", "--exit-code", "1", "--misconfig-scanners=terraform"}
+
+	hasSeverity := false
+	if core.FileExistsInDirectory(directory, trivyConfigFile) {
+		args = append(args, "--config", trivyConfigFile)
+		cfg := map[string]any{}
+		content, err := os.ReadFile(filepath.Join(directory, trivyConfigFile))
+		if err != nil {
+			return nil, err
+		}
+		err = yaml.Unmarshal(content, &cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", filepath.Join(directory, trivyConfigFile), err)
+		}
+		_, hasSeverity = cfg["severity"]
+	}
+
+	config, err := core.CurrentConfig()
+	if err != nil {
+		return nil, err
+	}
+	// the severity in the trivy.yaml of the project takes precedence over
+	// the repository wide threshold
+	if threshold := config.Terraform.SecuritySeverity; threshold != "" && !hasSeverity {
+		severity, err := severitiesFrom(threshold)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "--severity", severity)
+	}
+
+	if ignoreFile := trivyIgnore(directory); ignoreFile != "" {
+		args = append(args, "--ignorefile", ignoreFile)
+	}
+
+	for _, pattern := range []string{"*.tfvars", "*.tfvars.json"} {
+		files, err := filepath.Glob(filepath.Join(directory, pattern))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			args = append(args, "--tf-vars", filepath.Base(file))
+		}
+	}
+
+	return append(args, "./"), nil
+}
+
+// trivyIgnore returns the ignore file of a project passed to trivy, the
+// .trivyignore.yaml takes precedence over the .trivyignore. It returns an
+// empty string when the project has no ignore file.
+func trivyIgnore(directory string) string {
+	for _, file := range []string{trivyIgnoreYAML, trivyIgnoreFile} {
+		if core.FileExistsInDirectory(directory, file) {
+			return file
+		}
+	}
+	return ""
+}
+
+// severitiesFrom returns the severities at or above the threshold as a comma
+// separated list
+func severitiesFrom(threshold string) (string, error) {
+	i := slices.Index(severities, strings.ToUpper(strings.TrimSpace(threshold)))
+	if i < 0 {
+		return "", fmt.Errorf("invalid %s %q, must be one of %s", severitySetting, threshold, strings.Join(severities, ", "))
+	}
+	return strings.Join(severities[i:], ","), nil
+}
+
+// AcceptedRisks returns the risks accepted in the trivy ignore file passed to
+// trivy, see [trivyIgnore], and the inline ignore comments of a project
+func AcceptedRisks(directory string) ([]AcceptedRisk, error) {
+	risks := []AcceptedRisk{}
+	var err error
+	switch ignoreFile := trivyIgnore(directory); ignoreFile {
+	case trivyIgnoreYAML:
+		risks, err = readTrivyIgnoreYAML(filepath.Join(directory, ignoreFile))
+	case trivyIgnoreFile:
+		risks, err = readTrivyIgnore(filepath.Join(directory, ignoreFile))
+	}
+	if err != nil {
+		return nil, err
+	}
+	r, err := readInlineIgnores(directory)
+	if err != nil {
+		return nil, err
+	}
+	return append(risks, r...), nil
+}
+
+// readTrivyIgnore reads a .trivyignore file. Comments directly above an ID
+// are used as the statement.
+func readTrivyIgnore(file string) ([]AcceptedRisk, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err := f.Close()
+		if err != nil {
+			fmt.Printf("Failed to close %s, ignoring: %s\n", file, err)
+		}
+	}()
+
+	risks := []AcceptedRisk{}
+	statement := []string{}
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		switch {
+		case text == "":
+			statement = []string{}
+		case strings.HasPrefix(text, "#"):
+			statement = append(statement, strings.TrimSpace(strings.TrimPrefix(text, "#")))
+		default:
+			fields := strings.Fields(text)
+			risk := AcceptedRisk{
+				ID:        fields[0],
+				Source:    fmt.Sprintf("%s:%d", file, line),
+				Statement: strings.Join(statement, " "),
+			}
+			for _, field := range fields[1:] {
+				if expiry, ok := strings.CutPrefix(field, "exp:"); ok {
+					risk.Expires, err = time.Parse(expiryDateLayout, expiry)
+					if err != nil {
+						return nil, fmt.Errorf("invalid expiry date in %s: %w", risk.Source, err)
+					}
+				}
+			}
+			risks = append(risks, risk)
+			statement = []string{}
+		}
+	}
+	return risks, scanner.Err()
+}
+
+type trivyIgnoreYAMLFile struct {
+	Misconfigurations []struct {
+		ID        string    `yaml:"id"`
+		Statement string    `yaml:"statement"`
+		ExpiredAt yaml.Node `yaml:"expired_at"`
+	} `yaml:"misconfigurations"`
+}
+
+// readTrivyIgnoreYAML reads the misconfigurations of a .trivyignore.yaml file
+func readTrivyIgnoreYAML(file string) ([]AcceptedRisk, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var ignore trivyIgnoreYAMLFile
+	err = yaml.Unmarshal(content, &ignore)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+	risks := []AcceptedRisk{}
+	for _, m := range ignore.Misconfigurations {
+		risk := AcceptedRisk{ID: m.ID, Source: file, Statement: m.Statement}
+		if m.ExpiredAt.Value != "" {
+			risk.Source = fmt.Sprintf("%s:%d", file, m.ExpiredAt.Line)
+			risk.Expires, err = time.Parse(expiryDateLayout, m.ExpiredAt.Value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid expired_at in %s: %w", risk.Source, err)
+			}
+		}
+		risks = append(risks, risk)
+	}
+	return risks, nil
+}
+
+// readInlineIgnores reads the inline ignore comments in the terraform files
+// of a project
+func readInlineIgnores(directory string) ([]AcceptedRisk, error) {
+	files := []string{}
+	for _, pattern := range []string{"*.tf", "*.tofu"} {
+		matches, err := filepath.Glob(filepath.Join(directory, pattern))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+
+	risks := []AcceptedRisk{}
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		for i, line := range strings.Split(string(content), "\n") {
+			for _, match := range inlineIgnore.FindAllStringSubmatch(line, -1) {
+				risk := AcceptedRisk{ID: match[1], Source: fmt.Sprintf("%s:%d", file, i+1)}
+				if match[2] != "" {
+					risk.Expires, err = time.Parse(expiryDateLayout, match[2])
+					if err != nil {
+						return nil, fmt.Errorf("invalid expiry date in %s: %w", risk.Source, err)
+					}
+				}
+				risks = append(risks, risk)
+			}
+		}
+	}
+	return risks, nil
+}
+
+// ReportAcceptedRisks prints the accepted risks of a project and writes them
+// to var/terraform/<directory>/accepted-risks.md. When running in CI risks
+// without expiry, close to expiry and expired are annotated.
+func ReportAcceptedRisks(directory string) error {
+	risks, err := AcceptedRisks(directory)
+	if err != nil {
+		return err
+	}
+	if len(risks) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	md := acceptedRisksMarkdown(directory, risks, now)
+	github.StartLogGroup(fmt.Sprintf("Accepted risks - %s", directory))
+	fmt.Println(md)
+	github.EndLogGroup()
+
+	report := path.Join(core.OutputDir, reportsDir, directory, acceptedRisksFile)
+	err = os.MkdirAll(filepath.Dir(report), 0o755)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(report, []byte(md), 0o644)
+	if err != nil {
+		return err
+	}
+
+	if !github.InCI() {
+		return nil
+	}
+	for _, risk := range risks {
+		file, line := splitSource(risk.Source)
+		switch {
+		case risk.Expires.IsZero():
+			github.PrintFileActionMessage("notice", fmt.Sprintf("Accepted risk %s", risk.ID), file, line,
+				fmt.Sprintf("%s is accepted without an expiry date", risk.ID))
+		case risk.Expired(now):
+			github.PrintFileActionMessage("warning", fmt.Sprintf("Accepted risk %s", risk.ID), file, line,
+				fmt.Sprintf("%s expired %s", risk.ID, risk.Expires.Format(expiryDateLayout)))
+		case risk.Expires.Sub(now) < expiryWarning:
+			github.PrintFileActionMessage("warning", fmt.Sprintf("Accepted risk %s", risk.ID), file, line,
+				fmt.Sprintf("%s expires %s", risk.ID, risk.Expires.Format(expiryDateLayout)))
+		}
+	}
+	return nil
+}
+
+func acceptedRisksMarkdown(directory string, risks []AcceptedRisk, now time.Time) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "### Accepted risks in %s\n\n", directory)
+	b.WriteString("| ID | Expires | Source | Statement |\n")
+	b.WriteString("| --- | --- | --- | --- |\n")
+	for _, risk := range risks {
+		expires := "never"
+		if !risk.Expires.IsZero() {
+			expires = risk.Expires.Format(expiryDateLayout)
+			if risk.Expired(now) {
+				expires += " (expired)"
+			}
+		}
+		fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", risk.ID, expires, risk.Source, risk.Statement)
+	}
+	return b.String()
+}
+
+func splitSource(source string) (string, int) {
+	i := strings.LastIndex(source, ":")
+	if i < 0 {
+		return source, 0
+	}
+	line, err := strconv.Atoi(source[i+1:])
+	if err != nil {
+		return source, 0
+	}
+	return source[:i], line
+}
@@ -8,6 +8,7 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/coopnorge/mage/internal/core"
 	"github.com/coopnorge/mage/internal/devtool"
@@ -16,31 +17,16 @@ import (
 	"github.com/magefile/mage/mg"
 )
 
-// iacRunner is implemented by both devtool.Terraform and devtool.Tofu
-type iacRunner interface {
-	Run(env map[string]string, workdir string, args ...string) (string, string, error)
-}
-
-// useTofu returns true when the USE_TOFU environment variable is set to "true".
-func useTofu() bool {
-	return os.Getenv("USE_TOFU") == "true"
-}
-
-// getIaCRunner returns the OpenTofu devtool when USE_TOFU=true, otherwise
-// the Terraform devtool.
-func getIaCRunner() iacRunner {
-	if useTofu() {
-		return devtool.Tofu{}
-	}
-	return devtool.Terraform{}
-}
-
 var (
 	devtoolTFLint devtool.TFLint
 	devtoolTrivy  devtool.Trivy
 	devtoolTFDocs devtool.TerraformDocs
 )
 
+// skipValidationFile marks a directory with .tf files as not a terraform
+// project
+const skipValidationFile = ".terraform-validation-skip"
+
 // IsTerraformProject returns true if a directory contains a go module.
 func IsTerraformProject(p string, d fs.DirEntry) bool {
 	if !d.IsDir() {
@@ -51,43 +37,77 @@ func IsTerraformProject(p string, d fs.DirEntry) bool {
 		return false
 	}
 	// skip fi skip ci dir is found
-	if core.FileExists(filepath.Join(p, ".terraform-validation-skip")) {
+	if core.FileExists(filepath.Join(p, skipValidationFile)) {
 		return false
 	}
+	return hasTerraformFiles(p)
+}
+
+// hasTerraformFiles returns true if the directory contains a .tf file
+func hasTerraformFiles(p string) bool {
 	files, err := filepath.Glob(p + "/*.tf")
 	if err != nil {
 		panic("Unable to list .tf files")
 	}
-	if len(files) == 0 {
-		return false
-	}
-	return true
+	return len(files) > 0
 }
 
-// FindTerraformProjects will search through the base directory to find the
-// all terraform projects
-func FindTerraformProjects(base string) ([]string, error) {
-	directories := []string{}
-
-	err := filepath.WalkDir(base, func(workDir string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		if core.IsDotDirectory(workDir, d) {
-			return filepath.SkipDir
-		}
-		if !IsTerraformProject(workDir, d) {
+// DiscoverTerraformProjects returns a decision for every directory with .tf
+// files in the base directory, see [core.Discovery]. Directories marked with
+// .terraform-validation-skip and examples directories are skipped, the
+// examples in their subdirectories are projects. Projects in excluded
+// directories are only returned when all is true.
+func DiscoverTerraformProjects(base string, all bool) ([]core.Decision, error) {
+	discovery, err := core.NewDiscovery(base)
+	if err != nil {
+		return nil, err
+	}
+	decisions := []core.Decision{}
+	err = discovery.Walk(all, func(dir core.Dir, excluded bool, reason string) error {
+		if !dir.Has("*.tf") {
 			return nil
 		}
-
-		directories = append(directories, workDir)
-
+		switch {
+		case excluded:
+			decisions = append(decisions, core.Decision{Path: dir.Path, Reason: reason})
+		case dir.Has(skipValidationFile):
+			decisions = append(decisions, core.Decision{Path: dir.Path, Reason: "contains " + skipValidationFile})
+		case filepath.Base(dir.Path) == examplesDir:
+			decisions = append(decisions, core.Decision{Path: dir.Path, Reason: "examples directory, the examples in its subdirectories are projects"})
+		default:
+			decisions = append(decisions, core.Decision{Path: dir.Path, Included: true, Reason: "contains *.tf files"})
+		}
 		return nil
 	})
 	if err != nil {
 		return nil, err
 	}
-	return directories, nil
+	return decisions, nil
+}
+
+// FindTerraformProjects will search through the base directory to find the
+// all terraform projects, see [DiscoverTerraformProjects]
+func FindTerraformProjects(base string) ([]string, error) {
+	decisions, err := DiscoverTerraformProjects(base, false)
+	if err != nil {
+		return nil, err
+	}
+	return core.IncludedPaths(decisions), nil
+}
+
+// FindTerraformProject returns directory if it is one of the terraform
+// projects found in base, otherwise an error listing the projects.
+func FindTerraformProject(base, directory string) (string, error) {
+	directories, err := FindTerraformProjects(base)
+	if err != nil {
+		return "", err
+	}
+	for _, dir := range directories {
+		if filepath.Clean(dir) == filepath.Clean(directory) {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("%q is not a terraform project, found: %s", directory, strings.Join(directories, ", "))
 }
 
 // HasChanges checks if the current branch has any terraform changes compared
@@ -97,25 +117,59 @@ func HasChanges(terraformProjects []string) (bool, error) {
 	if err != nil {
 		return false, err
 	}
+	config, err := core.CurrentConfig()
+	if err != nil {
+		return false, err
+	}
 	// always trigger on go.mod/sum and workflows because of changes in ci.
-	additionalGlobs := append([]string{"go.mod", "go.sum", ".github/workflows/*"}, strings.Split(os.Getenv("ADDITIONAL_GLOBS_TERRAFORM"), ",")...)
+	additionalGlobs := append([]string{"go.mod", "go.sum", ".github/workflows/*"}, config.Terraform.AdditionalGlobs...)
 	return core.CompareChangesToPaths(changedFiles, terraformProjects, additionalGlobs)
 }
 
-// Test runs terraform validate on a terraform project
+// Test runs terraform validate on a terraform project and checks the
+// variables of the environments with [ValidateVariables]. When the project
+// contains tests for the Terraform test framework they are run with
+// [RunTests], otherwise the examples of the module are validated with
+// [ValidateExamples].
 func Test(directory string) error {
-	stdout, stderr, err := getIaCRunner().Run(nil, directory, "validate")
-	return handleTerraformOutput(fmt.Sprintf("Terraform Validate - %s", directory), stdout, stderr, err)
+	runner, err := getIaCRunner(directory)
+	if err != nil {
+		return err
+	}
+	stdout, stderr, err := runner.Run(nil, directory, "validate")
+	err = handleTerraformOutput(fmt.Sprintf("Terraform Validate - %s", directory), stdout, stderr, err)
+	if err != nil {
+		return err
+	}
+
+	err = ValidateVariables(directory)
+	if err != nil {
+		return err
+	}
+
+	hasTests, err := HasTests(directory)
+	if err != nil {
+		return err
+	}
+	if hasTests {
+		return RunTests(directory)
+	}
+	return ValidateExamples(directory)
 }
 
-// Lint runs the linters
+// Lint runs the linters. TFlint runs once without variables and once for
+// the tfvars file of every environment, see [FindEnvironments].
 func Lint(directory, tfLintCfg string) error {
 	lintCfg, cleanup, err := core.WriteTempFile(directory, "tflint.hcl", tfLintCfg)
 	if err != nil {
 		return err
 	}
 	defer cleanup()
-	stdout, stderr, err := getIaCRunner().Run(nil, directory, "fmt", "-diff", "-check")
+	runner, err := getIaCRunner(directory)
+	if err != nil {
+		return err
+	}
+	stdout, stderr, err := runner.Run(nil, directory, "fmt", "-diff", "-check")
 	err = handleTerraformOutput(fmt.Sprintf("Terraform fmt check - %s", directory), stdout, stderr, err)
 	if err != nil {
 		return fmt.Errorf("terraform formattig check failed for %s, %w", directory, err)
@@ -129,6 +183,17 @@ func Lint(directory, tfLintCfg string) error {
 		return fmt.Errorf("TFlint failed for %s, %w", directory, err)
 	}
 
+	environments, err := FindEnvironments(directory)
+	if err != nil {
+		return err
+	}
+	for _, env := range environments {
+		err = devtoolTFLint.Run(nil, directory, "--color", fmt.Sprintf("--config=%s", filepath.Base(lintCfg)), fmt.Sprintf("--var-file=%s", env.VarsFile))
+		if err != nil {
+			return fmt.Errorf("TFlint failed for %s with %s, %w", directory, env.VarsFile, err)
+		}
+	}
+
 	return nil
 }
 
@@ -140,7 +205,11 @@ func LintFix(directory, tfLintCfg string) error {
 	}
 	defer cleanup()
 
-	stdout, stderr, err := getIaCRunner().Run(nil, directory, "fmt", "-diff")
+	runner, err := getIaCRunner(directory)
+	if err != nil {
+		return err
+	}
+	stdout, stderr, err := runner.Run(nil, directory, "fmt", "-diff")
 	err = handleTerraformOutput(fmt.Sprintf("Terraform fmt check - %s", directory), stdout, stderr, err)
 	if err != nil {
 		return fmt.Errorf("terraform formattig fix failed for %s, %w", directory, err)
@@ -162,17 +231,133 @@ func LintFix(directory, tfLintCfg string) error {
 // Init downloads Terraform modules locally
 func Init(directory string) error {
 	log.Printf("Running terraform init for  %q", directory)
-	stdout, stderr, err := getIaCRunner().Run(nil, directory, "init")
+	runner, err := getIaCRunner(directory)
+	if err != nil {
+		return err
+	}
+	stdout, stderr, err := runner.Run(nil, directory, "init")
 	return handleTerraformOutput(fmt.Sprintf("Terraform init - %s", directory), stdout, stderr, err)
 }
 
 // InitUpgrade downloads and updates Terraform modules locally
 func InitUpgrade(directory string) error {
 	log.Printf("Running terraform init -upgrade for  %q", directory)
-	stdout, stderr, err := getIaCRunner().Run(nil, directory, "init", "-upgrade")
+	runner, err := getIaCRunner(directory)
+	if err != nil {
+		return err
+	}
+	stdout, stderr, err := runner.Run(nil, directory, "init", "-upgrade")
 	return handleTerraformOutput(fmt.Sprintf("Terraform init upgrade - %s", directory), stdout, stderr, err)
 }
 
+// Plan creates a plan for a terraform project and writes it as JSON to
+// var/terraform/<directory>/plan.json. The project has to be initialized.
+func Plan(directory string) error {
+	err := os.MkdirAll(path.Join(core.OutputDir, reportsDir, directory), 0o755)
+	if err != nil {
+		return err
+	}
+	rootPath, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	relativeRootPath, err := core.GetRelativeRootPath(rootPath, directory)
+	if err != nil {
+		return err
+	}
+	planFile := path.Join(relativeRootPath, planPath(directory))
+
+	runner, err := getIaCRunner(directory)
+	if err != nil {
+		return err
+	}
+	stdout, stderr, err := runner.Run(nil, directory, "plan", "-input=false", "-lock=false", fmt.Sprintf("-out=%s", planFile))
+	err = handleTerraformOutput(fmt.Sprintf("Terraform plan - %s", directory), stdout, stderr, err)
+	if err != nil {
+		return err
+	}
+	// the JSON output is not logged, it is too large to be useful
+	stdout, stderr, err = runner.Run(nil, directory, "show", "-json", planFile)
+	err = handleTerraformOutput(fmt.Sprintf("Terraform show plan - %s", directory), "", stderr, err)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(PlanJSONPath(directory), []byte(stdout), 0o644)
+}
+
+// PlanJSONPath returns the path of the plan JSON of a terraform project
+func PlanJSONPath(directory string) string {
+	return path.Join(core.OutputDir, reportsDir, directory, planJSON)
+}
+
+// planPath returns the path of the plan of a terraform project
+func planPath(directory string) string {
+	return path.Join(core.OutputDir, reportsDir, directory, planFile)
+}
+
+// HasCurrentPlanJSON returns true if the plan JSON of a terraform project was
+// written from its current plan by [Plan]. The plan JSON must not be older
+// than the plan and the plan must not be older than the files of the project,
+// like env/*.tfvars, and of its local modules.
+func HasCurrentPlanJSON(directory string) (bool, error) {
+	planJSONInfo, err := os.Stat(PlanJSONPath(directory))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	planInfo, err := os.Stat(planPath(directory))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if planJSONInfo.ModTime().Before(planInfo.ModTime()) {
+		return false, nil
+	}
+	graph, err := BuildGraph([]string{directory})
+	if err != nil {
+		return false, err
+	}
+	for _, node := range graph.Nodes {
+		changed, err := changedSince(node, planInfo.ModTime())
+		if err != nil || changed {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// changedSince returns true if a file in the directory or its subdirectories
+// was modified after the time. The .terraform directory, hidden directories
+// and the output directory are skipped.
+func changedSince(directory string, since time.Time) (bool, error) {
+	changed := false
+	err := filepath.WalkDir(directory, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path != directory && (strings.HasPrefix(entry.Name(), ".") || filepath.Clean(path) == core.OutputDir) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(since) {
+			changed = true
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return changed, err
+}
+
 // CheckLock checks that the lockfile exists
 func CheckLock(directory string) error {
 	log.Printf("Checking for terraform lockfile in %q", directory)
@@ -217,7 +402,11 @@ func CheckLock(directory string) error {
 // os architecures
 func ProviderLock(directory string) error {
 	log.Printf("Running terraform provider lock  %q", directory)
-	stdout, stderr, err := getIaCRunner().Run(nil, directory, "providers", "lock",
+	runner, err := getIaCRunner(directory)
+	if err != nil {
+		return err
+	}
+	stdout, stderr, err := runner.Run(nil, directory, "providers", "lock",
 		"-platform=linux_arm64",
 		"-platform=linux_amd64",
 		"-platform=darwin_amd64",
@@ -242,15 +431,26 @@ func Clean(directory string) error {
 	return nil
 }
 
-// Security validates security of the terraform project
-// config --exit-code 1 --misconfig-scanners=terraform
+// Security validates security of the terraform project with trivy config.
+// The trivy.yaml and .trivyignore.yaml or .trivyignore files and the tfvars
+// files of the project are passed to trivy, the severity threshold is set
+// with terraform.security_severity. Accepted risks are reported, see
+// [ReportAcceptedRisks].
 func Security(directory string) error {
 	// Skip tf sec if file exists
 	if core.FileExistsInDirectory(directory, ".tfsec-ignore") {
-		log.Printf("Skiping security check in %s because %s exists", directory, ".tfsec-ignore")
+		log.Printf("Skiping security check in %s because %s exists, consider accepting the risks in %s instead", directory, ".tfsec-ignore", trivyIgnoreFile)
 		return nil
 	}
-	err := devtoolTrivy.Run(nil, directory, "config", "--exit-code", "1", "--misconfig-scanners=terraform", "./")
+	err := ReportAcceptedRisks(directory)
+	if err != nil {
+		return err
+	}
+	args, err := trivyArgs(directory)
+	if err != nil {
+		return err
+	}
+	err = devtoolTrivy.Run(nil, directory, args...)
 	if err != nil {
 		return fmt.Errorf("trivy failed for %s, %w", directory, err)
 	}
@@ -2,9 +2,13 @@ package terraform
 
 import (
 	_ "embed"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/magefile/mage/sh"
 	"github.com/stretchr/testify/assert"
@@ -44,6 +48,38 @@ func TestFindTerraformFolders(t *testing.T) {
 	}
 }
 
+func TestDiscoverTerraformProjectsExamples(t *testing.T) {
+	base := t.TempDir()
+	for _, file := range []string{
+		"module/main.tf",
+		"module/main.tftest.hcl",
+		"module/examples/main.tf",
+		"module/examples/basic/main.tf",
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Join(base, filepath.Dir(file)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(base, file), []byte(""), 0o644))
+	}
+	hasTests, err := HasTests(filepath.Join(base, "module"))
+	require.NoError(t, err)
+	require.True(t, hasTests)
+
+	decisions, err := DiscoverTerraformProjects(base, false)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{filepath.Join(base, "module"), filepath.Join(base, "module/examples/basic")}, core.IncludedPaths(decisions))
+	assert.Contains(t, decisions, core.Decision{Path: filepath.Join(base, "module/examples"), Reason: "examples directory, the examples in its subdirectories are projects"})
+}
+
+func TestFindTerraformProject(t *testing.T) {
+	t.Chdir("testdata/folders")
+
+	got, err := FindTerraformProject(".", "./b/")
+	assert.NoError(t, err)
+	assert.Equal(t, "b", got)
+
+	_, err = FindTerraformProject(".", "c")
+	assert.EqualError(t, err, `"c" is not a terraform project, found: a, b`)
+}
+
 func TestInitUpgradet(t *testing.T) {
 	tests := []struct {
 		name string // description of this test case
@@ -246,3 +282,633 @@ func TestCheckLock(t *testing.T) {
 		})
 	}
 }
+
+func TestDetectIaC(t *testing.T) {
+	terraformPinned, err := devtool.PinnedVersion("terraform")
+	require.NoError(t, err)
+	tofuPinned, err := devtool.PinnedVersion("tofu")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		directory string
+		useTofu   string
+		want      IaC
+		wantErr   bool
+	}{
+		{
+			name:      "required_version satisfied by the pinned version",
+			directory: "required-version",
+			want:      IaC{Flavour: FlavourTerraform, Constraint: ">= 1.5.0", Version: terraformPinned},
+		},
+		{
+			name:      "terraform version file in parent directory",
+			directory: "terraform-version-file/project",
+			want:      IaC{Flavour: FlavourTerraform, Constraint: "1.9.8", Version: "1.9.8"},
+		},
+		{
+			name:      "opentofu version file",
+			directory: "opentofu-version-file",
+			want:      IaC{Flavour: FlavourTofu, Constraint: "1.8.5", Version: "1.8.5"},
+		},
+		{
+			name:      "tofu files select OpenTofu",
+			directory: "tofu-files",
+			want:      IaC{Flavour: FlavourTofu, Constraint: ">= 1.6.0", Version: tofuPinned},
+		},
+		{
+			name:      "USE_TOFU selects OpenTofu",
+			directory: "no-constraint",
+			useTofu:   "true",
+			want:      IaC{Flavour: FlavourTofu, Version: tofuPinned},
+		},
+		{
+			name:      "no constraint uses the pinned version",
+			directory: "no-constraint",
+			want:      IaC{Flavour: FlavourTerraform, Version: terraformPinned},
+		},
+		{
+			name:      "constraint not satisfied by the pinned version",
+			directory: "unsatisfiable",
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("USE_TOFU", tt.useTofu)
+			t.Chdir("testdata/iac")
+			got, gotErr := DetectIaC(tt.directory)
+			if tt.wantErr {
+				assert.Error(t, gotErr)
+				return
+			}
+			assert.NoError(t, gotErr)
+			assert.Equal(t, tt.want.Flavour, got.Flavour)
+			assert.Equal(t, tt.want.Constraint, got.Constraint)
+			assert.Equal(t, tt.want.Version, got.Version)
+		})
+	}
+}
+
+func TestHasTests(t *testing.T) {
+	tests := []struct {
+		name      string
+		directory string
+		want      bool
+	}{
+		{
+			name:      "tests in the tests directory",
+			directory: "testdata/test-framework/tests-dir",
+			want:      true,
+		},
+		{
+			name:      "tests in the project directory",
+			directory: "testdata/test-framework/root-tests",
+			want:      true,
+		},
+		{
+			name:      "no tests",
+			directory: "testdata/test-framework/no-tests",
+			want:      false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotErr := HasTests(tt.directory)
+			assert.NoError(t, gotErr)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFindExamples(t *testing.T) {
+	tests := []struct {
+		name      string
+		directory string
+		want      []string
+	}{
+		{
+			name:      "examples directory and subdirectories with terraform files",
+			directory: "testdata/test-framework/no-tests",
+			want: []string{
+				"testdata/test-framework/no-tests/examples",
+				"testdata/test-framework/no-tests/examples/basic",
+				"testdata/test-framework/no-tests/examples/complete",
+			},
+		},
+		{
+			name:      "no examples",
+			directory: "testdata/test-framework/tests-dir",
+			want:      []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotErr := FindExamples(tt.directory)
+			assert.NoError(t, gotErr)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestEstimateCost(t *testing.T) {
+	want := CostEstimate{
+		Directory: "project",
+		Currency:  "USD",
+		Before:    50,
+		After:     41.15,
+		Resources: []ResourceCost{
+			{Address: "google_compute_instance.app", Action: "update", Before: 12.5, After: 25},
+			{Address: "google_compute_address.ip", Action: "create", Before: 0, After: 3.65},
+			{Address: "google_compute_instance.old", Action: "delete", Before: 25, After: 0},
+		},
+		Unpriced: []string{"random_pet.name"},
+	}
+
+	pricingFile, err := LoadPricingFile("testdata/cost/pricing.json")
+	require.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req pricingRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		cost, found, _ := pricingFile.MonthlyCost(req.ResourceType, req.Attributes)
+		err = json.NewEncoder(w).Encode(pricingResponse{Found: found, MonthlyCost: cost, Currency: "USD"})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		source PricingSource
+	}{
+		{
+			name:   "pricing file",
+			source: pricingFile,
+		},
+		{
+			name:   "pricing API",
+			source: &PricingAPI{URL: server.URL, Client: server.Client()},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotErr := EstimateCost("project", "testdata/cost/plan.json", tt.source)
+			require.NoError(t, gotErr)
+			assert.Equal(t, want.Directory, got.Directory)
+			assert.Equal(t, want.Currency, got.Currency)
+			assert.InDelta(t, want.Before, got.Before, 0.001)
+			assert.InDelta(t, want.After, got.After, 0.001)
+			assert.InDelta(t, -8.85, got.Delta(), 0.001)
+			require.Len(t, got.Resources, len(want.Resources))
+			for i, resource := range want.Resources {
+				assert.Equal(t, resource.Address, got.Resources[i].Address)
+				assert.Equal(t, resource.Action, got.Resources[i].Action)
+				assert.InDelta(t, resource.Before, got.Resources[i].Before, 0.001)
+				assert.InDelta(t, resource.After, got.Resources[i].After, 0.001)
+			}
+			assert.Equal(t, want.Unpriced, got.Unpriced)
+
+			md, err := costMarkdownTemplate([]CostEstimate{got})
+			require.NoError(t, err)
+			assert.Contains(t, md, "### Terraform cost estimate")
+			assert.Contains(t, md, "| project | 50.00 | 41.15 | -8.85 |")
+			assert.Contains(t, md, "| google_compute_address.ip | create | 0.00 | 3.65 | +3.65 |")
+			assert.Contains(t, md, "Changed resources without a price: random_pet.name")
+		})
+	}
+}
+
+func TestHasCurrentPlanJSON(t *testing.T) {
+	planned := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name  string
+		files map[string]time.Time
+		// content of the files, empty when not set
+		content map[string]string
+		want    bool
+	}{
+		{
+			name:  "no plan",
+			files: map[string]time.Time{"project/main.tf": planned.Add(-time.Minute)},
+		},
+		{
+			name: "plan JSON without a plan",
+			files: map[string]time.Time{
+				"project/main.tf":                 planned.Add(-time.Minute),
+				"var/terraform/project/plan.json": planned,
+			},
+		},
+		{
+			name: "current plan",
+			files: map[string]time.Time{
+				"project/main.tf":                 planned.Add(-time.Minute),
+				"var/terraform/project/tfplan":    planned,
+				"var/terraform/project/plan.json": planned.Add(time.Second),
+			},
+			want: true,
+		},
+		{
+			name: "plan JSON of a previous plan",
+			files: map[string]time.Time{
+				"project/main.tf":                 planned.Add(-time.Minute),
+				"var/terraform/project/plan.json": planned.Add(-time.Second),
+				"var/terraform/project/tfplan":    planned,
+			},
+		},
+		{
+			name: "project changed after the plan",
+			files: map[string]time.Time{
+				"project/main.tf":                 planned.Add(time.Minute),
+				"var/terraform/project/tfplan":    planned,
+				"var/terraform/project/plan.json": planned.Add(time.Second),
+			},
+		},
+		{
+			name: "variables changed after the plan",
+			files: map[string]time.Time{
+				"project/main.tf":                 planned.Add(-time.Minute),
+				"project/env/production.tfvars":   planned.Add(time.Minute),
+				"var/terraform/project/tfplan":    planned,
+				"var/terraform/project/plan.json": planned.Add(time.Second),
+			},
+		},
+		{
+			name: "provider cache changed after the plan",
+			files: map[string]time.Time{
+				"project/main.tf":                      planned.Add(-time.Minute),
+				"project/.terraform/providers/lock.db": planned.Add(time.Minute),
+				"var/terraform/project/tfplan":         planned,
+				"var/terraform/project/plan.json":      planned.Add(time.Second),
+			},
+			want: true,
+		},
+		{
+			name: "local module changed after the plan",
+			files: map[string]time.Time{
+				"project/main.tf":                 planned.Add(-time.Minute),
+				"modules/network/main.tf":         planned.Add(time.Minute),
+				"var/terraform/project/tfplan":    planned,
+				"var/terraform/project/plan.json": planned.Add(time.Second),
+			},
+			content: map[string]string{"project/main.tf": "module \"network\" {\n  source = \"../modules/network\"\n}\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			for file, modified := range tt.files {
+				require.NoError(t, os.MkdirAll(filepath.Dir(file), 0o755))
+				require.NoError(t, os.WriteFile(file, []byte(tt.content[file]), 0o644))
+				require.NoError(t, os.Chtimes(file, modified, modified))
+			}
+			got, err := HasCurrentPlanJSON("project")
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParsePolicyResult(t *testing.T) {
+	output, err := os.ReadFile("testdata/policy/opa-output.json")
+	require.NoError(t, err)
+
+	got, err := parsePolicyResult(output)
+	require.NoError(t, err)
+	assert.Equal(t, []PolicyFinding{
+		{
+			Policy:  "terraform.custom",
+			Level:   "error",
+			Message: "module.network.google_compute_network.this[0] must not be auto created",
+		},
+		{
+			Policy:  "terraform.labels",
+			Level:   "warning",
+			Message: "google_storage_bucket.public has no labels",
+			Address: "google_storage_bucket.public",
+		},
+		{
+			Policy:  "terraform.public_buckets",
+			Level:   "error",
+			Message: "google_storage_bucket_iam_member.public grants allUsers access to a storage bucket",
+			Address: "google_storage_bucket_iam_member.public",
+		},
+	}, got)
+
+	got, err = parsePolicyResult([]byte("{}"))
+	require.NoError(t, err)
+	assert.Empty(t, got)
+}
+
+func TestResourceLocations(t *testing.T) {
+	locations, err := resourceLocations("testdata/policy/project")
+	require.NoError(t, err)
+
+	tests := []struct {
+		address string
+		want    resourceLocation
+		found   bool
+	}{
+		{
+			address: "google_storage_bucket.public",
+			want:    resourceLocation{File: "testdata/policy/project/main.tf", Line: 1},
+			found:   true,
+		},
+		{
+			address: `google_storage_bucket_iam_member.public["key"]`,
+			want:    resourceLocation{File: "testdata/policy/project/main.tf", Line: 6},
+			found:   true,
+		},
+		{
+			address: "module.network[0].google_compute_network.this",
+			want:    resourceLocation{File: "testdata/policy/project/main.tf", Line: 12},
+			found:   true,
+		},
+		{
+			address: "google_compute_network.unknown",
+			found:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			got, found := locations[resourceKey(tt.address)]
+			assert.Equal(t, tt.found, found)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestWriteSARIF(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "policy.sarif")
+	err := WriteSARIF(file, []PolicyFinding{
+		{
+			Policy:  "terraform.public_buckets",
+			Level:   "error",
+			Message: "public bucket",
+			File:    "project/main.tf",
+			Line:    6,
+		},
+		{
+			Policy:  "terraform.labels",
+			Level:   "warning",
+			Message: "no labels",
+			File:    "project",
+		},
+	})
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(file)
+	require.NoError(t, err)
+	var report sarifReport
+	require.NoError(t, json.Unmarshal(content, &report))
+	assert.Equal(t, "2.1.0", report.Version)
+	require.Len(t, report.Runs, 1)
+	assert.Len(t, report.Runs[0].Tool.Driver.Rules, 2)
+	require.Len(t, report.Runs[0].Results, 2)
+	assert.Equal(t, 6, report.Runs[0].Results[0].Locations[0].PhysicalLocation.Region.StartLine)
+	assert.Nil(t, report.Runs[0].Results[1].Locations[0].PhysicalLocation.Region)
+	assert.Equal(t, "warning", report.Runs[0].Results[1].Level)
+}
+
+func TestTrivyArgs(t *testing.T) {
+	tests := []struct {
+		name      string
+		directory string
+		severity  string
+		want      []string
+		wantErr   bool
+	}{
+		{
+			name:      "no configuration",
+			directory: "testdata/security/plain",
+			want:      []string{"config", "--exit-code", "1", "--misconfig-scanners=terraform", "./"},
+		},
+		{
+			name:      "repository wide severity threshold",
+			directory: "testdata/security/plain",
+			severity:  "high",
+			want:      []string{"config", "--exit-code", "1", "--misconfig-scanners=terraform", "--severity", "HIGH,CRITICAL", "./"},
+		},
+		{
+			name:      "invalid severity threshold is ignored",
+			directory: "testdata/security/plain",
+			severity:  "SEVERE",
+			want:      []string{"config", "--exit-code", "1", "--misconfig-scanners=terraform", "./"},
+		},
+		{
+			name:      "project configuration takes precedence",
+			directory: "testdata/security/configured",
+			severity:  "LOW",
+			want: []string{
+				"config", "--exit-code", "1", "--misconfig-scanners=terraform",
+				"--config", "trivy.yaml",
+				"--ignorefile", ".trivyignore",
+				"--tf-vars", "terraform.tfvars",
+				"./",
+			},
+		},
+		{
+			name:      "yaml ignore file",
+			directory: "testdata/security/yaml-ignore",
+			want:      []string{"config", "--exit-code", "1", "--misconfig-scanners=terraform", "--ignorefile", ".trivyignore.yaml", "./"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TERRAFORM_SECURITY_SEVERITY", tt.severity)
+			got, gotErr := trivyArgs(tt.directory)
+			if tt.wantErr {
+				assert.Error(t, gotErr)
+				return
+			}
+			assert.NoError(t, gotErr)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAcceptedRisks(t *testing.T) {
+	date := func(s string) time.Time {
+		d, err := time.Parse("2006-01-02", s)
+		require.NoError(t, err)
+		return d
+	}
+	tests := []struct {
+		name      string
+		directory string
+		want      []AcceptedRisk
+	}{
+		{
+			name:      "ignore file and inline ignores",
+			directory: "testdata/security/configured",
+			want: []AcceptedRisk{
+				{
+					ID:        "AVD-GCP-0078",
+					Source:    "testdata/security/configured/.trivyignore:2",
+					Statement: "Versioning is handled by backups",
+					Expires:   date("2099-12-31"),
+				},
+				{
+					ID:     "AVD-GCP-0001",
+					Source: "testdata/security/configured/.trivyignore:4",
+				},
+				{
+					ID:      "AVD-GCP-0066",
+					Source:  "testdata/security/configured/main.tf:1",
+					Expires: date("2024-01-31"),
+				},
+				{
+					ID:     "google-compute-no-public-ingress",
+					Source: "testdata/security/configured/main.tf:10",
+				},
+			},
+		},
+		{
+			name:      "yaml ignore file",
+			directory: "testdata/security/yaml-ignore",
+			want: []AcceptedRisk{
+				{
+					ID:        "AVD-GCP-0066",
+					Source:    "testdata/security/yaml-ignore/.trivyignore.yaml:4",
+					Statement: "Encryption with Google managed keys is accepted",
+					Expires:   date("2099-06-30"),
+				},
+				{
+					ID:     "AVD-GCP-0078",
+					Source: "testdata/security/yaml-ignore/.trivyignore.yaml",
+				},
+			},
+		},
+		{
+			name:      "only the ignore file passed to trivy",
+			directory: "testdata/security/both-ignores",
+			want: []AcceptedRisk{
+				{
+					ID:     "AVD-GCP-0066",
+					Source: "testdata/security/both-ignores/.trivyignore.yaml",
+				},
+			},
+		},
+		{
+			name:      "no accepted risks",
+			directory: "testdata/security/plain",
+			want:      []AcceptedRisk{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotErr := AcceptedRisks(tt.directory)
+			assert.NoError(t, gotErr)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	risks, err := AcceptedRisks("testdata/security/configured")
+	require.NoError(t, err)
+	md := acceptedRisksMarkdown("configured", risks, date("2025-01-01"))
+	assert.Contains(t, md, "| AVD-GCP-0066 | 2024-01-31 (expired) | testdata/security/configured/main.tf:1 |  |")
+	assert.Contains(t, md, "| AVD-GCP-0001 | never |")
+}
+
+func TestFindEnvironments(t *testing.T) {
+	got, err := FindEnvironments("testdata/variables/project")
+	require.NoError(t, err)
+	assert.Equal(t, []Environment{
+		{Name: "dev", VarsFile: "env/dev.tfvars"},
+		{Name: "prod", VarsFile: "env/prod.tfvars"},
+	}, got)
+
+	got, err = FindEnvironments("testdata/variables/no-env")
+	require.NoError(t, err)
+	assert.Empty(t, got)
+}
+
+func TestCheckVariables(t *testing.T) {
+	tests := []struct {
+		name      string
+		directory string
+		want      []VariableIssue
+	}{
+		{
+			name:      "missing and unused variables",
+			directory: "testdata/variables/project",
+			want: []VariableIssue{
+				{
+					Environment: "prod",
+					Level:       "error",
+					Message:     `variable "machine_type" is required but not set in env/prod.tfvars`,
+					File:        "testdata/variables/project/variables.tf",
+					Line:        10,
+				},
+				{
+					Environment: "prod",
+					Level:       "warning",
+					Message:     `"zone" in env/prod.tfvars is not a declared variable`,
+					File:        "testdata/variables/project/env/prod.tfvars",
+					Line:        3,
+				},
+			},
+		},
+		{
+			name:      "no environments",
+			directory: "testdata/variables/no-env",
+			want:      []VariableIssue{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotErr := CheckVariables(tt.directory)
+			assert.NoError(t, gotErr)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestBuildGraph(t *testing.T) {
+	t.Chdir("testdata/graph")
+	directories, err := FindTerraformProjects(".")
+	require.NoError(t, err)
+
+	graph, err := BuildGraph(directories)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"app", "modules/shared", "network", "reporting", "standalone"}, graph.Nodes)
+	assert.Equal(t, []Dependency{
+		{From: "app", To: "modules/shared", Kind: DependencyModule},
+		{From: "app", To: "network", Kind: DependencyRemoteState},
+		{From: "reporting", To: "standalone", Kind: DependencyRemoteState},
+	}, graph.Dependencies)
+
+	assert.Equal(t, []string{"app"}, graph.Consumers("modules/shared"))
+	assert.Empty(t, graph.Consumers("network"))
+	assert.Equal(t, []string{"app", "modules/shared"}, graph.Affected(directories, []string{"modules/shared"}))
+	assert.Equal(t, []string{"network"}, graph.Affected(directories, []string{"network"}))
+
+	waves, err := graph.Waves(directories)
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"modules/shared", "network", "standalone"},
+		{"app", "reporting"},
+	}, waves)
+
+	assert.Contains(t, graph.DOT(), `"network" -> "app" [label="remote_state", style=dashed];`)
+	assert.Contains(t, graph.DOT(), `"modules/shared" -> "app" [label="module", style=solid];`)
+	assert.Contains(t, graph.Mermaid(), "n1 -->|module| n0")
+	assert.Contains(t, graph.Mermaid(), "n2 -.->|remote_state| n0")
+}
+
+func TestGraphWavesCycle(t *testing.T) {
+	graph := &Graph{
+		Nodes: []string{"a", "b"},
+		Dependencies: []Dependency{
+			{From: "a", To: "b", Kind: DependencyRemoteState},
+			{From: "b", To: "a", Kind: DependencyRemoteState},
+		},
+	}
+	_, err := graph.Waves([]string{"a", "b"})
+	assert.Error(t, err)
+}
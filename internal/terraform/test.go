@@ -0,0 +1,168 @@
+package terraform
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/coopnorge/mage/internal/core"
+	"github.com/hashicorp/go-version"
+)
+
+const (
+	testsDir    = "tests"
+	examplesDir = "examples"
+	junitReport = "junit.xml"
+	reportsDir  = "terraform"
+	planJSON    = "plan.json"
+	planFile    = "tfplan"
+	minTestTF   = "1.6.0"
+	minJUnitTF  = "1.11.0"
+	minTestTofu = "1.6.0"
+)
+
+// HasTests returns true if the project contains test files for the
+// Terraform test framework in the project or the tests directory.
+func HasTests(directory string) (bool, error) {
+	for _, dir := range []string{directory, filepath.Join(directory, testsDir)} {
+		for _, pattern := range []string{"*.tftest.hcl", "*.tofutest.hcl"} {
+			files, err := filepath.Glob(filepath.Join(dir, pattern))
+			if err != nil {
+				return false, err
+			}
+			if len(files) > 0 {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// RunTests runs the Terraform test framework (terraform test or tofu test) in
+// a project. The JUnit report is written to var/terraform/<directory>/junit.xml
+// when supported, OpenTofu does not support JUnit reports.
+func RunTests(directory string) error {
+	iac, err := DetectIaC(directory)
+	if err != nil {
+		return err
+	}
+	minTest := minTestTF
+	if iac.Flavour == FlavourTofu {
+		minTest = minTestTofu
+	}
+	ok, err := versionAtLeast(iac.Version, minTest)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%s test requires version %s or later, %s uses %s", iac.Flavour, minTest, directory, iac.Version)
+	}
+
+	args := []string{"test"}
+	junit, err := versionAtLeast(iac.Version, minJUnitTF)
+	if err != nil {
+		return err
+	}
+	switch {
+	case iac.Flavour == FlavourTofu:
+		fmt.Printf("Skipping JUnit report for %s, OpenTofu does not support JUnit reports\n", directory)
+	case junit:
+		report, err := junitReportPath(directory)
+		if err != nil {
+			return err
+		}
+		args = append(args, fmt.Sprintf("-junit-xml=%s", report))
+	default:
+		fmt.Printf("Skipping JUnit report for %s, requires terraform %s or later\n", directory, minJUnitTF)
+	}
+
+	stdout, stderr, err := newIaCRunner(iac).Run(nil, directory, args...)
+	return handleTerraformOutput(fmt.Sprintf("Terraform test - %s", directory), stdout, stderr, err)
+}
+
+// FindExamples returns the examples of a module. The examples directory and
+// each of its subdirectories containing .tf files is an example.
+func FindExamples(directory string) ([]string, error) {
+	examples := []string{}
+	base := filepath.Join(directory, examplesDir)
+	if !core.DirExists(base) {
+		return examples, nil
+	}
+	candidates := []string{base}
+	entries, err := os.ReadDir(base)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			candidates = append(candidates, filepath.Join(base, entry.Name()))
+		}
+	}
+	for _, candidate := range candidates {
+		files, err := filepath.Glob(filepath.Join(candidate, "*.tf"))
+		if err != nil {
+			return nil, err
+		}
+		if len(files) > 0 {
+			examples = append(examples, candidate)
+		}
+	}
+	return examples, nil
+}
+
+// ValidateExamples runs init without a backend and validate on every example
+// of a module.
+func ValidateExamples(directory string) error {
+	examples, err := FindExamples(directory)
+	if err != nil {
+		return err
+	}
+	for _, example := range examples {
+		runner, err := getIaCRunner(example)
+		if err != nil {
+			return err
+		}
+		stdout, stderr, err := runner.Run(nil, example, "init", "-backend=false")
+		err = handleTerraformOutput(fmt.Sprintf("Terraform init example - %s", example), stdout, stderr, err)
+		if err != nil {
+			return err
+		}
+		stdout, stderr, err = runner.Run(nil, example, "validate")
+		err = handleTerraformOutput(fmt.Sprintf("Terraform validate example - %s", example), stdout, stderr, err)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// junitReportPath creates the report directory for a project and returns the
+// path of the report relative to the project.
+func junitReportPath(directory string) (string, error) {
+	err := os.MkdirAll(path.Join(core.OutputDir, reportsDir, directory), 0o755)
+	if err != nil {
+		return "", err
+	}
+	rootPath, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	relativeRootPath, err := core.GetRelativeRootPath(rootPath, directory)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(relativeRootPath, core.OutputDir, reportsDir, directory, junitReport), nil
+}
+
+func versionAtLeast(current, minimum string) (bool, error) {
+	c, err := version.NewVersion(current)
+	if err != nil {
+		return false, err
+	}
+	m, err := version.NewVersion(minimum)
+	if err != nil {
+		return false, err
+	}
+	return c.GreaterThanOrEqual(m), nil
+}
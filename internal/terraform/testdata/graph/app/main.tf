@@ -0,0 +1,19 @@
+terraform {
+  backend "gcs" {
+    bucket = "example-terraform-state"
+    prefix = "app"
+  }
+}
+
+data "terraform_remote_state" "network" {
+  backend = "gcs"
+  config = {
+    bucket = "example-terraform-state"
+    prefix = "network"
+  }
+}
+
+module "shared" {
+  source = "../modules/shared"
+  name   = data.terraform_remote_state.network.outputs.network
+}
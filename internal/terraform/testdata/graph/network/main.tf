@@ -0,0 +1,10 @@
+terraform {
+  backend "gcs" {
+    bucket = "example-terraform-state"
+    prefix = "network"
+  }
+}
+
+output "network" {
+  value = "default"
+}
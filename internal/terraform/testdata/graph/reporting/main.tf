@@ -0,0 +1,6 @@
+data "terraform_remote_state" "standalone" {
+  backend = "local"
+  config = {
+    path = "../standalone/terraform.tfstate"
+  }
+}
@@ -0,0 +1,14 @@
+resource "google_storage_bucket" "public" {
+  name     = "public"
+  location = "EU"
+}
+
+resource "google_storage_bucket_iam_member" "public" {
+  bucket = google_storage_bucket.public.name
+  role   = "roles/storage.objectViewer"
+  member = "allUsers"
+}
+
+module "network" {
+  source = "./network"
+}
@@ -0,0 +1,12 @@
+#trivy:ignore:AVD-GCP-0066:exp:2024-01-31
+resource "google_storage_bucket" "this" {
+  name     = var.name
+  location = "EU"
+}
+
+resource "google_compute_firewall" "this" {
+  name    = "allow-http"
+  network = "default"
+  # tfsec:ignore:google-compute-no-public-ingress
+  source_ranges = ["0.0.0.0/0"]
+}
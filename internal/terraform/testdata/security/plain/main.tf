@@ -0,0 +1,4 @@
+resource "google_storage_bucket" "this" {
+  name     = "bucket"
+  location = "EU"
+}
@@ -0,0 +1,16 @@
+variable "project_id" {
+  type = string
+}
+
+variable "region" {
+  type    = string
+  default = "europe-west1"
+}
+
+variable "machine_type" {
+  type = string
+}
+
+variable "owner" {
+  type = string
+}
@@ -0,0 +1,203 @@
+package terraform
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/coopnorge/mage/internal/github"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// environmentsDir is the directory in a project containing a tfvars file
+// per environment
+const environmentsDir = "env"
+
+// Environment is an environment of a terraform project with its own tfvars
+// file
+type Environment struct {
+	// Name of the environment, the name of the tfvars file without
+	// extension
+	Name string
+	// VarsFile is the tfvars file relative to the project
+	VarsFile string
+}
+
+// FindEnvironments returns the environments of a terraform project defined by
+// env/<environment>.tfvars files
+func FindEnvironments(directory string) ([]Environment, error) {
+	environments := []Environment{}
+	files, err := filepath.Glob(filepath.Join(directory, environmentsDir, "*.tfvars"))
+	if err != nil {
+		return environments, err
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		environments = append(environments, Environment{
+			Name:     strings.TrimSuffix(filepath.Base(file), ".tfvars"),
+			VarsFile: filepath.Join(environmentsDir, filepath.Base(file)),
+		})
+	}
+	return environments, nil
+}
+
+// VariableIssue is a problem with the variables of an environment
+type VariableIssue struct {
+	Environment string
+	// Level is error for missing variables and warning for unused keys
+	Level   string
+	Message string
+	File    string
+	Line    int
+}
+
+// CheckVariables checks that every variable without a default is provided
+// for every environment of a project and that the tfvars files of the
+// environments only set declared variables. Variables in terraform.tfvars and
+// *.auto.tfvars are provided for all environments.
+func CheckVariables(directory string) ([]VariableIssue, error) {
+	issues := []VariableIssue{}
+	environments, err := FindEnvironments(directory)
+	if err != nil || len(environments) == 0 {
+		return issues, err
+	}
+
+	declared, err := declaredVariables(directory)
+	if err != nil {
+		return nil, err
+	}
+
+	autoLoaded := map[string]hcl.Range{}
+	autoFiles, err := filepath.Glob(filepath.Join(directory, "*.auto.tfvars"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range append([]string{filepath.Join(directory, "terraform.tfvars")}, autoFiles...) {
+		if _, err := os.Stat(file); err != nil {
+			continue
+		}
+		values, err := readTFVars(file)
+		if err != nil {
+			return nil, err
+		}
+		for name, rng := range values {
+			autoLoaded[name] = rng
+		}
+	}
+
+	names := make([]string, 0, len(declared))
+	for name := range declared {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, env := range environments {
+		values, err := readTFVars(filepath.Join(directory, env.VarsFile))
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			variable := declared[name]
+			_, inEnv := values[name]
+			_, inAuto := autoLoaded[name]
+			if variable.required && !inEnv && !inAuto {
+				issues = append(issues, VariableIssue{
+					Environment: env.Name,
+					Level:       "error",
+					Message:     fmt.Sprintf("variable %q is required but not set in %s", name, env.VarsFile),
+					File:        variable.location.Filename,
+					Line:        variable.location.Start.Line,
+				})
+			}
+		}
+
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if _, ok := declared[key]; ok {
+				continue
+			}
+			issues = append(issues, VariableIssue{
+				Environment: env.Name,
+				Level:       "warning",
+				Message:     fmt.Sprintf("%q in %s is not a declared variable", key, env.VarsFile),
+				File:        values[key].Filename,
+				Line:        values[key].Start.Line,
+			})
+		}
+	}
+	return issues, nil
+}
+
+// ValidateVariables reports the issues found by [CheckVariables] and returns
+// an error if a required variable is missing in an environment.
+func ValidateVariables(directory string) error {
+	issues, err := CheckVariables(directory)
+	if err != nil {
+		return err
+	}
+	missing := 0
+	for _, issue := range issues {
+		fmt.Printf("%s: %s (%s)\n", strings.ToUpper(issue.Level), issue.Message, issue.Environment)
+		if github.InCI() {
+			github.PrintFileActionMessage(issue.Level, fmt.Sprintf("Terraform variables - %s", issue.Environment), issue.File, issue.Line, issue.Message)
+		}
+		if issue.Level == "error" {
+			missing++
+		}
+	}
+	if missing > 0 {
+		return fmt.Errorf("%d required variables are not set in the environments of %s", missing, directory)
+	}
+	return nil
+}
+
+type variable struct {
+	required bool
+	location hcl.Range
+}
+
+// declaredVariables returns the variables declared in a project
+func declaredVariables(directory string) (map[string]variable, error) {
+	bodies, err := parseConfig(directory)
+	if err != nil {
+		return nil, err
+	}
+	variables := map[string]variable{}
+	for _, body := range bodies {
+		for _, block := range body.Blocks {
+			if block.Type != "variable" || len(block.Labels) != 1 {
+				continue
+			}
+			_, hasDefault := block.Body.Attributes["default"]
+			variables[block.Labels[0]] = variable{
+				required: !hasDefault,
+				location: block.TypeRange,
+			}
+		}
+	}
+	return variables, nil
+}
+
+// readTFVars returns the keys set in a tfvars file and their location
+func readTFVars(file string) (map[string]hcl.Range, error) {
+	src, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	f, diags := hclsyntax.ParseConfig(src, file, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("failed to parse %s: %w", file, diags)
+	}
+	values := map[string]hcl.Range{}
+	for name, attr := range f.Body.(*hclsyntax.Body).Attributes {
+		values[name] = attr.NameRange
+	}
+	return values, nil
+}
@@ -0,0 +1,255 @@
+package terraform
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/coopnorge/mage/internal/core"
+	"github.com/coopnorge/mage/internal/devtool"
+	"github.com/hashicorp/go-version"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Flavour is the infrastructure as code binary used to run a project
+type Flavour string
+
+const (
+	// FlavourTerraform runs the project with HashiCorp Terraform
+	FlavourTerraform Flavour = "terraform"
+	// FlavourTofu runs the project with OpenTofu
+	FlavourTofu Flavour = "tofu"
+)
+
+const (
+	terraformVersionFile = ".terraform-version"
+	opentofuVersionFile  = ".opentofu-version"
+)
+
+// IaC describes the binary and the version a Terraform project is run with
+type IaC struct {
+	// Flavour is either terraform or tofu
+	Flavour Flavour
+	// Constraint is the version constraint required by the project. Empty
+	// if the project does not require a version.
+	Constraint string
+	// Version is the resolved version used for the devtool image
+	Version string
+	// Source describes where the flavour and constraint was detected
+	Source string
+}
+
+// iacRunner is implemented by both devtool.Terraform and devtool.Tofu
+type iacRunner interface {
+	Run(env map[string]string, workdir string, args ...string) (string, string, error)
+}
+
+// useTofu returns true when terraform.use_tofu is configured, e.g. with
+// USE_TOFU=true
+func useTofu() (bool, error) {
+	config, err := core.CurrentConfig()
+	if err != nil {
+		return false, err
+	}
+	return config.Terraform.UseTofu, nil
+}
+
+// getIaCRunner returns the devtool for the binary and version the Terraform
+// project in directory requires. See [DetectIaC] for details.
+func getIaCRunner(directory string) (iacRunner, error) {
+	iac, err := DetectIaC(directory)
+	if err != nil {
+		return nil, err
+	}
+	if core.Verbose() {
+		fmt.Printf("Using %s %s for %s (%s)\n", iac.Flavour, iac.Version, directory, iac.Source)
+	}
+	return newIaCRunner(iac), nil
+}
+
+// newIaCRunner returns the devtool for a detected [IaC]
+func newIaCRunner(iac IaC) iacRunner {
+	if iac.Flavour == FlavourTofu {
+		return devtool.Tofu{Version: iac.Version, Constraint: iac.Constraint}
+	}
+	return devtool.Terraform{Version: iac.Version, Constraint: iac.Constraint}
+}
+
+// DetectIaC detects which binary and version should be used for a Terraform
+// project. The first match wins:
+//
+//   - a .opentofu-version file in the project or a parent directory selects
+//     OpenTofu with the version in the file
+//   - a .terraform-version file in the project or a parent directory selects
+//     Terraform with the version in the file
+//   - *.tofu files in the project select OpenTofu
+//   - USE_TOFU=true selects OpenTofu, otherwise Terraform is used
+//
+// Unless a version file is found the version constraint is read from
+// required_version in the terraform block. The constraint is resolved to the
+// devtool version pinned in tools.Dockerfile when it satisfies the
+// constraint, an exact version is used as is.
+func DetectIaC(directory string) (IaC, error) {
+	iac := IaC{}
+	switch {
+	case findVersionFile(directory, opentofuVersionFile) != "":
+		file := findVersionFile(directory, opentofuVersionFile)
+		constraint, err := readVersionFile(file)
+		if err != nil {
+			return iac, err
+		}
+		iac = IaC{Flavour: FlavourTofu, Constraint: constraint, Source: file}
+	case findVersionFile(directory, terraformVersionFile) != "":
+		file := findVersionFile(directory, terraformVersionFile)
+		constraint, err := readVersionFile(file)
+		if err != nil {
+			return iac, err
+		}
+		iac = IaC{Flavour: FlavourTerraform, Constraint: constraint, Source: file}
+	default:
+		constraint, err := requiredVersion(directory)
+		if err != nil {
+			return iac, err
+		}
+		tofuFiles, err := filepath.Glob(filepath.Join(directory, "*.tofu"))
+		if err != nil {
+			return iac, err
+		}
+		tofu, err := useTofu()
+		if err != nil {
+			return iac, err
+		}
+		switch {
+		case len(tofuFiles) > 0:
+			iac = IaC{Flavour: FlavourTofu, Constraint: constraint, Source: "*.tofu files"}
+		case tofu:
+			iac = IaC{Flavour: FlavourTofu, Constraint: constraint, Source: "USE_TOFU=true"}
+		default:
+			iac = IaC{Flavour: FlavourTerraform, Constraint: constraint, Source: "default"}
+		}
+		if constraint != "" {
+			iac.Source = fmt.Sprintf("%s, required_version %q", iac.Source, constraint)
+		}
+	}
+
+	pinned, err := devtool.PinnedVersion(string(iac.Flavour))
+	if err != nil {
+		return iac, err
+	}
+	iac.Version, err = resolveVersion(pinned, iac.Constraint)
+	if err != nil {
+		return iac, fmt.Errorf("unable to select %s version for %s: %w", iac.Flavour, directory, err)
+	}
+	return iac, nil
+}
+
+// resolveVersion returns the devtool version to use for a version
+// constraint. An exact version is returned as is, the pinned version is
+// returned when it satisfies the constraint.
+func resolveVersion(pinned, constraint string) (string, error) {
+	if constraint == "" {
+		return pinned, nil
+	}
+	exact, err := version.NewVersion(constraint)
+	if err == nil {
+		return exact.String(), nil
+	}
+	c, err := version.NewConstraint(constraint)
+	if err != nil {
+		return "", fmt.Errorf("invalid version constraint %q: %w", constraint, err)
+	}
+	pinnedVersion, err := version.NewVersion(pinned)
+	if err != nil {
+		return "", err
+	}
+	if c.Check(pinnedVersion) {
+		return pinned, nil
+	}
+	return "", fmt.Errorf(
+		"the default version %s does not satisfy %q, pin an exact version in %s or %s",
+		pinned, constraint, terraformVersionFile, opentofuVersionFile,
+	)
+}
+
+// findVersionFile searches for filename in directory and its parents up to
+// the current working directory. Returns an empty string if not found.
+func findVersionFile(directory, filename string) string {
+	dir := filepath.Clean(directory)
+	for {
+		if core.FileExistsInDirectory(dir, filename) {
+			return filepath.Join(dir, filename)
+		}
+		if dir == "." || dir == filepath.Dir(dir) {
+			return ""
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+func readVersionFile(file string) (string, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	v := strings.TrimSpace(string(content))
+	if v == "" {
+		return "", fmt.Errorf("version file %s is empty", file)
+	}
+	return v, nil
+}
+
+// requiredVersion returns the required_version constraints of all terraform
+// blocks in the project joined together.
+func requiredVersion(directory string) (string, error) {
+	bodies, err := parseConfig(directory)
+	if err != nil {
+		return "", err
+	}
+	constraints := []string{}
+	for _, body := range bodies {
+		for _, block := range body.Blocks {
+			if block.Type != "terraform" {
+				continue
+			}
+			attr, ok := block.Body.Attributes["required_version"]
+			if !ok {
+				continue
+			}
+			value, diags := attr.Expr.Value(nil)
+			if diags.HasErrors() || value.Type() != cty.String {
+				return "", fmt.Errorf("required_version in %s must be a string", attr.SrcRange.Filename)
+			}
+			constraints = append(constraints, value.AsString())
+		}
+	}
+	return strings.Join(constraints, ", "), nil
+}
+
+// parseConfig parses all .tf and .tofu files in the directory.
+func parseConfig(directory string) ([]*hclsyntax.Body, error) {
+	files := []string{}
+	for _, pattern := range []string{"*.tf", "*.tofu"} {
+		matches, err := filepath.Glob(filepath.Join(directory, pattern))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+
+	bodies := []*hclsyntax.Body{}
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		f, diags := hclsyntax.ParseConfig(src, file, hcl.InitialPos)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("failed to parse %s: %w", file, diags)
+		}
+		bodies = append(bodies, f.Body.(*hclsyntax.Body))
+	}
+	return bodies, nil
+}
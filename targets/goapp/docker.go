@@ -4,20 +4,43 @@ import (
 	"context"
 	_ "embed"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
 	"os"
 	"path"
-	"strconv"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/coopnorge/mage/internal/core"
+	"github.com/coopnorge/mage/internal/devtool"
 	"github.com/coopnorge/mage/internal/docker"
+	"github.com/coopnorge/mage/internal/git"
+	"github.com/coopnorge/mage/internal/github"
 	"github.com/coopnorge/mage/internal/golang"
 
 	"github.com/magefile/mage/mg"
+	"github.com/magefile/mage/sh"
 )
 
 //go:embed app.Dockerfile
 var dockerfile string
 
+// ociReleasePrefix is the prefix of the names of the releases of the images
+const ociReleasePrefix = "Go OCI Release"
+
+// previousReleases is the number of recent releases searched for the image of
+// an unchanged binary
+const previousReleases = 10
+
+// embeddedPrefix is the prefix of the sources of embedded Dockerfiles
+const embeddedPrefix = "embedded "
+
+// embeddedDockerfile is the source of the embedded Dockerfile
+const embeddedDockerfile = embeddedPrefix + "app.Dockerfile"
+
 // Docker is the magefile namespace to group Docker commands
 type Docker mg.Namespace
 
@@ -77,27 +100,42 @@ type Docker mg.Namespace
 //	            └── metadata.json
 //
 // oci-images.json will contain a map over the images and tags per app and
-// binary.
+// binary. The images are tagged with the tagging strategies in docker.tags,
+// tag is the primary tag and tags are all tags separated by commas. Pin
+// deployments to reference, the image pinned to its digest. platforms are the
+// manifest digests and the sizes in bytes by platform.
 //
 //	{
 //	  "app1": {
 //	    "dataloader": {
 //	      "image": "ocreg.invalid/coopnorge/app1/dataloader:v2025.03.11135857",
-//	      "tag": "v2025.03.11135857"
+//	      "tag": "v2025.03.11135857",
+//	      "tags": "v2025.03.11135857",
+//	      "digest": "sha256:94c49256e2dec5add85c669fe7498aa93e188ebffb6c0c8ec4fe85105a19abdb",
+//	      "reference": "ocreg.invalid/coopnorge/app1/dataloader:v2025.03.11135857@sha256:94c49256e2dec5add85c669fe7498aa93e188ebffb6c0c8ec4fe85105a19abdb",
+//	      "platforms": {
+//	        "linux/amd64": {"digest": "sha256:5f0b6c1f...", "size": 7340032},
+//	        "linux/arm64": {"digest": "sha256:8d3c1a6f...", "size": 6815744}
+//	      },
+//	      "size": 14155776,
+//	      "build_duration": "1m23s"
 //	    },
 //	    "server": {
 //	      "image": "ocreg.invalid/coopnorge/app1/server:v2025.03.11135857",
-//	      "tag": "v2025.03.11135857"
+//	      "tag": "v2025.03.11135857",
+//	      "tags": "v2025.03.11135857"
 //	    }
 //	  }
 //	  "app2": {
 //	    "dataloader": {
 //	      "image": "ocreg.invalid/coopnorge/app2/dataloader:v2025.03.11135857",
-//	      "tag": "v2025.03.11135857"
+//	      "tag": "v2025.03.11135857",
+//	      "tags": "v2025.03.11135857"
 //	    },
 //	    "server": {
 //	      "image": "ocreg.invalid/coopnorge/app2/server:v2025.03.11135857",
-//	      "tag": "v2025.03.11135857"
+//	      "tag": "v2025.03.11135857",
+//	      "tags": "v2025.03.11135857"
 //	    }
 //	  }
 //	}
@@ -110,6 +148,18 @@ func (Docker) BuildAndPush(ctx context.Context) error {
 // binaries to present in the ./var/bin/ directories.
 // Setting the PUSH_IMAGE environmental variable to true will push the images to the
 // registries.
+//
+// Images are only built for binaries affected by changes since the last Go
+// OCI Release, see [Go.Affected]. The metadata of a skipped binary references
+// the image of the most recent release that has one, its entry in
+// oci-images.json has "skipped": true. Set DOCKER_BUILD_UNCHANGED to true
+// to build every image.
+//
+// A binary is built with cmd/<binary>/Dockerfile in its Go module if it
+// exists, otherwise with the Dockerfile set in docker.dockerfile or the
+// embedded Dockerfile. The build context is the root of the repository and
+// the Dockerfile must declare the build arguments APP, BINARY and
+// GIT_COMMIT_SHA.
 func (Docker) BuildImages(ctx context.Context) error {
 	shouldPush, err := shouldPush()
 	if err != nil {
@@ -125,9 +175,18 @@ func (Docker) BuildImages(ctx context.Context) error {
 		return err
 	}
 
+	previousImages, err := unchangedImages(goModules, cmds)
+	if err != nil {
+		return err
+	}
+
 	deps := []any{}
 	for _, cmd := range cmds {
 		for _, binary := range cmd.binaries {
+			if previous, ok := previousImages[cmd.goModule][binary]; ok {
+				deps = append(deps, mg.F(skipBuild, cmd.goModule, binary, previous.Image, previous.Digest))
+				continue
+			}
 			deps = append(deps, mg.F(buildAndPush, cmd.goModule, binary, shouldPush))
 		}
 	}
@@ -137,11 +196,94 @@ func (Docker) BuildImages(ctx context.Context) error {
 }
 
 func buildAndPush(_ context.Context, app, binary string, shouldPush bool) error {
-	imageName := docker.FullyQualifiedlImageName(app, binary)
+	imageName, err := docker.FullyQualifiedlImageName(app, binary)
+	if err != nil {
+		return err
+	}
+	content, source, err := appDockerfile(app, binary)
+	if err != nil {
+		return err
+	}
+	err = docker.ValidateRequiredArgs(content)
+	if err != nil {
+		return fmt.Errorf("%s: %w", source, err)
+	}
+	config, err := core.CurrentConfig()
+	if err != nil {
+		return err
+	}
+	err = docker.ValidateRequiredLabels(content, config.Docker.RequiredLabels)
+	if err != nil {
+		return fmt.Errorf("%s: %w", source, err)
+	}
 	imagePath := imagePath(app, binary)
 	metadataPath := metadataPath(app, binary)
 
-	return docker.BuildAndPush(dockerfile, golang.DockerPlatforms(), imageName, ".", imagePath, metadataPath, app, binary, shouldPush)
+	return docker.BuildAndPush(content, golang.DockerPlatforms(), imageName, ".", imagePath, metadataPath, app, binary, shouldPush)
+}
+
+// appDockerfile returns the content and the source of the Dockerfile of a
+// binary: cmd/<binary>/Dockerfile in the Go module, the Dockerfile set in
+// docker.dockerfile or the embedded Dockerfile
+func appDockerfile(app, binary string) (string, string, error) {
+	config, err := core.CurrentConfig()
+	if err != nil {
+		return "", "", err
+	}
+	for _, source := range []string{path.Join(app, cmdDir, binary, "Dockerfile"), config.Docker.Dockerfile} {
+		if source == "" {
+			continue
+		}
+		content, err := os.ReadFile(source)
+		if os.IsNotExist(err) && source != config.Docker.Dockerfile {
+			continue
+		}
+		if err != nil {
+			return "", "", err
+		}
+		return string(content), source, nil
+	}
+	return dockerfile, embeddedDockerfile, nil
+}
+
+func skipBuild(_ context.Context, app, binary, previousImage, digest string) error {
+	fmt.Printf("Skipping the image of %s/%s without changes, using %s\n", app, binary, previousImage)
+	return docker.WriteSkippedMetadata(metadataPath(app, binary), previousImage, digest)
+}
+
+// unchangedImages returns the image of the most recent release by app and
+// binary for the binaries that are not affected by changes since the last
+// release, see [docker.UnchangedImages]. Only the most recent releases are
+// searched, see previousReleases.
+func unchangedImages(goModules []string, cmds []cmd) (map[string]map[string]docker.PreviousImage, error) {
+	config, err := core.CurrentConfig()
+	if err != nil {
+		return nil, err
+	}
+	if config.Docker.BuildUnchanged {
+		return map[string]map[string]docker.PreviousImage{}, nil
+	}
+	binaries := map[string][]string{}
+	for _, cmd := range cmds {
+		binaries[cmd.goModule] = append(binaries[cmd.goModule], cmd.binaries...)
+	}
+	unchanged := docker.UnchangedImages{
+		Binaries: binaries,
+		ChangedFiles: func() ([]string, error) {
+			return git.DiffToLatestRelease(ociReleasePrefix)
+		},
+		Affected: func(changedFiles []string) (map[string][]string, error) {
+			affected, err := golang.AffectedByFiles(goModules, changedFiles)
+			return affected.Binaries, err
+		},
+		Dockerfile: config.Docker.Dockerfile,
+		Releases: func() ([]string, error) {
+			return github.GetReleaseTagsWithPrefix(ociReleasePrefix, previousReleases)
+		},
+		ImageName: docker.FullyQualifiedlImageName,
+		Digest:    docker.ImageDigest,
+	}
+	return unchanged.Find()
 }
 
 func writeImageMetadata() error {
@@ -161,9 +303,398 @@ func writeImageMetadata() error {
 	return os.WriteFile(path.Join(core.OutputDir, "oci-images.json"), jsonString, 0o644)
 }
 
-// Validate Dockerfiles
+// Validate the embedded Dockerfile and the Dockerfiles of the binaries, see
+// [Docker.BuildImages], they must declare the required ARGs and set the labels
+// in docker.required_labels in the final stage. They and the other Dockerfiles
+// in the repository are linted, base images must be pinned to a digest, apk
+// add must use --no-cache, the final stage must have a USER that is not root
+// and ADD must not download URLs without a checksum. Rules in
+// docker.lint_ignore are not reported.
 func (Docker) Validate(_ context.Context) error {
-	return docker.Validate(dockerfile)
+	config, err := core.CurrentConfig()
+	if err != nil {
+		return err
+	}
+	goModules, err := golang.FindGoModules(".")
+	if err != nil {
+		return err
+	}
+	cmds, err := findCommands(goModules)
+	if err != nil {
+		return err
+	}
+
+	dockerfiles := map[string]string{embeddedDockerfile: dockerfile}
+	sources := []string{embeddedDockerfile}
+	for _, cmd := range cmds {
+		for _, binary := range cmd.binaries {
+			content, source, err := appDockerfile(cmd.goModule, binary)
+			if err != nil {
+				return err
+			}
+			if _, ok := dockerfiles[source]; !ok {
+				dockerfiles[source] = content
+				sources = append(sources, source)
+			}
+		}
+	}
+
+	for _, source := range sources {
+		fmt.Printf("Validating %s\n", source)
+		err := docker.ValidateRequiredArgs(dockerfiles[source])
+		if err != nil {
+			return fmt.Errorf("%s: %w", source, err)
+		}
+		err = docker.ValidateRequiredLabels(dockerfiles[source], config.Docker.RequiredLabels)
+		if err != nil {
+			return fmt.Errorf("%s: %w", source, err)
+		}
+		err = docker.Validate(dockerfiles[source])
+		if err != nil {
+			return fmt.Errorf("%s: %w", source, err)
+		}
+	}
+
+	repositoryDockerfiles, err := docker.FindDockerfiles(".")
+	if err != nil {
+		return err
+	}
+	for _, source := range repositoryDockerfiles {
+		if slices.ContainsFunc(sources, func(s string) bool { return filepath.Clean(s) == filepath.Clean(source) }) {
+			continue
+		}
+		content, err := os.ReadFile(source)
+		if err != nil {
+			return err
+		}
+		dockerfiles[source] = string(content)
+		sources = append(sources, source)
+	}
+	failed := []string{}
+	for _, source := range sources {
+		fmt.Printf("Linting %s\n", source)
+		findings := slices.DeleteFunc(docker.Lint(dockerfiles[source]), func(finding docker.Finding) bool {
+			return slices.ContainsFunc(config.Docker.LintIgnore, func(name string) bool {
+				return docker.IsRule(finding.Rule, name)
+			})
+		})
+		for _, finding := range findings {
+			title := fmt.Sprintf("Dockerfile %s", finding.Rule)
+			if source == embeddedDockerfile {
+				github.PrintActionMessage("error", title, fmt.Sprintf("%s:%d: %s", source, finding.Line, finding.Message))
+				fmt.Println()
+				continue
+			}
+			github.PrintFileActionMessage("error", title, source, finding.Line, finding.Message)
+		}
+		if len(findings) > 0 {
+			failed = append(failed, source)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("lint findings in %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// Verify the signatures and the provenance of the images in
+// var/oci-images.json with cosign. Images are signed when they are pushed
+// with docker.sign set to true. Set docker.verify_key to verify signatures of
+// a key pair, otherwise keyless signatures by workflows of the owner of the
+// repository are verified.
+func (Docker) Verify(_ context.Context) error {
+	return docker.Verify(path.Join(core.OutputDir, "oci-images.json"))
+}
+
+// Inspect the images in var/<app>/oci/<binary>/image.tar without a docker
+// daemon. The size of every layer is reported and the image of every platform
+// must not run as root, must have the labels in docker.required_labels, must
+// not contain files that look like secrets and must not be larger than
+// docker.max_image_size MiB. Binaries without an image, like skipped binaries,
+// are not inspected.
+func (Docker) Inspect(_ context.Context) error {
+	config, err := core.CurrentConfig()
+	if err != nil {
+		return err
+	}
+	policy := docker.InspectPolicy{
+		RequiredLabels: config.Docker.RequiredLabels,
+		MaxSize:        int64(config.Docker.MaxImageSize) << 20,
+	}
+	goModules, err := golang.FindGoModules(".")
+	if err != nil {
+		return err
+	}
+	cmds, err := findCommands(goModules)
+	if err != nil {
+		return err
+	}
+
+	failed := []string{}
+	for _, cmd := range cmds {
+		for _, binary := range cmd.binaries {
+			name := path.Join(cmd.goModule, binary)
+			imagePath := imagePath(cmd.goModule, binary)
+			if _, err := os.Stat(imagePath); os.IsNotExist(err) {
+				fmt.Printf("No image of %s, skipping\n", name)
+				continue
+			}
+			inspection, err := docker.Inspect(imagePath, policy)
+			if err != nil {
+				return err
+			}
+			printInspection(name, inspection)
+			if len(inspection.Findings) == 0 {
+				continue
+			}
+			_, source, err := appDockerfile(cmd.goModule, binary)
+			if err != nil {
+				return err
+			}
+			for _, finding := range inspection.Findings {
+				if source == embeddedDockerfile {
+					github.PrintActionMessage("error", fmt.Sprintf("Image %s", name), finding)
+					fmt.Println()
+					continue
+				}
+				github.PrintFileActionMessage("error", fmt.Sprintf("Image %s", name), source, 0, finding)
+			}
+			failed = append(failed, name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("images not complying with the policy: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func printInspection(name string, inspection *docker.Inspection) {
+	platforms := slices.Sorted(maps.Keys(inspection.Platforms))
+	for _, platform := range platforms {
+		fmt.Printf("%s %s: %s\n", name, platform, docker.FormatSize(inspection.Platforms[platform].Size))
+		for _, layer := range inspection.Layers[platform] {
+			fmt.Printf("  %10s  %s  %s\n", docker.FormatSize(layer.Size), layer.Digest, layer.CreatedBy)
+		}
+	}
+}
+
+// SmokeTest loads the image in var/<app>/oci/<binary>/image.tar of every
+// binary for the platform of docker and runs it. By default the binary runs
+// as the entrypoint with --help and must exit with 0, set
+// docker.smoke_test.http_path to request a health endpoint of the entrypoint
+// and the command of the image instead. The results are
+// added to var/oci-images.json, see [Docker.BuildAndPush]. Binaries without an
+// image, like skipped binaries, are not tested.
+func (Docker) SmokeTest(_ context.Context) error {
+	config, err := core.CurrentConfig()
+	if err != nil {
+		return err
+	}
+	smokeTest := docker.SmokeTest{
+		Args:       config.Docker.SmokeTest.Args,
+		Entrypoint: config.Docker.SmokeTest.Entrypoint,
+		Env:        config.Docker.SmokeTest.Env,
+		HTTPPath:   config.Docker.SmokeTest.HTTPPath,
+		HTTPPort:   config.Docker.SmokeTest.HTTPPort,
+		HTTPStatus: config.Docker.SmokeTest.HTTPStatus,
+		Timeout:    time.Duration(config.Docker.SmokeTest.Timeout) * time.Second,
+	}
+	platform, err := sh.Output("docker", "version", "--format", "{{.Server.Os}}/{{.Server.Arch}}")
+	if err != nil {
+		return err
+	}
+	goModules, err := golang.FindGoModules(".")
+	if err != nil {
+		return err
+	}
+	cmds, err := findCommands(goModules)
+	if err != nil {
+		return err
+	}
+
+	failed := []string{}
+	for _, cmd := range cmds {
+		for _, binary := range cmd.binaries {
+			name := path.Join(cmd.goModule, binary)
+			imagePath := imagePath(cmd.goModule, binary)
+			if _, err := os.Stat(imagePath); os.IsNotExist(err) {
+				fmt.Printf("No image of %s, skipping\n", name)
+				continue
+			}
+			image, err := docker.LoadImage(imagePath, platform)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Smoke testing %s with %s\n", name, image)
+			result, err := smokeTest.Run(image, binary, platform)
+			if err != nil {
+				return err
+			}
+			err = docker.RecordSmokeTest(metadataPath(cmd.goModule, binary), result)
+			if err != nil {
+				return err
+			}
+			if result.Passed {
+				fmt.Printf("%s passed in %s\n", name, result.Duration)
+				continue
+			}
+			github.PrintActionMessage("error", fmt.Sprintf("Smoke test of %s", name), result.Message)
+			fmt.Println()
+			failed = append(failed, name)
+		}
+	}
+
+	err = writeImageMetadata()
+	if err != nil {
+		return err
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("smoke tests failed: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// PushLocal builds every image, pushes it to a throwaway registry:2
+// container on localhost and verifies that the tags and the manifests in
+// var/oci-images.json were pushed. docker:buildAndPush runs with
+// OCI_IMAGE_BASE set to the registry and PUSH_IMAGE set to true, images are
+// not signed. The registry is removed afterwards.
+func (Docker) PushLocal(_ context.Context) (err error) {
+	registry, err := docker.StartLocalRegistry()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, registry.Stop())
+	}()
+
+	fmt.Printf("Pushing to %s\n", registry.URL)
+	err = sh.RunWithV(registry.Env(), mg.GoCmd(), "tool", "mage", "docker:buildAndPush")
+	if err != nil {
+		return err
+	}
+	images, err := docker.ReadImages(path.Join(core.OutputDir, "oci-images.json"))
+	if err != nil {
+		return err
+	}
+	return registry.VerifyImages(images)
+}
+
+// CheckBaseImages checks the base images pinned to a tag and a digest, like
+// FROM alpine:3.24.1@sha256:<digest>, in the Dockerfiles of the repository
+// and the embedded Dockerfiles against their registries. It reports when the
+// tag has a newer digest or a newer patch tag exists, see
+// [Docker.UpdateBaseImages]. Base images whose registry fails are reported
+// as warnings.
+func (Docker) CheckBaseImages(_ context.Context) error {
+	updates, failures, err := baseImageUpdates()
+	if err != nil {
+		return err
+	}
+	printBaseImageFailures(failures)
+	for _, update := range updates {
+		title := fmt.Sprintf("Base image %s", update.Pin.Reference.Repository)
+		message := fmt.Sprintf("%s can be updated to %s", update.Pin.Image, update.Image())
+		if strings.HasPrefix(update.Pin.Source, embeddedPrefix) {
+			github.PrintActionMessage("notice", title, fmt.Sprintf("%s:%d: %s, update github.com/coopnorge/mage", update.Pin.Source, update.Pin.Line, message))
+			fmt.Println()
+			continue
+		}
+		github.PrintFileActionMessage("warning", title, update.Pin.Source, update.Pin.Line, message)
+	}
+	if len(updates) == 0 && len(failures) == 0 {
+		fmt.Println("Base images are up to date")
+	}
+	return nil
+}
+
+// UpdateBaseImages rewrites the base images of the Dockerfiles of the
+// repository that can be updated, see [Docker.CheckBaseImages]. The embedded
+// Dockerfiles are updated with new releases of github.com/coopnorge/mage.
+func (Docker) UpdateBaseImages(_ context.Context) error {
+	updates, failures, err := baseImageUpdates()
+	if err != nil {
+		return err
+	}
+	printBaseImageFailures(failures)
+	bySource := map[string][]docker.BaseImageUpdate{}
+	for _, update := range updates {
+		if strings.HasPrefix(update.Pin.Source, embeddedPrefix) {
+			continue
+		}
+		bySource[update.Pin.Source] = append(bySource[update.Pin.Source], update)
+	}
+	for _, source := range slices.Sorted(maps.Keys(bySource)) {
+		content, err := os.ReadFile(source)
+		if err != nil {
+			return err
+		}
+		for _, update := range bySource[source] {
+			fmt.Printf("Updating %s:%d to %s\n", source, update.Pin.Line, update.Image())
+		}
+		err = os.WriteFile(source, []byte(docker.UpdateDockerfile(string(content), bySource[source])), 0o644)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printBaseImageFailures annotates the base images that could not be checked
+func printBaseImageFailures(failures []docker.BaseImageFailure) {
+	for _, failure := range failures {
+		title := fmt.Sprintf("Base image %s", failure.Pin.Reference.Repository)
+		message := fmt.Sprintf("%s could not be checked: %s", failure.Pin.Image, failure.Err)
+		if strings.HasPrefix(failure.Pin.Source, embeddedPrefix) {
+			github.PrintActionMessage("warning", title, fmt.Sprintf("%s:%d: %s", failure.Pin.Source, failure.Pin.Line, message))
+			fmt.Println()
+			continue
+		}
+		github.PrintFileActionMessage("warning", title, failure.Pin.Source, failure.Pin.Line, message)
+	}
+}
+
+// baseImageUpdates returns the updates of the base images of the Dockerfiles
+// of the repository and the embedded Dockerfiles and the base images that
+// could not be checked, embedded Dockerfiles that are also in the repository
+// are checked once
+func baseImageUpdates() ([]docker.BaseImageUpdate, []docker.BaseImageFailure, error) {
+	sources, err := docker.FindDockerfiles(".")
+	if err != nil {
+		return nil, nil, err
+	}
+	dockerfiles := map[string]string{}
+	for _, source := range sources {
+		content, err := os.ReadFile(source)
+		if err != nil {
+			return nil, nil, err
+		}
+		dockerfiles[source] = string(content)
+	}
+	repositoryContents := slices.Collect(maps.Values(dockerfiles))
+	embedded := map[string]string{embeddedDockerfile: dockerfile}
+	for name, content := range devtool.EmbeddedDockerfiles() {
+		embedded[embeddedPrefix+name] = content
+	}
+	for _, source := range slices.Sorted(maps.Keys(embedded)) {
+		if slices.Contains(repositoryContents, embedded[source]) {
+			continue
+		}
+		dockerfiles[source] = embedded[source]
+		sources = append(sources, source)
+	}
+
+	pins := []docker.PinnedImage{}
+	for _, source := range sources {
+		sourcePins, err := docker.FindPinnedImages(source, dockerfiles[source])
+		if err != nil {
+			return nil, nil, err
+		}
+		pins = append(pins, sourcePins...)
+	}
+	fmt.Printf("Checking %d base images in %d Dockerfiles\n", len(pins), len(sources))
+	updates, failures := docker.CheckBaseImages(pins, docker.NewRegistryForHost)
+	return updates, failures, nil
 }
 
 func imageDir(app, binary string) string {
@@ -179,13 +710,9 @@ func metadataPath(app, binary string) string {
 }
 
 func shouldPush() (bool, error) {
-	val, ok := os.LookupEnv(PushEnv)
-	if !ok || val == "" {
-		return false, nil
-	}
-	boolValue, err := strconv.ParseBool(val)
+	config, err := core.CurrentConfig()
 	if err != nil {
 		return false, err
 	}
-	return boolValue, nil
+	return config.Docker.PushImage, nil
 }
@@ -11,7 +11,8 @@ import (
 // Git is the magefile namespace to group Git commands
 type Git mg.Namespace
 
-// ListChanges list all changes to origin/main
+// ListChanges list all changes compared to the merge-base with the default
+// branch, see git.default_branch in .mage.yaml
 func (Git) ListChanges(ctx context.Context) error {
 	mg.CtxDeps(ctx, gitTargets.ListChanges)
 	return nil
@@ -257,7 +257,43 @@ func binaryOutputBasePath(app string) string {
 // Changes returns the string true or false depending on the fact that
 // the current branch contains changes compared to the main branch.
 func (Go) Changes(ctx context.Context) error {
-	mg.CtxDeps(ctx, mg.F(golangTargets.Changes, "Go OCI Release"))
+	mg.CtxDeps(ctx, mg.F(golangTargets.Changes, ociReleasePrefix))
+	return nil
+}
+
+// Affected prints the Go modules and the binaries in cmd affected by the
+// changes as JSON, changes to shared packages affect the modules and binaries
+// importing them.
+func (Go) Affected(ctx context.Context) error {
+	mg.CtxDeps(ctx, mg.F(golangTargets.Affected, ociReleasePrefix))
+	return nil
+}
+
+// TestDir (directory: string) runs the tests of a single Go module.
+func (Go) TestDir(ctx context.Context, directory string) error {
+	mg.CtxDeps(ctx, mg.F(golangTargets.TestDir, directory))
+	return nil
+}
+
+// LintDir (directory: string) checks the Go source code of a single Go module
+// for issues.
+func (Go) LintDir(ctx context.Context, directory string) error {
+	mg.CtxDeps(ctx, mg.F(golangTargets.LintDir, directory))
+	return nil
+}
+
+// ValidateModule (directory: string) runs validation check on a single Go
+// module.
+//
+// For details see [golangTargets.ValidateModule].
+func (Go) ValidateModule(ctx context.Context, directory string) error {
+	mg.CtxDeps(ctx, mg.F(golangTargets.ValidateModule, directory))
+	return nil
+}
+
+// GitHubActionsJobMatrix returns a matrix with a job per changed Go module
+func (Go) GitHubActionsJobMatrix(ctx context.Context) error {
+	mg.CtxDeps(ctx, mg.F(golangTargets.GitHubActionsJobMatrix, ociReleasePrefix))
 	return nil
 }
 
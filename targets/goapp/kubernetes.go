@@ -35,3 +35,17 @@ func (K8s) Changes(ctx context.Context) error {
 	mg.CtxDeps(ctx, kubernetesTargets.Changes)
 	return nil
 }
+
+// ValidateChart (directory, env: string) validates a single helm chart for an
+// environment
+func (K8s) ValidateChart(ctx context.Context, directory, env string) error {
+	mg.CtxDeps(ctx, mg.F(kubernetesTargets.ValidateChart, directory, env))
+	return nil
+}
+
+// GitHubActionsJobMatrix returns a matrix with a job per changed helm chart
+// and environment
+func (K8s) GitHubActionsJobMatrix(ctx context.Context) error {
+	mg.CtxDeps(ctx, kubernetesTargets.GitHubActionsJobMatrix)
+	return nil
+}
@@ -47,13 +47,15 @@ import (
 	"context"
 
 	"github.com/coopnorge/mage/internal/core"
+	"github.com/coopnorge/mage/internal/targets/discover"
 	"github.com/magefile/mage/mg"
 	"github.com/magefile/mage/sh"
 )
 
 const (
 	// PushEnv is the name of the environmental variable used to trigger
-	// pushing of OCI images. Set PUSH_IMAGE to true to push images.
+	// pushing of OCI images. Set PUSH_IMAGE to true to push images, or
+	// docker.push_image in .mage.yaml.
 	PushEnv = "PUSH_IMAGE"
 )
 
@@ -99,3 +101,12 @@ func Fix(ctx context.Context) error {
 func Clean(_ context.Context) error {
 	return sh.Rm(core.OutputDir)
 }
+
+// Discover lists the Go modules, Terraform projects, Helm charts and pallet
+// files in the repository, whether they are included or skipped and why.
+// Configure the discovery with discovery.exclude and discovery.include in
+// .mage.yaml.
+func Discover(ctx context.Context) error {
+	mg.CtxDeps(ctx, discover.Discover)
+	return nil
+}
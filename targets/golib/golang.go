@@ -63,6 +63,13 @@ func (Go) LintFix(ctx context.Context) error {
 	return nil
 }
 
+// Affected prints the Go modules affected by the changes as JSON, changes to
+// shared packages affect the modules importing them.
+func (Go) Affected(ctx context.Context) error {
+	mg.CtxDeps(ctx, mg.F(golang.Affected, "v"))
+	return nil
+}
+
 // Changes returns the string true or false depending on the fact that
 // the current branch contains changes compared to the main branch.
 func (Go) Changes(ctx context.Context) error {
@@ -76,6 +83,34 @@ func (Go) DownloadModules(ctx context.Context) error {
 	return nil
 }
 
+// TestDir (directory: string) runs the tests of a single Go module.
+func (Go) TestDir(ctx context.Context, directory string) error {
+	mg.CtxDeps(ctx, mg.F(golang.TestDir, directory))
+	return nil
+}
+
+// LintDir (directory: string) checks the Go source code of a single Go module
+// for issues.
+func (Go) LintDir(ctx context.Context, directory string) error {
+	mg.CtxDeps(ctx, mg.F(golang.LintDir, directory))
+	return nil
+}
+
+// ValidateModule (directory: string) runs validation check on a single Go
+// module.
+//
+// For details see [golang.ValidateModule].
+func (Go) ValidateModule(ctx context.Context, directory string) error {
+	mg.CtxDeps(ctx, mg.F(golang.ValidateModule, directory))
+	return nil
+}
+
+// GitHubActionsJobMatrix returns a matrix with a job per changed Go module
+func (Go) GitHubActionsJobMatrix(ctx context.Context) error {
+	mg.CtxDeps(ctx, mg.F(golang.GitHubActionsJobMatrix, "v"))
+	return nil
+}
+
 // FetchGolangCILintConfig writes the golangci-lint configuration file provided path relative
 // to root if it doesn't already exist.
 func (Go) FetchGolangCILintConfig(_ context.Context, where string) error {
@@ -46,6 +46,7 @@ package infrastructurerepo
 import (
 	"context"
 
+	"github.com/coopnorge/mage/internal/targets/discover"
 	"github.com/magefile/mage/mg"
 )
 
@@ -70,3 +71,12 @@ func Fix(ctx context.Context) error {
 	mg.CtxDeps(ctx, Terraform.Fix)
 	return nil
 }
+
+// Discover lists the Go modules, Terraform projects, Helm charts and pallet
+// files in the repository, whether they are included or skipped and why.
+// Configure the discovery with discovery.exclude and discovery.include in
+// .mage.yaml.
+func Discover(ctx context.Context) error {
+	mg.CtxDeps(ctx, discover.Discover)
+	return nil
+}
@@ -42,6 +42,24 @@ func (Terraform) LintFix(ctx context.Context) error {
 	return nil
 }
 
+// ValidateDir (directory: string) validates a single terraform project
+func (Terraform) ValidateDir(ctx context.Context, directory string) error {
+	mg.CtxDeps(ctx, mg.F(terraformTargets.ValidateDir, directory))
+	return nil
+}
+
+// TestDir (directory: string) tests a single terraform project
+func (Terraform) TestDir(ctx context.Context, directory string) error {
+	mg.CtxDeps(ctx, mg.F(terraformTargets.TestDir, directory))
+	return nil
+}
+
+// LintDir (directory: string) lints a single terraform project
+func (Terraform) LintDir(ctx context.Context, directory string) error {
+	mg.CtxDeps(ctx, mg.F(terraformTargets.LintDir, directory))
+	return nil
+}
+
 // Init initializes a terraform projects
 func (Terraform) Init(ctx context.Context) error {
 	mg.SerialCtxDeps(ctx, terraformTargets.Init)
@@ -87,3 +105,37 @@ func (Terraform) GitHubActionsJobMatrix(ctx context.Context) error {
 	mg.CtxDeps(ctx, terraformTargets.GitHubActionsJobMatrix)
 	return nil
 }
+
+// GitHubActionsJobMatrixInfo returns the number of jobs, chunks and the
+// max-parallel hint of the job matrix
+func (Terraform) GitHubActionsJobMatrixInfo(ctx context.Context) error {
+	mg.CtxDeps(ctx, terraformTargets.GitHubActionsJobMatrixInfo)
+	return nil
+}
+
+// GitHubActionsJobMatrixChunk returns a chunk of the job matrix, used when
+// the matrix has more jobs than GitHub Actions allows
+func (Terraform) GitHubActionsJobMatrixChunk(ctx context.Context, chunk int) error {
+	mg.CtxDeps(ctx, mg.F(terraformTargets.GitHubActionsJobMatrixChunk, chunk))
+	return nil
+}
+
+// Cost estimates the monthly cost delta of the changed terraform projects and
+// posts it as a comment in the PR when running in CI.
+func (Terraform) Cost(ctx context.Context) error {
+	mg.CtxDeps(ctx, terraformTargets.Cost)
+	return nil
+}
+
+// Policy evaluates Rego policies against the plans of the terraform projects
+func (Terraform) Policy(ctx context.Context) error {
+	mg.CtxDeps(ctx, terraformTargets.Policy)
+	return nil
+}
+
+// Graph renders the dependency graph between the terraform projects, format is
+// dot or mermaid
+func (Terraform) Graph(ctx context.Context, format string) error {
+	mg.CtxDeps(ctx, mg.F(terraformTargets.Graph, format))
+	return nil
+}
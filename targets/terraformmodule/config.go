@@ -0,0 +1,19 @@
+package terraformmodule
+
+import (
+	"context"
+
+	configTargets "github.com/coopnorge/mage/internal/targets/config"
+
+	"github.com/magefile/mage/mg"
+)
+
+// Config is the magefile namespace to group configuration commands
+type Config mg.Namespace
+
+// Show prints the effective configuration from .mage.yaml and the
+// environment, and where each value came from
+func (Config) Show(ctx context.Context) error {
+	mg.CtxDeps(ctx, configTargets.Show)
+	return nil
+}